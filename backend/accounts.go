@@ -0,0 +1,246 @@
+package main
+
+import (
+    "crypto/rand"
+    "errors"
+    "fmt"
+    "log"
+    "net/http"
+    "net/mail"
+    "os"
+    "strconv"
+    "strings"
+    "time"
+
+    "github.com/denisgjonmarkaj/meal-planner/planner"
+    "github.com/gin-gonic/gin"
+    "github.com/golang-jwt/jwt/v5"
+    "golang.org/x/crypto/bcrypt"
+    "gorm.io/gorm"
+)
+
+// Utente registrato; l'email è salvata in minuscolo
+type UserRecord struct {
+    ID           uint   `gorm:"primaryKey"`
+    Email        string `gorm:"uniqueIndex;not null"`
+    PasswordHash string `gorm:"not null"`
+    CreatedAt    time.Time
+}
+
+// Piano salvato da un utente, conservato così come è stato generato
+type SavedPlanRecord struct {
+    ID        uint             `gorm:"primaryKey"`
+    UserID    uint             `gorm:"index;not null"`
+    Name      string           `gorm:"not null"`
+    Plan      planner.MealPlan `gorm:"serializer:json"`
+    CreatedAt time.Time
+}
+
+// Piano salvato esposto dall'API; nell'elenco il piano completo è omesso
+type SavedPlan struct {
+    ID        uint              `json:"id"`
+    Name      string            `json:"name"`
+    Calories  float64           `json:"calories"`
+    CreatedAt time.Time         `json:"createdAt"`
+    Plan      *planner.MealPlan `json:"plan,omitempty"`
+}
+
+type Credentials struct {
+    Email    string `json:"email"`
+    Password string `json:"password"`
+}
+
+const (
+    minPasswordLength = 8
+    // bcrypt ignora i byte oltre il settantaduesimo
+    maxPasswordLength = 72
+    maxPlanNameLength = 100
+    tokenTTL          = 24 * time.Hour
+    tokenIssuer       = "meal-planner"
+    userIDKey         = "userID"
+    // Hash bcrypt (costo predefinito) confrontato quando l'email non esiste,
+    // così il login impiega lo stesso tempo e non rivela gli account registrati
+    dummyPasswordHash = "$2a$10$8RgjQ1GmKCKcG03NAX.r3OBK88LPy/8VpXtfWl4quPGHk72LI3.LK"
+)
+
+var (
+    errEmailTaken         = errors.New("email already registered")
+    errInvalidCredentials = errors.New("invalid email or password")
+    errPlanNotFound       = errors.New("plan not found")
+)
+
+// Chiave di firma dei token; senza MEAL_PLANNER_JWT_SECRET ne viene generata
+// una casuale e i token non sopravvivono al riavvio del server
+var jwtSecret []byte
+
+func loadJWTSecret() error {
+    if secret := os.Getenv("MEAL_PLANNER_JWT_SECRET"); secret != "" {
+        jwtSecret = []byte(secret)
+        return nil
+    }
+    jwtSecret = make([]byte, 32)
+    if _, err := rand.Read(jwtSecret); err != nil {
+        return fmt.Errorf("generating JWT secret: %w", err)
+    }
+    log.Printf("MEAL_PLANNER_JWT_SECRET is not set; using a random secret, tokens will not survive a restart")
+    return nil
+}
+
+func normalizeCredentials(credentials Credentials) (Credentials, error) {
+    credentials.Email = strings.ToLower(strings.TrimSpace(credentials.Email))
+    if address, err := mail.ParseAddress(credentials.Email); err != nil || address.Address != credentials.Email {
+        return credentials, fmt.Errorf("invalid email %q", credentials.Email)
+    }
+    if len(credentials.Password) < minPasswordLength {
+        return credentials, fmt.Errorf("password must be at least %d characters", minPasswordLength)
+    }
+    if len(credentials.Password) > maxPasswordLength {
+        return credentials, fmt.Errorf("password must be at most %d bytes", maxPasswordLength)
+    }
+    return credentials, nil
+}
+
+func registerUser(db *gorm.DB, credentials Credentials) (UserRecord, error) {
+    var existing int64
+    if err := db.Model(&UserRecord{}).Where("email = ?", credentials.Email).Count(&existing).Error; err != nil {
+        return UserRecord{}, err
+    }
+    if existing > 0 {
+        return UserRecord{}, errEmailTaken
+    }
+
+    hash, err := bcrypt.GenerateFromPassword([]byte(credentials.Password), bcrypt.DefaultCost)
+    if err != nil {
+        return UserRecord{}, err
+    }
+    // Il conteggio non basta con due registrazioni contemporanee: decide
+    // l'indice univoco sull'email
+    user := UserRecord{Email: credentials.Email, PasswordHash: string(hash)}
+    if err := db.Create(&user).Error; err != nil {
+        if errors.Is(err, gorm.ErrDuplicatedKey) {
+            return UserRecord{}, errEmailTaken
+        }
+        return UserRecord{}, err
+    }
+    return user, nil
+}
+
+func authenticate(db *gorm.DB, credentials Credentials) (UserRecord, error) {
+    var user UserRecord
+    err := db.Where("email = ?", strings.ToLower(strings.TrimSpace(credentials.Email))).First(&user).Error
+    if errors.Is(err, gorm.ErrRecordNotFound) {
+        bcrypt.CompareHashAndPassword([]byte(dummyPasswordHash), []byte(credentials.Password))
+        return UserRecord{}, errInvalidCredentials
+    }
+    if err != nil {
+        return user, err
+    }
+    if bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(credentials.Password)) != nil {
+        return UserRecord{}, errInvalidCredentials
+    }
+    return user, nil
+}
+
+func issueToken(userID uint) (string, time.Time, error) {
+    now := time.Now()
+    expiresAt := now.Add(tokenTTL)
+    token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.RegisteredClaims{
+        Subject:   strconv.FormatUint(uint64(userID), 10),
+        Issuer:    tokenIssuer,
+        IssuedAt:  jwt.NewNumericDate(now),
+        ExpiresAt: jwt.NewNumericDate(expiresAt),
+    })
+    signed, err := token.SignedString(jwtSecret)
+    return signed, expiresAt, err
+}
+
+func parseToken(signed string) (uint, error) {
+    var claims jwt.RegisteredClaims
+    _, err := jwt.ParseWithClaims(signed, &claims, func(*jwt.Token) (interface{}, error) {
+        return jwtSecret, nil
+    }, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}), jwt.WithIssuer(tokenIssuer), jwt.WithExpirationRequired())
+    if err != nil {
+        return 0, err
+    }
+    userID, err := strconv.ParseUint(claims.Subject, 10, 64)
+    if err != nil {
+        return 0, fmt.Errorf("invalid token subject %q", claims.Subject)
+    }
+    return uint(userID), nil
+}
+
+// Middleware: accetta solo richieste con "Authorization: Bearer <token>" valido
+func requireAuth(c *gin.Context) {
+    header := c.GetHeader("Authorization")
+    if !strings.HasPrefix(header, "Bearer ") {
+        c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "missing bearer token"})
+        return
+    }
+    userID, err := parseToken(strings.TrimPrefix(header, "Bearer "))
+    if err != nil {
+        c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "invalid token"})
+        return
+    }
+    c.Set(userIDKey, userID)
+    c.Next()
+}
+
+func requestUserID(c *gin.Context) uint {
+    return c.MustGet(userIDKey).(uint)
+}
+
+func savePlan(db *gorm.DB, userID uint, name string, plan planner.MealPlan) (SavedPlanRecord, error) {
+    record := SavedPlanRecord{UserID: userID, Name: name, Plan: plan}
+    return record, db.Create(&record).Error
+}
+
+func listPlans(db *gorm.DB, userID uint) ([]SavedPlanRecord, error) {
+    var records []SavedPlanRecord
+    err := db.Where("user_id = ?", userID).Order("created_at DESC, id DESC").Find(&records).Error
+    return records, err
+}
+
+// Un piano di un altro utente risulta inesistente
+func findPlan(db *gorm.DB, userID uint, id string) (SavedPlanRecord, error) {
+    var record SavedPlanRecord
+    planID, err := strconv.ParseUint(id, 10, 64)
+    if err != nil {
+        return record, errPlanNotFound
+    }
+    err = db.Where("id = ? AND user_id = ?", planID, userID).First(&record).Error
+    if errors.Is(err, gorm.ErrRecordNotFound) {
+        return record, errPlanNotFound
+    }
+    return record, err
+}
+
+func deletePlan(db *gorm.DB, userID uint, id string) error {
+    record, err := findPlan(db, userID, id)
+    if err != nil {
+        return err
+    }
+    return db.Delete(&record).Error
+}
+
+func (r SavedPlanRecord) summary() SavedPlan {
+    return SavedPlan{ID: r.ID, Name: r.Name, Calories: r.Plan.Calories, CreatedAt: r.CreatedAt}
+}
+
+func (r SavedPlanRecord) full() SavedPlan {
+    saved := r.summary()
+    saved.Plan = &r.Plan
+    return saved
+}
+
+func accountErrorStatus(err error) int {
+    switch {
+    case errors.Is(err, errEmailTaken):
+        return http.StatusConflict
+    case errors.Is(err, errInvalidCredentials):
+        return http.StatusUnauthorized
+    case errors.Is(err, errPlanNotFound):
+        return http.StatusNotFound
+    default:
+        return http.StatusInternalServerError
+    }
+}
@@ -0,0 +1,207 @@
+package main
+
+import (
+    "errors"
+    "net/http"
+    "net/http/httptest"
+    "path/filepath"
+    "strconv"
+    "sync"
+    "testing"
+    "github.com/denisgjonmarkaj/meal-planner/planner"
+    "github.com/gin-gonic/gin"
+    "gorm.io/gorm"
+)
+
+// Database temporaneo con il catalogo predefinito; il busy timeout serve ai
+// test con scritture concorrenti
+func testDB(t *testing.T) *gorm.DB {
+    t.Helper()
+    db, err := openCatalogDB(filepath.Join(t.TempDir(), "test.db")+"?_pragma=busy_timeout(5000)", catalogSource{})
+    if err != nil {
+        t.Fatal(err)
+    }
+    t.Cleanup(func() {
+        if sqlDB, err := db.DB(); err == nil {
+            sqlDB.Close()
+        }
+    })
+    return db
+}
+
+func TestNormalizeCredentials(t *testing.T) {
+    tests := []struct {
+        name      string
+        email     string
+        password  string
+        wantEmail string
+        wantErr   bool
+    }{
+        {name: "valid", email: " Anna@Example.COM ", password: "password1", wantEmail: "anna@example.com"},
+        {name: "display name", email: "Anna <anna@example.com>", password: "password1", wantErr: true},
+        {name: "missing domain", email: "anna", password: "password1", wantErr: true},
+        {name: "short password", email: "anna@example.com", password: "short", wantErr: true},
+        {name: "password over the bcrypt limit", email: "anna@example.com", password: string(make([]byte, maxPasswordLength+1)), wantErr: true},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            credentials, err := normalizeCredentials(Credentials{Email: tt.email, Password: tt.password})
+            if (err != nil) != tt.wantErr {
+                t.Fatalf("error = %v, want error: %v", err, tt.wantErr)
+            }
+            if !tt.wantErr && credentials.Email != tt.wantEmail {
+                t.Errorf("email %q, want %q", credentials.Email, tt.wantEmail)
+            }
+        })
+    }
+}
+
+func TestRegisterAndAuthenticate(t *testing.T) {
+    db := testDB(t)
+    credentials := Credentials{Email: "anna@example.com", Password: "password1"}
+    user, err := registerUser(db, credentials)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if _, err := registerUser(db, credentials); !errors.Is(err, errEmailTaken) {
+        t.Errorf("second registration: got %v, want %v", err, errEmailTaken)
+    }
+
+    tests := []struct {
+        name        string
+        credentials Credentials
+        wantErr     error
+    }{
+        {name: "valid", credentials: credentials},
+        {name: "email with different case", credentials: Credentials{Email: " ANNA@example.com", Password: "password1"}},
+        {name: "wrong password", credentials: Credentials{Email: "anna@example.com", Password: "password2"}, wantErr: errInvalidCredentials},
+        {name: "unknown email", credentials: Credentials{Email: "bruno@example.com", Password: "password1"}, wantErr: errInvalidCredentials},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            authenticated, err := authenticate(db, tt.credentials)
+            if !errors.Is(err, tt.wantErr) {
+                t.Fatalf("got %v, want %v", err, tt.wantErr)
+            }
+            if tt.wantErr == nil && authenticated.ID != user.ID {
+                t.Errorf("user %d, want %d", authenticated.ID, user.ID)
+            }
+            if tt.wantErr != nil && authenticated.ID != 0 {
+                t.Errorf("user %d returned with an error", authenticated.ID)
+            }
+        })
+    }
+}
+
+func TestConcurrentRegistration(t *testing.T) {
+    db := testDB(t)
+    const attempts = 4
+    errs := make([]error, attempts)
+    var wg sync.WaitGroup
+    for i := 0; i < attempts; i++ {
+        wg.Add(1)
+        go func(i int) {
+            defer wg.Done()
+            _, errs[i] = registerUser(db, Credentials{Email: "anna@example.com", Password: "password1"})
+        }(i)
+    }
+    wg.Wait()
+
+    registered := 0
+    for _, err := range errs {
+        switch {
+        case err == nil:
+            registered++
+        case accountErrorStatus(err) != http.StatusConflict:
+            t.Errorf("got %v, want %v", err, errEmailTaken)
+        }
+    }
+    if registered != 1 {
+        t.Errorf("%d registrations succeeded, want 1", registered)
+    }
+}
+
+func TestTokens(t *testing.T) {
+    jwtSecret = []byte("test secret")
+    token, _, err := issueToken(42)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if userID, err := parseToken(token); err != nil || userID != 42 {
+        t.Errorf("parseToken = %d, %v, want 42", userID, err)
+    }
+    if _, err := parseToken(token + "x"); err == nil {
+        t.Error("tampered token accepted")
+    }
+
+    jwtSecret = []byte("another secret")
+    if _, err := parseToken(token); err == nil {
+        t.Error("token signed with another secret accepted")
+    }
+}
+
+func TestRequireAuth(t *testing.T) {
+    gin.SetMode(gin.TestMode)
+    jwtSecret = []byte("test secret")
+    token, _, err := issueToken(7)
+    if err != nil {
+        t.Fatal(err)
+    }
+    tests := []struct {
+        name   string
+        header string
+        want   int
+    }{
+        {name: "missing header", want: http.StatusUnauthorized},
+        {name: "not a bearer token", header: "Basic " + token, want: http.StatusUnauthorized},
+        {name: "invalid token", header: "Bearer abc", want: http.StatusUnauthorized},
+        {name: "valid token", header: "Bearer " + token, want: http.StatusOK},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            r := gin.New()
+            r.GET("/api/plans", requireAuth, func(c *gin.Context) {
+                c.JSON(http.StatusOK, gin.H{"user": requestUserID(c)})
+            })
+            request := httptest.NewRequest(http.MethodGet, "/api/plans", nil)
+            if tt.header != "" {
+                request.Header.Set("Authorization", tt.header)
+            }
+            recorder := httptest.NewRecorder()
+            r.ServeHTTP(recorder, request)
+            if recorder.Code != tt.want {
+                t.Errorf("status %d, want %d", recorder.Code, tt.want)
+            }
+        })
+    }
+}
+
+func TestSavedPlansBelongToTheirUser(t *testing.T) {
+    db := testDB(t)
+    plan := planner.MealPlan{Calories: 2000}
+    saved, err := savePlan(db, 1, "Lunedì", plan)
+    if err != nil {
+        t.Fatal(err)
+    }
+    id := strconv.FormatUint(uint64(saved.ID), 10)
+
+    if _, err := findPlan(db, 2, id); !errors.Is(err, errPlanNotFound) {
+        t.Errorf("plan of another user: got %v, want %v", err, errPlanNotFound)
+    }
+    if err := deletePlan(db, 2, id); !errors.Is(err, errPlanNotFound) {
+        t.Errorf("delete by another user: got %v, want %v", err, errPlanNotFound)
+    }
+    if _, err := findPlan(db, 1, "abc"); !errors.Is(err, errPlanNotFound) {
+        t.Errorf("invalid id: got %v, want %v", err, errPlanNotFound)
+    }
+    found, err := findPlan(db, 1, id)
+    if err != nil || found.full().Plan.Calories != 2000 {
+        t.Errorf("findPlan = %+v, %v", found, err)
+    }
+    if err := deletePlan(db, 1, id); err != nil {
+        t.Fatal(err)
+    }
+    if plans, err := listPlans(db, 1); err != nil || len(plans) != 0 {
+        t.Errorf("listPlans after delete = %v, %v", plans, err)
+    }
+}
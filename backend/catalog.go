@@ -0,0 +1,124 @@
+package main
+
+import (
+    "bytes"
+    "embed"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "os"
+    "path/filepath"
+    "strings"
+    "sync"
+
+    "github.com/denisgjonmarkaj/meal-planner/planner"
+    "github.com/gin-gonic/gin"
+    "gopkg.in/yaml.v3"
+)
+
+// File predefiniti, inclusi nel binario e usati quando non si indica un percorso
+//go:embed data/foods.json data/meal_rules.json
+var defaultCatalogFiles embed.FS
+
+const (
+    defaultFoodsFile     = "data/foods.json"
+    defaultMealRulesFile = "data/meal_rules.json"
+)
+
+// Generatore costruito sul catalogo attivo; il ricaricamento lo sostituisce
+// con uno nuovo, mentre le richieste in corso continuano a usare il precedente
+var (
+    catalogMu sync.RWMutex
+    generator *planner.Generator
+)
+
+const generatorKey = "generator"
+
+// Percorsi dei file usati per popolare il database al primo avvio e per
+// ricaricarlo su richiesta; vuoti per usare i file inclusi nel binario
+type catalogSource struct {
+    FoodsPath     string
+    MealRulesPath string
+}
+
+// File del catalogo indicati all'avvio del server
+var catalogFiles catalogSource
+
+var errInvalidCatalog = errors.New("invalid catalog")
+
+// Legge e valida regole e alimenti dai file; non modifica il catalogo in uso
+func loadCatalog(source catalogSource) (map[string]planner.FoodRules, map[string]planner.MealRules, error) {
+    rules := make(map[string]planner.MealRules)
+    if err := readCatalogFile(source.MealRulesPath, defaultMealRulesFile, &rules); err != nil {
+        return nil, nil, err
+    }
+    foods := make(map[string]planner.FoodRules)
+    if err := readCatalogFile(source.FoodsPath, defaultFoodsFile, &foods); err != nil {
+        return nil, nil, err
+    }
+
+    if problems := planner.ValidateCatalog(foods, rules); len(problems) > 0 {
+        return nil, nil, fmt.Errorf("%w:\n  %s", errInvalidCatalog, strings.Join(problems, "\n  "))
+    }
+    return foods, rules, nil
+}
+
+// Rende attivo un nuovo catalogo
+func setCatalog(foods map[string]planner.FoodRules, rules map[string]planner.MealRules) {
+    g := planner.NewGenerator(planner.NewMapCatalog(foods), rules, planner.Options{})
+    catalogMu.Lock()
+    defer catalogMu.Unlock()
+    generator = g
+}
+
+func currentGenerator() *planner.Generator {
+    catalogMu.RLock()
+    defer catalogMu.RUnlock()
+    return generator
+}
+
+func catalogSize() (int, int) {
+    g := currentGenerator()
+    return len(g.Catalog().Keys()), len(g.Rules())
+}
+
+// Middleware che fissa il generatore per tutta la durata della richiesta
+func withGenerator(c *gin.Context) {
+    c.Set(generatorKey, currentGenerator())
+    c.Next()
+}
+
+func requestGenerator(c *gin.Context) *planner.Generator {
+    return c.MustGet(generatorKey).(*planner.Generator)
+}
+
+func readCatalogFile(path, embedded string, target interface{}) error {
+    var data []byte
+    var err error
+    name := path
+    if path == "" {
+        name = embedded
+        data, err = defaultCatalogFiles.ReadFile(embedded)
+    } else {
+        data, err = os.ReadFile(path)
+    }
+    if err != nil {
+        return fmt.Errorf("reading %s: %w", name, err)
+    }
+
+    // Campi sconosciuti vengono rifiutati per individuare refusi nei file
+    switch strings.ToLower(filepath.Ext(name)) {
+    case ".yaml", ".yml":
+        decoder := yaml.NewDecoder(bytes.NewReader(data))
+        decoder.KnownFields(true)
+        err = decoder.Decode(target)
+    default:
+        decoder := json.NewDecoder(bytes.NewReader(data))
+        decoder.DisallowUnknownFields()
+        err = decoder.Decode(target)
+    }
+    if err != nil {
+        return fmt.Errorf("parsing %s: %w", name, err)
+    }
+    return nil
+}
@@ -0,0 +1,577 @@
+package main
+
+import (
+    "bytes"
+    "encoding/json"
+    "errors"
+    "flag"
+    "fmt"
+    "io"
+    "os"
+    "strings"
+    "text/tabwriter"
+
+    "github.com/denisgjonmarkaj/meal-planner/planner"
+)
+
+// Comandi da riga di comando: usano lo stesso generatore del server, senza
+// avviarlo. Esempio:
+//
+//	meal-planner generate --calories 1800 --ingredients pollo,zucchine --seed 42 --format table
+var cliCommands = map[string]func(args []string, out io.Writer) error{
+    "generate":      runGenerate,
+    "ingredients":   runIngredients,
+    "validate":      runValidate,
+    "shopping-list": runShoppingList,
+    "import-foods":  runImportFoods,
+}
+
+// Errore che segnala un piano non valido: il comando esce con codice 1
+// dopo averlo stampato
+var errInvalidPlan = errors.New("plan has violations")
+
+func runCLI(command string, args []string) int {
+    err := cliCommands[command](args, os.Stdout)
+    switch {
+    case err == nil:
+        return 0
+    case errors.Is(err, flag.ErrHelp):
+        return 2
+    case errors.Is(err, errInvalidPlan):
+        return 1
+    default:
+        fmt.Fprintf(os.Stderr, "%s: %v\n", command, err)
+        return 1
+    }
+}
+
+// Opzioni comuni: catalogo da file (predefinito) o dal database, formato di uscita
+type cliOptions struct {
+    foods     string
+    mealRules string
+    db        string
+    format    string
+}
+
+func newFlagSet(name string, options *cliOptions) *flag.FlagSet {
+    fs := flag.NewFlagSet(name, flag.ContinueOnError)
+    fs.StringVar(&options.foods, "foods", os.Getenv("MEAL_PLANNER_FOODS"), "food catalog file (JSON or YAML); defaults to the built-in catalog")
+    fs.StringVar(&options.mealRules, "meal-rules", os.Getenv("MEAL_PLANNER_MEAL_RULES"), "meal rules file (JSON or YAML); defaults to the built-in rules")
+    fs.StringVar(&options.db, "db", "", "read the catalog from this SQLite database instead of the files")
+    fs.StringVar(&options.format, "format", "json", "output format: json, table or markdown")
+    return fs
+}
+
+func (o cliOptions) checkFormat() error {
+    switch o.format {
+    case "json", "table", "markdown":
+        return nil
+    default:
+        return fmt.Errorf("unknown format %q, expected json, table or markdown", o.format)
+    }
+}
+
+func (o cliOptions) generator() (*planner.Generator, error) {
+    if err := o.checkFormat(); err != nil {
+        return nil, err
+    }
+
+    if o.db != "" {
+        db, err := openCatalogDB(o.db, catalogSource{FoodsPath: o.foods, MealRulesPath: o.mealRules})
+        if err != nil {
+            return nil, err
+        }
+        if err := refreshCatalogFromDB(db); err != nil {
+            return nil, err
+        }
+        return currentGenerator(), nil
+    }
+
+    foods, rules, err := loadCatalog(catalogSource{FoodsPath: o.foods, MealRulesPath: o.mealRules})
+    if err != nil {
+        return nil, err
+    }
+    return planner.NewGenerator(planner.NewMapCatalog(foods), rules, planner.Options{}), nil
+}
+
+func runGenerate(args []string, out io.Writer) error {
+    var options cliOptions
+    fs := newFlagSet("generate", &options)
+    calories := fs.Int("calories", 0, "daily calorie target")
+    ingredients := fs.String("ingredients", "", "comma-separated preferred ingredients (catalog keys or part of the name)")
+    seed := fs.Int64("seed", 0, "seed for a reproducible plan; random if omitted")
+    count := fs.Int("count", 0, "return this many distinct plans ranked by score")
+    explain := fs.Bool("explain", false, "explain why each food is in the plan and which candidates were rejected")
+    excludeAllergens := fs.String("exclude-allergens", "", "comma-separated allergens to exclude")
+    diets := fs.String("diets", "", "comma-separated diets to follow")
+    if err := fs.Parse(args); err != nil {
+        return err
+    }
+    if *calories <= 0 {
+        return errors.New("--calories must be a positive daily target")
+    }
+
+    g, err := options.generator()
+    if err != nil {
+        return err
+    }
+    keys, err := resolveIngredientKeys(g.Catalog(), splitList(*ingredients))
+    if err != nil {
+        return err
+    }
+    request := planner.PlanRequest{
+        Ingredients:      keys,
+        TargetCalories:   *calories,
+        ExcludeAllergens: splitList(*excludeAllergens),
+        Diets:            splitList(*diets),
+        Count:            *count,
+        Explain:          *explain,
+    }
+    if flagPassed(fs, "seed") {
+        request.Seed = seed
+    }
+
+    if request.Count > 0 {
+        ranked, err := g.GeneratePlans(request)
+        if err != nil {
+            return err
+        }
+        if options.format == "json" {
+            return writeJSON(out, ranked)
+        }
+        for _, candidate := range ranked.Plans {
+            score := candidate.Score
+            heading := fmt.Sprintf("Piano %d (seed %d), punteggio %.3f: calorie %.2f, macro %.2f, ingredienti %.2f, varietà %.2f",
+                candidate.Rank, *candidate.Plan.Seed, score.Total, score.Calories, score.Macros, score.Ingredients, score.Variety)
+            if options.format == "markdown" {
+                err = writePlanMarkdown(out, heading, candidate.Plan)
+            } else {
+                fmt.Fprintf(out, "%s\n\n", heading)
+                err = writePlanTable(out, candidate.Plan)
+            }
+            if err != nil {
+                return err
+            }
+            fmt.Fprintln(out)
+        }
+        for _, warning := range ranked.Warnings {
+            fmt.Fprintln(out, warning)
+        }
+        return nil
+    }
+
+    plan, err := g.GeneratePlan(request)
+    if err != nil {
+        return err
+    }
+    switch options.format {
+    case "table":
+        return writePlanTable(out, plan)
+    case "markdown":
+        return writePlanMarkdown(out, "Piano alimentare", plan)
+    default:
+        return writeJSON(out, plan)
+    }
+}
+
+func runIngredients(args []string, out io.Writer) error {
+    var options cliOptions
+    fs := newFlagSet("ingredients", &options)
+    if err := fs.Parse(args); err != nil {
+        return err
+    }
+
+    g, err := options.generator()
+    if err != nil {
+        return err
+    }
+    meals := g.Ingredients()
+    switch options.format {
+    case "table":
+        w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+        fmt.Fprintln(w, "PASTO\tCATEGORIA\tINGREDIENTI")
+        for _, meal := range meals {
+            for _, category := range meal.Categories {
+                fmt.Fprintf(w, "%s\t%s\t%s\n", meal.MealName, category.Name, strings.Join(category.Ingredients, ", "))
+            }
+        }
+        return w.Flush()
+    case "markdown":
+        for _, meal := range meals {
+            fmt.Fprintf(out, "## %s\n\n", meal.MealName)
+            for _, category := range meal.Categories {
+                fmt.Fprintf(out, "- **%s**: %s\n", category.Name, strings.Join(category.Ingredients, ", "))
+            }
+            fmt.Fprintln(out)
+        }
+        return nil
+    default:
+        return writeJSON(out, meals)
+    }
+}
+
+func runValidate(args []string, out io.Writer) error {
+    var options cliOptions
+    fs := newFlagSet("validate", &options)
+    calories := fs.Float64("calories", 0, "daily calorie target; defaults to the sum of the meal targets")
+    if err := fs.Parse(args); err != nil {
+        return err
+    }
+    if fs.NArg() != 1 {
+        return errors.New("expected one plan file, or - for standard input")
+    }
+
+    g, err := options.generator()
+    if err != nil {
+        return err
+    }
+    data, err := readInput(fs.Arg(0))
+    if err != nil {
+        return err
+    }
+    var plan planner.MealPlan
+    if err := decodeJSON(fs.Arg(0), data, &plan); err != nil {
+        return err
+    }
+
+    validation := g.ValidatePlan(plan, *calories)
+    switch options.format {
+    case "table":
+        w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+        fmt.Fprintln(w, "CODICE\tPASTO\tDETTAGLIO")
+        for _, v := range validation.Violations {
+            fmt.Fprintf(w, "%s\t%s\t%s\n", v.Code, v.Meal, v.Message)
+        }
+        fmt.Fprintf(w, "\nTotale: %.0f kcal su %.0f\n", validation.Calories, validation.TargetCalories)
+        err = w.Flush()
+    case "markdown":
+        fmt.Fprintf(out, "Totale: %.0f kcal su %.0f\n\n", validation.Calories, validation.TargetCalories)
+        if len(validation.Violations) > 0 {
+            fmt.Fprintln(out, "| Codice | Pasto | Dettaglio |")
+            fmt.Fprintln(out, "|---|---|---|")
+            for _, v := range validation.Violations {
+                fmt.Fprintf(out, "| %s | %s | %s |\n", v.Code, v.Meal, v.Message)
+            }
+        }
+    default:
+        err = writeJSON(out, validation)
+    }
+    if err != nil {
+        return err
+    }
+    if !validation.Valid {
+        return errInvalidPlan
+    }
+    return nil
+}
+
+func runShoppingList(args []string, out io.Writer) error {
+    var options cliOptions
+    fs := newFlagSet("shopping-list", &options)
+    groupBy := fs.String("group-by", "category", "group items by category or aisle")
+    if err := fs.Parse(args); err != nil {
+        return err
+    }
+    if fs.NArg() == 0 {
+        return errors.New("expected one or more plan files (daily or weekly), or - for standard input")
+    }
+
+    g, err := options.generator()
+    if err != nil {
+        return err
+    }
+    request := planner.ShoppingListRequest{GroupBy: *groupBy}
+    for _, path := range fs.Args() {
+        data, err := readInput(path)
+        if err != nil {
+            return err
+        }
+        // Un piano settimanale si riconosce dai giorni
+        var week planner.WeeklyPlan
+        if err := decodeJSON(path, data, &week); err != nil {
+            return err
+        }
+        if len(week.Days) > 0 {
+            for _, day := range week.Days {
+                request.Plans = append(request.Plans, day.MealPlan)
+            }
+            continue
+        }
+        var plan planner.MealPlan
+        if err := decodeJSON(path, data, &plan); err != nil {
+            return err
+        }
+        request.Plans = append(request.Plans, plan)
+    }
+
+    list, err := g.ShoppingList(request)
+    if err != nil {
+        return err
+    }
+    switch options.format {
+    case "table":
+        _, err = io.WriteString(out, list.Text)
+        return err
+    case "markdown":
+        fmt.Fprintln(out, "# Lista della spesa")
+        for _, group := range list.Groups {
+            fmt.Fprintf(out, "\n## %s\n\n", group.Name)
+            for _, item := range group.Items {
+                fmt.Fprintf(out, "- [ ] %s: %g %s\n", item.Name, item.Quantity, item.Unit)
+            }
+        }
+        return nil
+    default:
+        return writeJSON(out, list)
+    }
+}
+
+// Importa nel catalogo del database gli alimenti di un CSV nutrizionale;
+// senza --db usa lo stesso database del server
+func runImportFoods(args []string, out io.Writer) error {
+    var options cliOptions
+    fs := newFlagSet("import-foods", &options)
+    var columns, keys repeatedFlag
+    fs.Var(&columns, "column", "field=column for a column that is not recognized, e.g. calories=Energia (kcal); repeatable")
+    fs.Var(&keys, "key", "name=key to merge a row into an existing food or create it under a new key, e.g. Pollo, petto=petto_pollo; repeatable")
+    category := fs.String("category", "", "category of new foods when the CSV has none")
+    mealTypes := fs.String("meal-types", "", "comma-separated meal types of new foods when the CSV has none")
+    dryRun := fs.Bool("dry-run", false, "report what would change without writing to the database")
+    if err := fs.Parse(args); err != nil {
+        return err
+    }
+    if fs.NArg() != 1 {
+        return errors.New("expected one CSV file, or - for standard input")
+    }
+    if options.db == "" {
+        options.db = envOrDefault("MEAL_PLANNER_DB", "meal-planner.db")
+    }
+
+    mapped, err := parseColumnMappings(columns)
+    if err != nil {
+        return err
+    }
+    mappedKeys, err := parseKeyMappings(keys)
+    if err != nil {
+        return err
+    }
+    importOptions := FoodImportOptions{Columns: mapped, Keys: mappedKeys, Category: *category, MealTypes: splitList(*mealTypes), DryRun: *dryRun}
+
+    if err := options.checkFormat(); err != nil {
+        return err
+    }
+    data, err := readInput(fs.Arg(0))
+    if err != nil {
+        return err
+    }
+    db, err := openCatalogDB(options.db, catalogSource{FoodsPath: options.foods, MealRulesPath: options.mealRules})
+    if err != nil {
+        return err
+    }
+    // Il catalogo attivo serve per validare i nuovi alimenti contro le regole dei pasti
+    if err := refreshCatalogFromDB(db); err != nil {
+        return err
+    }
+    report, err := importFoods(db, bytes.NewReader(data), importOptions)
+    if err != nil {
+        return err
+    }
+
+    switch options.format {
+    case "table", "markdown":
+        return writeImportReport(out, report, options.format == "markdown")
+    default:
+        return writeJSON(out, report)
+    }
+}
+
+// Flag ripetibile: nomi di colonna e di alimento possono contenere virgole
+type repeatedFlag []string
+
+func (m *repeatedFlag) String() string {
+    return strings.Join(*m, "; ")
+}
+
+func (m *repeatedFlag) Set(value string) error {
+    *m = append(*m, value)
+    return nil
+}
+
+func writeImportReport(out io.Writer, report FoodImportReport, markdown bool) error {
+    prefix := ""
+    if report.DryRun {
+        prefix = "(prova, nessuna modifica salvata) "
+    }
+    fmt.Fprintf(out, "%s%d righe: %d nuovi, %d aggiornati, %d invariati, %d scartati\n\n",
+        prefix, report.Rows, report.Created, report.Updated, report.Unchanged, len(report.Skipped))
+    if markdown {
+        fmt.Fprintln(out, "| Esito | Chiave | Alimento | Campi |")
+        fmt.Fprintln(out, "|---|---|---|---|")
+        for _, food := range report.Foods {
+            fmt.Fprintf(out, "| %s | %s | %s | %s |\n", food.Action, food.Key, food.Name, strings.Join(food.Fields, ", "))
+        }
+        if len(report.Skipped) > 0 {
+            fmt.Fprintln(out, "\n| Riga | Alimento | Motivo |")
+            fmt.Fprintln(out, "|---:|---|---|")
+            for _, row := range report.Skipped {
+                fmt.Fprintf(out, "| %d | %s | %s |\n", row.Row, row.Name, row.Reason)
+            }
+        }
+        return nil
+    }
+
+    w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+    fmt.Fprintln(w, "ESITO\tCHIAVE\tALIMENTO\tCAMPI")
+    for _, food := range report.Foods {
+        fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", food.Action, food.Key, food.Name, strings.Join(food.Fields, ", "))
+    }
+    if len(report.Skipped) > 0 {
+        fmt.Fprintln(w, "\nRIGA\tALIMENTO\tMOTIVO\t")
+        for _, row := range report.Skipped {
+            fmt.Fprintf(w, "%d\t%s\t%s\t\n", row.Row, row.Name, row.Reason)
+        }
+    }
+    return w.Flush()
+}
+
+func writePlanTable(out io.Writer, plan planner.MealPlan) error {
+    w := tabwriter.NewWriter(out, 0, 4, 2, ' ', tabwriter.AlignRight)
+    fmt.Fprintln(w, "PASTO\tALIMENTO\tQUANTITÀ\tKCAL\tPROTEINE\tCARBOIDRATI\tGRASSI\t")
+    for _, slot := range plan.Slots {
+        for _, item := range slot.Items {
+            fmt.Fprintf(w, "%s\t%s\t%g %s\t%.0f\t%.1f\t%.1f\t%.1f\t\n", slot.Name, item.Name, item.Quantity, item.Unit, item.Calories, item.Protein, item.Carbs, item.Fat)
+        }
+        fmt.Fprintf(w, "%s\t(totale, target %.0f)\t\t%.0f\t%.1f\t%.1f\t%.1f\t\n", slot.Name, slot.TargetCalories, slot.Calories, slot.Protein, slot.Carbs, slot.Fat)
+    }
+    fmt.Fprintf(w, "GIORNATA\t\t\t%.0f\t%.1f\t%.1f\t%.1f\t\n", plan.Calories, plan.Protein, plan.Carbs, plan.Fat)
+    if err := w.Flush(); err != nil {
+        return err
+    }
+    if err := writeExplanations(out, plan, ""); err != nil {
+        return err
+    }
+    return writeWarnings(out, plan, "")
+}
+
+func writePlanMarkdown(out io.Writer, title string, plan planner.MealPlan) error {
+    fmt.Fprintf(out, "# %s\n", title)
+    for _, slot := range plan.Slots {
+        fmt.Fprintf(out, "\n## %s (%.0f / %.0f kcal)\n\n", strings.Title(slot.Name), slot.Calories, slot.TargetCalories)
+        fmt.Fprintln(out, "| Alimento | Quantità | kcal | Proteine | Carboidrati | Grassi |")
+        fmt.Fprintln(out, "|---|---:|---:|---:|---:|---:|")
+        for _, item := range slot.Items {
+            fmt.Fprintf(out, "| %s | %g %s | %.0f | %.1f | %.1f | %.1f |\n", item.Name, item.Quantity, item.Unit, item.Calories, item.Protein, item.Carbs, item.Fat)
+        }
+    }
+    fmt.Fprintf(out, "\n**Totale:** %.0f kcal, proteine %.1f g, carboidrati %.1f g, grassi %.1f g\n", plan.Calories, plan.Protein, plan.Carbs, plan.Fat)
+    if err := writeExplanations(out, plan, "- "); err != nil {
+        return err
+    }
+    return writeWarnings(out, plan, "- ")
+}
+
+// Motivi delle scelte e candidati scartati, presenti solo con --explain
+func writeExplanations(out io.Writer, plan planner.MealPlan, bullet string) error {
+    for _, slot := range plan.Slots {
+        for _, item := range slot.Items {
+            if item.Explanation == nil {
+                continue
+            }
+            if _, err := fmt.Fprintf(out, "%s%s, %s: %s\n", bullet, slot.Name, item.Name, item.Explanation.Reason); err != nil {
+                return err
+            }
+        }
+        for _, rejected := range slot.Rejected {
+            if _, err := fmt.Fprintf(out, "%s%s, scartato: %s\n", bullet, slot.Name, rejected.Message); err != nil {
+                return err
+            }
+        }
+    }
+    return nil
+}
+
+func writeWarnings(out io.Writer, plan planner.MealPlan, bullet string) error {
+    for _, slot := range plan.Slots {
+        for _, warning := range slot.Warnings {
+            if _, err := fmt.Fprintf(out, "%s%s: %s\n", bullet, slot.Name, warning); err != nil {
+                return err
+            }
+        }
+    }
+    for _, ingredient := range plan.Unplaced {
+        if _, err := fmt.Fprintf(out, "%snon usato: %s\n", bullet, ingredient.Message); err != nil {
+            return err
+        }
+    }
+    return nil
+}
+
+func writeJSON(out io.Writer, value interface{}) error {
+    encoder := json.NewEncoder(out)
+    encoder.SetIndent("", "  ")
+    return encoder.Encode(value)
+}
+
+// Legge un file, o lo standard input se il percorso è "-"
+func readInput(path string) ([]byte, error) {
+    if path == "-" {
+        return io.ReadAll(os.Stdin)
+    }
+    return os.ReadFile(path)
+}
+
+func decodeJSON(path string, data []byte, target interface{}) error {
+    if err := json.Unmarshal(data, target); err != nil {
+        return fmt.Errorf("parsing %s: %w", path, err)
+    }
+    return nil
+}
+
+// Traduce gli ingredienti indicati in chiavi del catalogo: vale la chiave
+// esatta, altrimenti l'unico alimento la cui chiave o nome contiene il testo
+func resolveIngredientKeys(catalog planner.Catalog, names []string) ([]string, error) {
+    var keys []string
+    for _, name := range names {
+        if _, exists := catalog.Food(name); exists {
+            keys = append(keys, name)
+            continue
+        }
+        var matches []string
+        needle := strings.ToLower(name)
+        for _, key := range catalog.Keys() {
+            food, _ := catalog.Food(key)
+            if strings.Contains(key, needle) || strings.Contains(strings.ToLower(food.Name), needle) {
+                matches = append(matches, key)
+            }
+        }
+        switch len(matches) {
+        case 0:
+            return nil, fmt.Errorf("unknown ingredient %q", name)
+        case 1:
+            keys = append(keys, matches[0])
+        default:
+            return nil, fmt.Errorf("ingredient %q is ambiguous: %s", name, strings.Join(matches, ", "))
+        }
+    }
+    return keys, nil
+}
+
+func splitList(value string) []string {
+    var items []string
+    for _, item := range strings.Split(value, ",") {
+        if item = strings.TrimSpace(item); item != "" {
+            items = append(items, item)
+        }
+    }
+    return items
+}
+
+func flagPassed(fs *flag.FlagSet, name string) bool {
+    passed := false
+    fs.Visit(func(f *flag.Flag) {
+        if f.Name == name {
+            passed = true
+        }
+    })
+    return passed
+}
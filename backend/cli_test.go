@@ -0,0 +1,192 @@
+package main
+
+import (
+    "bytes"
+    "encoding/json"
+    "errors"
+    "math"
+    "os"
+    "path/filepath"
+    "reflect"
+    "strings"
+    "testing"
+    "github.com/denisgjonmarkaj/meal-planner/planner"
+)
+
+// Esegue un comando con il catalogo predefinito e restituisce l'output
+func runCommand(t *testing.T, command string, args ...string) (string, error) {
+    t.Helper()
+    t.Setenv("MEAL_PLANNER_FOODS", "")
+    t.Setenv("MEAL_PLANNER_MEAL_RULES", "")
+    var out bytes.Buffer
+    err := cliCommands[command](args, &out)
+    return out.String(), err
+}
+
+func writeTempFile(t *testing.T, name, content string) string {
+    t.Helper()
+    path := filepath.Join(t.TempDir(), name)
+    if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+        t.Fatal(err)
+    }
+    return path
+}
+
+func TestGenerateCommand(t *testing.T) {
+    tests := []struct {
+        name    string
+        args    []string
+        // Testo atteso nell'output
+        want    string
+        wantErr bool
+    }{
+        {name: "json", args: []string{"--calories", "1800", "--seed", "42"}, want: `"seed": 42`},
+        {name: "table", args: []string{"--calories", "1800", "--seed", "42", "--format", "table"}, want: "GIORNATA"},
+        {name: "markdown", args: []string{"--calories", "1800", "--seed", "42", "--format", "markdown"}, want: "# Piano alimentare"},
+        {name: "ranked", args: []string{"--calories", "2000", "--seed", "1", "--count", "2", "--format", "table"}, want: "Piano 2"},
+        {name: "ingredients by name", args: []string{"--calories", "1800", "--seed", "42", "--ingredients", "basmati,zucchine"}, want: `"key": "riso_basmati"`},
+        {name: "missing calories", args: []string{"--seed", "42"}, wantErr: true},
+        {name: "unknown format", args: []string{"--calories", "1800", "--format", "xml"}, wantErr: true},
+        {name: "ambiguous ingredient", args: []string{"--calories", "1800", "--ingredients", "riso"}, wantErr: true},
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            out, err := runCommand(t, "generate", tt.args...)
+            if tt.wantErr {
+                if err == nil {
+                    t.Fatal("expected an error")
+                }
+                return
+            }
+            if err != nil {
+                t.Fatal(err)
+            }
+            if !strings.Contains(out, tt.want) {
+                t.Errorf("output without %q:\n%s", tt.want, out)
+            }
+        })
+    }
+}
+
+func TestGenerateCommandMatchesGenerator(t *testing.T) {
+    out, err := runCommand(t, "generate", "--calories", "2000", "--seed", "7")
+    if err != nil {
+        t.Fatal(err)
+    }
+    var fromCLI planner.MealPlan
+    if err := json.Unmarshal([]byte(out), &fromCLI); err != nil {
+        t.Fatal(err)
+    }
+
+    foods, rules, err := loadCatalog(catalogSource{})
+    if err != nil {
+        t.Fatal(err)
+    }
+    seed := int64(7)
+    plan, err := planner.NewGenerator(planner.NewMapCatalog(foods), rules, planner.Options{}).GeneratePlan(planner.PlanRequest{TargetCalories: 2000, Seed: &seed})
+    if err != nil {
+        t.Fatal(err)
+    }
+    // Il confronto passa dal JSON, come l'output del comando
+    data, _ := json.Marshal(plan)
+    var fromGenerator planner.MealPlan
+    if err := json.Unmarshal(data, &fromGenerator); err != nil {
+        t.Fatal(err)
+    }
+    if !reflect.DeepEqual(fromCLI, fromGenerator) {
+        t.Error("the command and the generator return different plans for the same seed")
+    }
+}
+
+func TestValidateAndShoppingListCommands(t *testing.T) {
+    out, err := runCommand(t, "generate", "--calories", "2000", "--seed", "3")
+    if err != nil {
+        t.Fatal(err)
+    }
+    planPath := writeTempFile(t, "plan.json", out)
+    var plan planner.MealPlan
+    if err := json.Unmarshal([]byte(out), &plan); err != nil {
+        t.Fatal(err)
+    }
+    plan.Slots[0].Items[0].Key, plan.Slots[0].Items[0].Name = "pizza", "Pizza"
+    data, _ := json.Marshal(plan)
+    invalidPath := writeTempFile(t, "invalid.json", string(data))
+
+    if _, err := runCommand(t, "validate", "--calories", "2000", planPath); err != nil {
+        t.Errorf("validate: %v", err)
+    }
+    out, err = runCommand(t, "validate", "--format", "table", invalidPath)
+    if !errors.Is(err, errInvalidPlan) {
+        t.Errorf("validate with an unknown food: got %v, want %v", err, errInvalidPlan)
+    }
+    if !strings.Contains(out, planner.ViolationUnknownFood) {
+        t.Errorf("validate output without %s:\n%s", planner.ViolationUnknownFood, out)
+    }
+    if _, err := runCommand(t, "validate", planPath, invalidPath); err == nil {
+        t.Error("validate accepted two files")
+    }
+
+    // Due copie dello stesso giorno raddoppiano ogni quantità
+    lists := make([]planner.ShoppingList, 2)
+    for i, files := range [][]string{{planPath}, {planPath, planPath}} {
+        out, err := runCommand(t, "shopping-list", files...)
+        if err != nil {
+            t.Fatal(err)
+        }
+        if err := json.Unmarshal([]byte(out), &lists[i]); err != nil {
+            t.Fatal(err)
+        }
+    }
+    if len(lists[0].Groups) == 0 || len(lists[0].Groups) != len(lists[1].Groups) {
+        t.Fatalf("groups %v and %v", lists[0].Groups, lists[1].Groups)
+    }
+    for i, group := range lists[0].Groups {
+        for j, item := range group.Items {
+            if doubled := lists[1].Groups[i].Items[j].Quantity; math.Abs(doubled-2*item.Quantity) > 1 {
+                t.Errorf("%s: %g for two days, %g for one", item.Name, doubled, item.Quantity)
+            }
+        }
+    }
+    if _, err := runCommand(t, "shopping-list"); err == nil {
+        t.Error("shopping-list accepted no files")
+    }
+}
+
+func TestIngredientsCommand(t *testing.T) {
+    out, err := runCommand(t, "ingredients", "--format", "markdown")
+    if err != nil {
+        t.Fatal(err)
+    }
+    if !strings.Contains(out, "## Colazione") {
+        t.Errorf("output without breakfast:\n%s", out)
+    }
+}
+
+func TestResolveIngredientKeys(t *testing.T) {
+    foods, _, err := loadCatalog(catalogSource{})
+    if err != nil {
+        t.Fatal(err)
+    }
+    catalog := planner.NewMapCatalog(foods)
+    tests := []struct {
+        names   []string
+        want    []string
+        wantErr bool
+    }{
+        {names: []string{"petto_pollo", "zucchine"}, want: []string{"petto_pollo", "zucchine"}},
+        {names: []string{"Basmati", "merluzzo"}, want: []string{"riso_basmati", "merluzzo"}},
+        {names: []string{"riso"}, wantErr: true},
+        {names: []string{"pizza"}, wantErr: true},
+    }
+    for _, tt := range tests {
+        keys, err := resolveIngredientKeys(catalog, tt.names)
+        if (err != nil) != tt.wantErr {
+            t.Errorf("%v: error = %v, want error: %v", tt.names, err, tt.wantErr)
+            continue
+        }
+        if !tt.wantErr && !reflect.DeepEqual(keys, tt.want) {
+            t.Errorf("%v: got %v, want %v", tt.names, keys, tt.want)
+        }
+    }
+}
@@ -0,0 +1,551 @@
+package main
+
+import (
+    "errors"
+    "fmt"
+    "log"
+    "net/http"
+    "regexp"
+    "sort"
+    "strings"
+    "time"
+
+    "github.com/denisgjonmarkaj/meal-planner/planner"
+    "github.com/glebarez/sqlite"
+    "gorm.io/gorm"
+)
+
+// Alimento del catalogo persistito; DeletedAt valorizzato indica un alimento ritirato
+type FoodRecord struct {
+    ID              uint           `gorm:"primaryKey"`
+    Key             string         `gorm:"uniqueIndex;not null"`
+    Name            string         `gorm:"not null"`
+    StandardPortion float64
+    Unit            string
+    CaloriesPer100g float64
+    ProteinPer100g  float64
+    CarbsPer100g    float64
+    FatPer100g      float64
+    FiberPer100g    float64
+    Category        string         `gorm:"index"`
+    Description     string
+    MealTypes       []string       `gorm:"serializer:json"`
+    MinPortion      float64
+    MaxPortion      float64
+    Required        bool
+    Frequency       int
+    Allergens       []string       `gorm:"serializer:json"`
+    Diets           []string       `gorm:"serializer:json"`
+    Aisle           string
+    PackageSize     float64
+    PackageName     string
+    CreatedAt       time.Time
+    UpdatedAt       time.Time
+    DeletedAt       gorm.DeletedAt `gorm:"index"`
+}
+
+type MealRuleRecord struct {
+    MealType           string             `gorm:"primaryKey"`
+    RequiredCategories []string           `gorm:"serializer:json"`
+    CategoryLimits     map[string]float64 `gorm:"serializer:json"`
+    MinProtein         float64
+    MinCarbs           float64
+    MaxFat             float64
+    UpdatedAt          time.Time
+}
+
+// Versione dello schema applicata al database
+type SchemaMigration struct {
+    Version   int    `gorm:"primaryKey"`
+    Name      string
+    AppliedAt time.Time
+}
+
+type migration struct {
+    Version int
+    Name    string
+    Apply   func(tx *gorm.DB, seed catalogSource) error
+}
+
+// Migrazioni in ordine di versione; quelle già applicate non vengono ripetute
+var migrations = []migration{
+    {
+        Version: 1,
+        Name:    "create catalog tables",
+        Apply: func(tx *gorm.DB, seed catalogSource) error {
+            return tx.AutoMigrate(&FoodRecord{}, &MealRuleRecord{})
+        },
+    },
+    {
+        Version: 2,
+        Name:    "seed catalog from data files",
+        Apply: func(tx *gorm.DB, seed catalogSource) error {
+            foods, rules, err := loadCatalog(seed)
+            if err != nil {
+                return err
+            }
+            for _, mealType := range planner.SortedKeys(rules) {
+                record := mealRuleRecordFrom(mealType, rules[mealType])
+                if err := tx.Create(&record).Error; err != nil {
+                    return err
+                }
+            }
+            for _, key := range planner.SortedKeys(foods) {
+                record := foodRecordFrom(key, foods[key])
+                if err := tx.Create(&record).Error; err != nil {
+                    return err
+                }
+            }
+            log.Printf("Seeded catalog with %d foods and %d meal types", len(foods), len(rules))
+            return nil
+        },
+    },
+    {
+        Version: 3,
+        Name:    "add aisle and package sizes",
+        Apply: func(tx *gorm.DB, seed catalogSource) error {
+            if err := tx.AutoMigrate(&FoodRecord{}); err != nil {
+                return err
+            }
+            // Completa gli alimenti già presenti con i dati dei file, senza
+            // toccare quelli a cui è già stato assegnato un reparto
+            foods, _, err := loadCatalog(seed)
+            if err != nil {
+                return err
+            }
+            for _, key := range planner.SortedKeys(foods) {
+                food := foods[key]
+                err := tx.Unscoped().Model(&FoodRecord{}).
+                    Where("key = ? AND (aisle IS NULL OR aisle = '')", key).
+                    Updates(map[string]interface{}{
+                        "aisle":        food.Aisle,
+                        "package_size": food.PackageSize,
+                        "package_name": food.PackageName,
+                    }).Error
+                if err != nil {
+                    return err
+                }
+            }
+            return nil
+        },
+    },
+    {
+        Version: 4,
+        Name:    "add allergens and diets",
+        Apply: func(tx *gorm.DB, seed catalogSource) error {
+            if err := tx.AutoMigrate(&FoodRecord{}); err != nil {
+                return err
+            }
+            // Riporta i tag dei file sugli alimenti già presenti che non ne hanno
+            foods, _, err := loadCatalog(seed)
+            if err != nil {
+                return err
+            }
+            for _, key := range planner.SortedKeys(foods) {
+                food := foods[key]
+                err := tx.Unscoped().Model(&FoodRecord{}).
+                    Where("key = ? AND (diets IS NULL OR diets = '' OR diets = 'null')", key).
+                    Select("Allergens", "Diets").
+                    Updates(FoodRecord{Allergens: food.Allergens, Diets: food.Diets}).Error
+                if err != nil {
+                    return err
+                }
+            }
+            return nil
+        },
+    },
+    {
+        Version: 5,
+        Name:    "create users and saved plans",
+        Apply: func(tx *gorm.DB, seed catalogSource) error {
+            return tx.AutoMigrate(&UserRecord{}, &SavedPlanRecord{})
+        },
+    },
+    {
+        Version: 6,
+        Name:    "create food diary",
+        Apply: func(tx *gorm.DB, seed catalogSource) error {
+            return tx.AutoMigrate(&DiaryEntryRecord{})
+        },
+    },
+    {
+        Version: 7,
+        Name:    "create weigh-ins",
+        Apply: func(tx *gorm.DB, seed catalogSource) error {
+            return tx.AutoMigrate(&WeighInRecord{})
+        },
+    },
+    {
+        Version: 8,
+        Name:    "raise the weekly frequency of required foods",
+        Apply: func(tx *gorm.DB, seed catalogSource) error {
+            // Frequency ora limita anche gli alimenti obbligatori, che servono
+            // ogni giorno: si usa il valore dei file o, in mancanza, uno al giorno
+            foods, _, err := loadCatalog(seed)
+            if err != nil {
+                return err
+            }
+            var records []FoodRecord
+            if err := tx.Unscoped().Where("required AND frequency > 0 AND frequency < ?", 7).Find(&records).Error; err != nil {
+                return err
+            }
+            for _, record := range records {
+                frequency := 7
+                if food, exists := foods[record.Key]; exists && food.Frequency >= frequency {
+                    frequency = food.Frequency
+                }
+                if err := tx.Unscoped().Model(&record).Update("frequency", frequency).Error; err != nil {
+                    return err
+                }
+            }
+            return nil
+        },
+    },
+    {
+        Version: 9,
+        Name:    "tag meat and add vegetarian and gluten-free staples",
+        Apply: func(tx *gorm.DB, seed catalogSource) error {
+            // Aggiunge gli alimenti nuovi dei file (non quelli cancellati
+            // dall'utente) e il tag "meat" a carne e salumi già presenti
+            foods, _, err := loadCatalog(seed)
+            if err != nil {
+                return err
+            }
+            hasMeat := func(allergens []string) bool {
+                for _, allergen := range allergens {
+                    if allergen == "meat" {
+                        return true
+                    }
+                }
+                return false
+            }
+            for _, key := range planner.SortedKeys(foods) {
+                food := foods[key]
+                var record FoodRecord
+                err := tx.Unscoped().Where("key = ?", key).First(&record).Error
+                if errors.Is(err, gorm.ErrRecordNotFound) {
+                    record = foodRecordFrom(key, food)
+                    if err := tx.Create(&record).Error; err != nil {
+                        return err
+                    }
+                    continue
+                }
+                if err != nil {
+                    return err
+                }
+                if !hasMeat(food.Allergens) || hasMeat(record.Allergens) {
+                    continue
+                }
+                allergens := append(append([]string(nil), record.Allergens...), "meat")
+                if err := tx.Unscoped().Model(&record).Select("Allergens").Updates(FoodRecord{Allergens: allergens}).Error; err != nil {
+                    return err
+                }
+            }
+            return nil
+        },
+    },
+}
+
+var catalogDB *gorm.DB
+
+func openCatalogDB(path string, seed catalogSource) (*gorm.DB, error) {
+    // TranslateError: le violazioni dei vincoli diventano errori gorm (ErrDuplicatedKey)
+    db, err := gorm.Open(sqlite.Open(path), &gorm.Config{TranslateError: true})
+    if err != nil {
+        return nil, fmt.Errorf("opening database %s: %w", path, err)
+    }
+    if err := migrateCatalogDB(db, seed); err != nil {
+        return nil, err
+    }
+    return db, nil
+}
+
+func migrateCatalogDB(db *gorm.DB, seed catalogSource) error {
+    if err := db.AutoMigrate(&SchemaMigration{}); err != nil {
+        return fmt.Errorf("creating schema_migrations: %w", err)
+    }
+
+    for _, m := range migrations {
+        var applied int64
+        if err := db.Model(&SchemaMigration{}).Where("version = ?", m.Version).Count(&applied).Error; err != nil {
+            return err
+        }
+        if applied > 0 {
+            continue
+        }
+
+        err := db.Transaction(func(tx *gorm.DB) error {
+            if err := m.Apply(tx, seed); err != nil {
+                return err
+            }
+            return tx.Create(&SchemaMigration{Version: m.Version, Name: m.Name, AppliedAt: time.Now()}).Error
+        })
+        if err != nil {
+            return fmt.Errorf("migration %d (%s): %w", m.Version, m.Name, err)
+        }
+        log.Printf("Applied migration %d: %s", m.Version, m.Name)
+    }
+    return nil
+}
+
+// Legge il catalogo attivo dal database e lo rende disponibile al generatore;
+// se non supera la validazione il generatore in uso resta invariato
+func refreshCatalogFromDB(db *gorm.DB) error {
+    foods, rules, err := validCatalogFromDB(db)
+    if err != nil {
+        return err
+    }
+    setCatalog(foods, rules)
+    return nil
+}
+
+// Applica una modifica al catalogo in una transazione: se il catalogo che ne
+// risulta non è valido la modifica viene annullata e resta attivo il precedente
+func updateCatalog(db *gorm.DB, change func(tx *gorm.DB) error) error {
+    var foods map[string]planner.FoodRules
+    var rules map[string]planner.MealRules
+    err := db.Transaction(func(tx *gorm.DB) error {
+        if err := change(tx); err != nil {
+            return err
+        }
+        var err error
+        foods, rules, err = validCatalogFromDB(tx)
+        return err
+    })
+    if err != nil {
+        return err
+    }
+    setCatalog(foods, rules)
+    return nil
+}
+
+func validCatalogFromDB(db *gorm.DB) (map[string]planner.FoodRules, map[string]planner.MealRules, error) {
+    var ruleRecords []MealRuleRecord
+    if err := db.Find(&ruleRecords).Error; err != nil {
+        return nil, nil, err
+    }
+    var foodRecords []FoodRecord
+    if err := db.Find(&foodRecords).Error; err != nil {
+        return nil, nil, err
+    }
+
+    rules := make(map[string]planner.MealRules, len(ruleRecords))
+    for _, record := range ruleRecords {
+        rules[record.MealType] = record.toMealRules()
+    }
+    foods := make(map[string]planner.FoodRules, len(foodRecords))
+    for _, record := range foodRecords {
+        foods[record.Key] = record.toFoodRules()
+    }
+
+    if problems := planner.ValidateCatalog(foods, rules); len(problems) > 0 {
+        return nil, nil, fmt.Errorf("%w:\n  %s", errInvalidCatalog, strings.Join(problems, "\n  "))
+    }
+    return foods, rules, nil
+}
+
+// Riporta nel database il contenuto dei file del catalogo: regole e alimenti
+// dei file sostituiscono quelli con la stessa chiave, anche se ritirati, mentre
+// gli alimenti aggiunti solo nel database restano come sono
+func syncCatalogFromFiles(db *gorm.DB, source catalogSource) error {
+    foods, rules, err := loadCatalog(source)
+    if err != nil {
+        return err
+    }
+    return updateCatalog(db, func(tx *gorm.DB) error {
+        for _, mealType := range planner.SortedKeys(rules) {
+            record := mealRuleRecordFrom(mealType, rules[mealType])
+            if err := tx.Save(&record).Error; err != nil {
+                return err
+            }
+        }
+        for _, key := range planner.SortedKeys(foods) {
+            var record FoodRecord
+            err := tx.Unscoped().Where("key = ?", key).First(&record).Error
+            if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+                return err
+            }
+            record.Key = key
+            record.apply(foods[key])
+            record.DeletedAt = gorm.DeletedAt{}
+            if err := tx.Unscoped().Save(&record).Error; err != nil {
+                return err
+            }
+        }
+        return nil
+    })
+}
+
+func foodRecordFrom(key string, food planner.FoodRules) FoodRecord {
+    record := FoodRecord{Key: key}
+    record.apply(food)
+    return record
+}
+
+func (r *FoodRecord) apply(food planner.FoodRules) {
+    r.Name = food.Name
+    r.StandardPortion = food.StandardPortion
+    r.Unit = food.Unit
+    r.CaloriesPer100g = food.CaloriesPer100g
+    r.ProteinPer100g = food.ProteinPer100g
+    r.CarbsPer100g = food.CarbsPer100g
+    r.FatPer100g = food.FatPer100g
+    r.FiberPer100g = food.FiberPer100g
+    r.Category = food.Category
+    r.Description = food.Description
+    r.MealTypes = food.MealTypes
+    r.MinPortion = food.MinPortion
+    r.MaxPortion = food.MaxPortion
+    r.Required = food.Required
+    r.Frequency = food.Frequency
+    r.Allergens = food.Allergens
+    r.Diets = food.Diets
+    r.Aisle = food.Aisle
+    r.PackageSize = food.PackageSize
+    r.PackageName = food.PackageName
+}
+
+func (r FoodRecord) toFoodRules() planner.FoodRules {
+    return planner.FoodRules{
+        Name:            r.Name,
+        StandardPortion: r.StandardPortion,
+        Unit:            r.Unit,
+        CaloriesPer100g: r.CaloriesPer100g,
+        ProteinPer100g:  r.ProteinPer100g,
+        CarbsPer100g:    r.CarbsPer100g,
+        FatPer100g:      r.FatPer100g,
+        FiberPer100g:    r.FiberPer100g,
+        Category:        r.Category,
+        Description:     r.Description,
+        MealTypes:       r.MealTypes,
+        MinPortion:      r.MinPortion,
+        MaxPortion:      r.MaxPortion,
+        Required:        r.Required,
+        Frequency:       r.Frequency,
+        Allergens:       r.Allergens,
+        Diets:           r.Diets,
+        Aisle:           r.Aisle,
+        PackageSize:     r.PackageSize,
+        PackageName:     r.PackageName,
+    }
+}
+
+func mealRuleRecordFrom(mealType string, rules planner.MealRules) MealRuleRecord {
+    return MealRuleRecord{
+        MealType:           mealType,
+        RequiredCategories: rules.RequiredCategories,
+        CategoryLimits:     rules.CategoryLimits,
+        MinProtein:         rules.MinProtein,
+        MinCarbs:           rules.MinCarbs,
+        MaxFat:             rules.MaxFat,
+    }
+}
+
+func (r MealRuleRecord) toMealRules() planner.MealRules {
+    return planner.MealRules{
+        RequiredCategories: r.RequiredCategories,
+        CategoryLimits:     r.CategoryLimits,
+        MinProtein:         r.MinProtein,
+        MinCarbs:           r.MinCarbs,
+        MaxFat:             r.MaxFat,
+    }
+}
+
+// Alimento esposto dall'API del catalogo
+type FoodEntry struct {
+    Key string `json:"key"`
+    planner.FoodRules
+    Retired bool `json:"retired,omitempty"`
+}
+
+var errFoodNotFound = errors.New("food not found")
+var errFoodExists = errors.New("food already exists")
+
+func listFoods(db *gorm.DB, includeRetired bool) ([]FoodEntry, error) {
+    query := db
+    if includeRetired {
+        query = query.Unscoped()
+    }
+    var records []FoodRecord
+    if err := query.Find(&records).Error; err != nil {
+        return nil, err
+    }
+
+    entries := make([]FoodEntry, 0, len(records))
+    for _, record := range records {
+        entries = append(entries, FoodEntry{Key: record.Key, FoodRules: record.toFoodRules(), Retired: record.DeletedAt.Valid})
+    }
+    sort.Slice(entries, func(i, j int) bool { return entries[i].Key < entries[j].Key })
+    return entries, nil
+}
+
+func findFoodRecord(db *gorm.DB, key string) (FoodRecord, error) {
+    var record FoodRecord
+    err := db.Where("key = ?", key).First(&record).Error
+    if errors.Is(err, gorm.ErrRecordNotFound) {
+        return record, errFoodNotFound
+    }
+    return record, err
+}
+
+// Aggiunge l'alimento; se la chiave appartiene a un alimento ritirato, questo
+// viene ripristinato con i nuovi dati e restored è vero
+func createFood(db *gorm.DB, key string, food planner.FoodRules) (restored bool, err error) {
+    var record FoodRecord
+    err = db.Unscoped().Where("key = ?", key).First(&record).Error
+    switch {
+    case errors.Is(err, gorm.ErrRecordNotFound):
+        record = foodRecordFrom(key, food)
+        return false, db.Create(&record).Error
+    case err != nil:
+        return false, err
+    case !record.DeletedAt.Valid:
+        return false, errFoodExists
+    }
+    record.apply(food)
+    record.DeletedAt = gorm.DeletedAt{}
+    return true, db.Unscoped().Save(&record).Error
+}
+
+func updateFood(db *gorm.DB, key string, food planner.FoodRules) error {
+    record, err := findFoodRecord(db, key)
+    if err != nil {
+        return err
+    }
+    record.apply(food)
+    return db.Save(&record).Error
+}
+
+// Ritira l'alimento: resta nel database ma esce dal catalogo attivo
+func retireFood(db *gorm.DB, key string) error {
+    record, err := findFoodRecord(db, key)
+    if err != nil {
+        return err
+    }
+    return db.Delete(&record).Error
+}
+
+var foodKeyPattern = regexp.MustCompile(`^[a-z0-9_]+$`)
+
+// Controlla chiave e campi di un alimento contro le regole dei pasti attive
+func validateFoodEntry(key string, food planner.FoodRules) []string {
+    var problems []string
+    if !foodKeyPattern.MatchString(key) {
+        problems = append(problems, fmt.Sprintf("key %q must contain only lowercase letters, digits and underscores", key))
+    }
+
+    return append(problems, planner.ValidateFood(food, currentGenerator().Rules())...)
+}
+
+func foodErrorStatus(err error) int {
+    switch {
+    case errors.Is(err, errFoodNotFound):
+        return http.StatusNotFound
+    case errors.Is(err, errFoodExists):
+        return http.StatusConflict
+    case errors.Is(err, errInvalidCatalog):
+        return http.StatusUnprocessableEntity
+    default:
+        return http.StatusInternalServerError
+    }
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+    "errors"
+    "fmt"
+    "net/http"
+    "strconv"
+    "strings"
+    "time"
+
+    "github.com/denisgjonmarkaj/meal-planner/planner"
+    "gorm.io/gorm"
+)
+
+// Alimento mangiato, registrato rispetto a un piano salvato; i valori
+// nutrizionali sono quelli del catalogo al momento della registrazione
+type DiaryEntryRecord struct {
+    ID        uint         `gorm:"primaryKey"`
+    UserID    uint         `gorm:"index;not null"`
+    PlanID    uint         `gorm:"index;not null"`
+    Date      string       `gorm:"index;not null"`
+    Meal      string       `gorm:"not null"`
+    Food      planner.Food `gorm:"serializer:json"`
+    CreatedAt time.Time
+}
+
+type DiaryEntry struct {
+    ID     uint         `json:"id"`
+    PlanID uint         `json:"planId"`
+    Date   string       `json:"date"`
+    Meal   string       `json:"meal"`
+    Food   planner.Food `json:"food"`
+}
+
+type DiaryEntryRequest struct {
+    PlanID   uint    `json:"planId"`
+    Date     string  `json:"date"`
+    Meal     string  `json:"meal"`
+    Key      string  `json:"key"`
+    Quantity float64 `json:"quantity"`
+}
+
+const dateLayout = "2006-01-02"
+
+var (
+    errEntryNotFound = errors.New("diary entry not found")
+    errInvalidDate   = errors.New("invalid date")
+    errInvalidEntry  = errors.New("invalid diary entry")
+)
+
+func parseDate(name, value string) (time.Time, error) {
+    date, err := time.Parse(dateLayout, value)
+    if err != nil {
+        return date, fmt.Errorf("%w: %s must be in the form YYYY-MM-DD", errInvalidDate, name)
+    }
+    return date, nil
+}
+
+// Registra l'alimento calcolandone calorie e macronutrienti dal catalogo attivo
+func logDiaryEntry(db *gorm.DB, g *planner.Generator, userID uint, request DiaryEntryRequest) (DiaryEntryRecord, error) {
+    if _, err := parseDate("date", request.Date); err != nil {
+        return DiaryEntryRecord{}, err
+    }
+    request.Meal = strings.TrimSpace(request.Meal)
+    if request.Meal == "" {
+        return DiaryEntryRecord{}, fmt.Errorf("%w: meal is required", errInvalidEntry)
+    }
+    if request.Quantity <= 0 {
+        return DiaryEntryRecord{}, fmt.Errorf("%w: quantity must be positive", errInvalidEntry)
+    }
+    if _, err := findPlan(db, userID, strconv.FormatUint(uint64(request.PlanID), 10)); err != nil {
+        return DiaryEntryRecord{}, err
+    }
+    food, err := g.LoggedFood(request.Key, request.Quantity)
+    if err != nil {
+        return DiaryEntryRecord{}, err
+    }
+
+    record := DiaryEntryRecord{UserID: userID, PlanID: request.PlanID, Date: request.Date, Meal: request.Meal, Food: food}
+    return record, db.Create(&record).Error
+}
+
+// Registrazioni dell'utente tra from e to inclusi; planID 0 le include tutte
+func listDiaryEntries(db *gorm.DB, userID, planID uint, from, to string) ([]DiaryEntryRecord, error) {
+    query := db.Where("user_id = ? AND date >= ? AND date <= ?", userID, from, to)
+    if planID != 0 {
+        query = query.Where("plan_id = ?", planID)
+    }
+    var records []DiaryEntryRecord
+    err := query.Order("date, id").Find(&records).Error
+    return records, err
+}
+
+func deleteDiaryEntry(db *gorm.DB, userID uint, id string) error {
+    entryID, err := strconv.ParseUint(id, 10, 64)
+    if err != nil {
+        return errEntryNotFound
+    }
+    result := db.Where("id = ? AND user_id = ?", entryID, userID).Delete(&DiaryEntryRecord{})
+    if result.Error != nil {
+        return result.Error
+    }
+    if result.RowsAffected == 0 {
+        return errEntryNotFound
+    }
+    return nil
+}
+
+func diaryErrorStatus(err error) int {
+    switch {
+    case errors.Is(err, errInvalidDate), errors.Is(err, errInvalidEntry):
+        return http.StatusBadRequest
+    case errors.Is(err, errPlanNotFound), errors.Is(err, errEntryNotFound), errors.Is(err, planner.ErrFoodNotFound):
+        return http.StatusNotFound
+    default:
+        return http.StatusInternalServerError
+    }
+}
+
+func (r DiaryEntryRecord) entry() DiaryEntry {
+    return DiaryEntry{ID: r.ID, PlanID: r.PlanID, Date: r.Date, Meal: r.Meal, Food: r.Food}
+}
+
+// Aderenza al piano salvato per i days giorni a partire da from
+func planAdherence(db *gorm.DB, g *planner.Generator, userID uint, planID string, from time.Time, days int) ([]planner.DayAdherence, error) {
+    plan, err := findPlan(db, userID, planID)
+    if err != nil {
+        return nil, err
+    }
+    to := from.AddDate(0, 0, days-1)
+    records, err := listDiaryEntries(db, userID, plan.ID, from.Format(dateLayout), to.Format(dateLayout))
+    if err != nil {
+        return nil, err
+    }
+
+    eaten := make(map[string]map[string][]planner.Food)
+    for _, record := range records {
+        if eaten[record.Date] == nil {
+            eaten[record.Date] = make(map[string][]planner.Food)
+        }
+        eaten[record.Date][record.Meal] = append(eaten[record.Date][record.Meal], record.Food)
+    }
+
+    adherence := make([]planner.DayAdherence, 0, days)
+    for day := 0; day < days; day++ {
+        date := from.AddDate(0, 0, day).Format(dateLayout)
+        adherence = append(adherence, g.DayAdherence(plan.Plan, date, eaten[date]))
+    }
+    return adherence, nil
+}
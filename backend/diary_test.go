@@ -0,0 +1,130 @@
+package main
+
+import (
+    "errors"
+    "math"
+    "net/http"
+    "reflect"
+    "strconv"
+    "testing"
+    "github.com/denisgjonmarkaj/meal-planner/planner"
+)
+
+func TestDiary(t *testing.T) {
+    db := testDB(t)
+    if err := refreshCatalogFromDB(db); err != nil {
+        t.Fatal(err)
+    }
+    g := currentGenerator()
+    seed := int64(4)
+    plan, err := g.GeneratePlan(planner.PlanRequest{TargetCalories: 2000, Seed: &seed})
+    if err != nil {
+        t.Fatal(err)
+    }
+    saved, err := savePlan(db, 1, "Piano", plan)
+    if err != nil {
+        t.Fatal(err)
+    }
+    planID := strconv.FormatUint(uint64(saved.ID), 10)
+
+    // Colazione come da piano, pranzo con le patate al posto del carboidrato,
+    // gli altri pasti saltati
+    var eatenCalories float64
+    for _, slot := range plan.Slots[:3] {
+        if slot.Name == "spuntino" {
+            continue
+        }
+        for _, item := range slot.Items {
+            key, quantity := item.Key, item.Quantity
+            if rule, _ := g.Catalog().Food(key); slot.Name == "pranzo" && rule.Category == "carb" {
+                key, quantity = "patate", 250
+            }
+            record, err := logDiaryEntry(db, g, 1, DiaryEntryRequest{PlanID: saved.ID, Date: "2026-10-05", Meal: slot.Name, Key: key, Quantity: quantity})
+            if err != nil {
+                t.Fatalf("%s, %s: %v", slot.Name, key, err)
+            }
+            eatenCalories += record.Food.Calories
+        }
+    }
+
+    t.Run("invalid entries", func(t *testing.T) {
+        tests := []struct {
+            name    string
+            request DiaryEntryRequest
+            want    int
+        }{
+            {name: "invalid date", request: DiaryEntryRequest{PlanID: saved.ID, Date: "05/10/2026", Meal: "cena", Key: "merluzzo", Quantity: 200}, want: http.StatusBadRequest},
+            {name: "missing meal", request: DiaryEntryRequest{PlanID: saved.ID, Date: "2026-10-05", Meal: " ", Key: "merluzzo", Quantity: 200}, want: http.StatusBadRequest},
+            {name: "zero quantity", request: DiaryEntryRequest{PlanID: saved.ID, Date: "2026-10-05", Meal: "cena", Key: "merluzzo"}, want: http.StatusBadRequest},
+            {name: "unknown food", request: DiaryEntryRequest{PlanID: saved.ID, Date: "2026-10-05", Meal: "cena", Key: "pizza", Quantity: 200}, want: http.StatusNotFound},
+            {name: "plan of another user", request: DiaryEntryRequest{PlanID: saved.ID + 1, Date: "2026-10-05", Meal: "cena", Key: "merluzzo", Quantity: 200}, want: http.StatusNotFound},
+        }
+        for _, tt := range tests {
+            if _, err := logDiaryEntry(db, g, 1, tt.request); diaryErrorStatus(err) != tt.want {
+                t.Errorf("%s: got %v (status %d), want status %d", tt.name, err, diaryErrorStatus(err), tt.want)
+            }
+        }
+        if _, err := logDiaryEntry(db, g, 2, DiaryEntryRequest{PlanID: saved.ID, Date: "2026-10-05", Meal: "cena", Key: "merluzzo", Quantity: 200}); !errors.Is(err, errPlanNotFound) {
+            t.Errorf("entry on another user's plan: got %v, want %v", err, errPlanNotFound)
+        }
+    })
+
+    t.Run("adherence", func(t *testing.T) {
+        from, _ := parseDate("from", "2026-10-04")
+        days, err := planAdherence(db, g, 1, planID, from, 7)
+        if err != nil {
+            t.Fatal(err)
+        }
+        if len(days) != 7 || days[0].Logged || !days[1].Logged || days[1].Date != "2026-10-05" {
+            t.Fatalf("unexpected days %+v", days)
+        }
+        day := days[1]
+        if want := []string{"spuntino", "merenda", "cena"}; !reflect.DeepEqual(day.SkippedMeals, want) {
+            t.Errorf("skipped %v, want %v", day.SkippedMeals, want)
+        }
+        if day.Substitutions != 1 {
+            t.Errorf("%d substitutions, want 1", day.Substitutions)
+        }
+        week := planner.WeekAdherenceOf(days[0].Date, days[6].Date, days)
+        if week.LoggedDays != 1 {
+            t.Errorf("%d logged days, want 1", week.LoggedDays)
+        }
+        if _, err := planAdherence(db, g, 2, planID, from, 1); !errors.Is(err, errPlanNotFound) {
+            t.Errorf("adherence of another user's plan: got %v, want %v", err, errPlanNotFound)
+        }
+        // Le calorie dei singoli alimenti sono arrotondate
+        if math.Abs(day.Eaten.Calories-eatenCalories) > 5 {
+            t.Errorf("eaten %g kcal, logged %g", day.Eaten.Calories, eatenCalories)
+        }
+    })
+
+    t.Run("list and delete", func(t *testing.T) {
+        all, err := listDiaryEntries(db, 1, 0, "2026-10-01", "2026-10-31")
+        if err != nil {
+            t.Fatal(err)
+        }
+        if len(all) == 0 {
+            t.Fatal("no entries")
+        }
+        if other, _ := listDiaryEntries(db, 2, 0, "2026-10-01", "2026-10-31"); len(other) != 0 {
+            t.Errorf("another user sees %d entries", len(other))
+        }
+        if later, _ := listDiaryEntries(db, 1, saved.ID, "2026-10-06", "2026-10-31"); len(later) != 0 {
+            t.Errorf("%d entries after the logged day", len(later))
+        }
+
+        id := strconv.FormatUint(uint64(all[0].ID), 10)
+        if err := deleteDiaryEntry(db, 2, id); !errors.Is(err, errEntryNotFound) {
+            t.Errorf("delete by another user: got %v, want %v", err, errEntryNotFound)
+        }
+        if err := deleteDiaryEntry(db, 1, id); err != nil {
+            t.Fatal(err)
+        }
+        if err := deleteDiaryEntry(db, 1, id); !errors.Is(err, errEntryNotFound) {
+            t.Errorf("second delete: got %v, want %v", err, errEntryNotFound)
+        }
+        if err := deleteDiaryEntry(db, 1, "abc"); !errors.Is(err, errEntryNotFound) {
+            t.Errorf("invalid id: got %v, want %v", err, errEntryNotFound)
+        }
+    })
+}
@@ -0,0 +1,301 @@
+package main
+
+import (
+    "bytes"
+    "encoding/csv"
+    "fmt"
+    "io"
+    "net/http"
+    "strconv"
+    "strings"
+    "time"
+
+    "github.com/denisgjonmarkaj/meal-planner/planner"
+    "github.com/gin-gonic/gin"
+)
+
+// Formati di esportazione dei piani, scelti con ?format= oppure con l'header Accept
+const (
+    formatJSON     = "json"
+    formatCSV      = "csv"
+    formatMarkdown = "markdown"
+    formatICS      = "ics"
+)
+
+var exportContentTypes = map[string]string{
+    formatJSON:     "application/json",
+    formatCSV:      "text/csv",
+    formatMarkdown: "text/markdown",
+    formatICS:      "text/calendar",
+}
+
+// Orari predefiniti dei pasti nel calendario; gli altri slot vanno indicati con mealTimes
+var defaultMealTimes = map[string]string{
+    "colazione": "07:30",
+    "spuntino":  "10:30",
+    "pranzo":    "13:00",
+    "merenda":   "16:30",
+    "cena":      "20:00",
+}
+
+const (
+    defaultEventMinutes = 30
+    // Lunghezza massima di una riga iCalendar, in byte, prima di andare a capo
+    icsLineLength       = 75
+)
+
+// Nomi dei giorni del piano settimanale come vanno mostrati
+var dayNames = map[string]string{
+    "lunedi":    "Lunedì",
+    "martedi":   "Martedì",
+    "mercoledi": "Mercoledì",
+    "giovedi":   "Giovedì",
+    "venerdi":   "Venerdì",
+    "sabato":    "Sabato",
+    "domenica":  "Domenica",
+}
+
+var dayWeekdays = map[string]time.Weekday{
+    "lunedi":    time.Monday,
+    "martedi":   time.Tuesday,
+    "mercoledi": time.Wednesday,
+    "giovedi":   time.Thursday,
+    "venerdi":   time.Friday,
+    "sabato":    time.Saturday,
+    "domenica":  time.Sunday,
+}
+
+// Giorno di un piano da esportare; Day e Name sono vuoti per un piano giornaliero
+type planDay struct {
+    Day  string
+    Name string
+    Plan planner.MealPlan
+}
+
+func dailyPlan(plan planner.MealPlan) []planDay {
+    return []planDay{{Plan: plan}}
+}
+
+func weeklyPlanDays(week planner.WeeklyPlan) []planDay {
+    days := make([]planDay, 0, len(week.Days))
+    for _, day := range week.Days {
+        name, known := dayNames[day.Day]
+        if !known {
+            name = strings.Title(day.Day)
+        }
+        days = append(days, planDay{Day: day.Day, Name: name, Plan: day.MealPlan})
+    }
+    return days
+}
+
+// Parametri del calendario: primo giorno, orario di ogni pasto e durata degli eventi
+type calendarOptions struct {
+    Start     time.Time
+    MealTimes map[string]time.Duration
+    Duration  time.Duration
+}
+
+type exportOptions struct {
+    Format   string
+    Calendar calendarOptions
+}
+
+// Legge formato e parametri del calendario dalla richiesta, prima di generare il piano:
+// ?format=json|csv|markdown|ics, altrimenti l'header Accept; per ics anche
+// ?date=YYYY-MM-DD, ?mealTimes=colazione=07:00,cena=19:30 e ?duration= in minuti
+func parseExportOptions(c *gin.Context) (exportOptions, error) {
+    options := exportOptions{Format: c.Query("format")}
+    if options.Format == "" {
+        negotiated := c.NegotiateFormat(exportContentTypes[formatJSON], exportContentTypes[formatCSV], exportContentTypes[formatMarkdown], exportContentTypes[formatICS])
+        options.Format = formatJSON
+        for format, contentType := range exportContentTypes {
+            if contentType == negotiated {
+                options.Format = format
+            }
+        }
+    }
+    if _, known := exportContentTypes[options.Format]; !known {
+        return options, fmt.Errorf("unknown format %q, expected json, csv, markdown or ics", options.Format)
+    }
+    if options.Format != formatICS {
+        return options, nil
+    }
+
+    start, err := parseDate("date", c.DefaultQuery("date", time.Now().Format(dateLayout)))
+    if err != nil {
+        return options, err
+    }
+    minutes, err := strconv.Atoi(c.DefaultQuery("duration", strconv.Itoa(defaultEventMinutes)))
+    if err != nil || minutes <= 0 || minutes > 24*60 {
+        return options, fmt.Errorf("duration must be a number of minutes between 1 and %d", 24*60)
+    }
+    options.Calendar = calendarOptions{Start: start, MealTimes: make(map[string]time.Duration), Duration: time.Duration(minutes) * time.Minute}
+
+    times := make(map[string]string)
+    for meal, clock := range defaultMealTimes {
+        times[meal] = clock
+    }
+    for _, entry := range splitList(c.Query("mealTimes")) {
+        meal, clock, found := strings.Cut(entry, "=")
+        if !found {
+            return options, fmt.Errorf("mealTimes entry %q must be in the form meal=HH:MM", entry)
+        }
+        times[strings.TrimSpace(meal)] = strings.TrimSpace(clock)
+    }
+    for meal, clock := range times {
+        parsed, err := time.Parse("15:04", clock)
+        if err != nil {
+            return options, fmt.Errorf("time %q for meal %q must be in the form HH:MM", clock, meal)
+        }
+        options.Calendar.MealTimes[meal] = time.Duration(parsed.Hour())*time.Hour + time.Duration(parsed.Minute())*time.Minute
+    }
+    return options, nil
+}
+
+// Risponde nel formato richiesto: value in JSON, altrimenti i giorni del piano
+func sendPlanExport(c *gin.Context, g *planner.Generator, options exportOptions, value interface{}, days []planDay, title string) {
+    if options.Format == formatJSON {
+        c.JSON(http.StatusOK, value)
+        return
+    }
+
+    var buffer bytes.Buffer
+    var err error
+    extension := options.Format
+    switch options.Format {
+    case formatCSV:
+        err = writePlanCSV(&buffer, days)
+    case formatMarkdown:
+        extension = "md"
+        err = writeDaysMarkdown(&buffer, title, days)
+    case formatICS:
+        err = writePlanICS(&buffer, g, days, options.Calendar, time.Now())
+    }
+    if err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+        return
+    }
+    c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", "piano."+extension))
+    c.Data(http.StatusOK, exportContentTypes[options.Format]+"; charset=utf-8", buffer.Bytes())
+}
+
+// Una riga per alimento; la colonna day è vuota per un piano giornaliero
+func writePlanCSV(out io.Writer, days []planDay) error {
+    w := csv.NewWriter(out)
+    w.Write([]string{"day", "meal", "key", "name", "quantity", "unit", "calories", "protein", "carbs", "fat", "fiber"})
+    number := func(value float64) string {
+        return strconv.FormatFloat(value, 'f', -1, 64)
+    }
+    for _, day := range days {
+        for _, slot := range day.Plan.SlotMeals() {
+            for _, item := range slot.Items {
+                w.Write([]string{day.Name, slot.Name, item.Key, item.Name, number(item.Quantity), item.Unit,
+                    number(item.Calories), number(item.Protein), number(item.Carbs), number(item.Fat), number(item.Fiber)})
+            }
+        }
+    }
+    w.Flush()
+    return w.Error()
+}
+
+func writeDaysMarkdown(out io.Writer, title string, days []planDay) error {
+    for i, day := range days {
+        if i > 0 {
+            fmt.Fprintln(out)
+        }
+        heading := title
+        if day.Name != "" {
+            heading = day.Name
+        }
+        plan := day.Plan
+        plan.Slots = plan.SlotMeals()
+        if err := writePlanMarkdown(out, heading, plan); err != nil {
+            return err
+        }
+    }
+    return nil
+}
+
+// Un evento per pasto, a partire da options.Start per i giorni successivi; nei
+// piani settimanali ogni data riceve il giorno con lo stesso giorno della settimana.
+// Gli orari sono in ora locale, senza fuso, e restano quelli indicati ovunque
+func writePlanICS(out io.Writer, g *planner.Generator, days []planDay, options calendarOptions, now time.Time) error {
+    var b strings.Builder
+    line := func(format string, args ...interface{}) {
+        b.WriteString(foldICSLine(fmt.Sprintf(format, args...)))
+    }
+    line("BEGIN:VCALENDAR")
+    line("VERSION:2.0")
+    line("PRODID:-//meal-planner//Piano alimentare//IT")
+    line("CALSCALE:GREGORIAN")
+
+    stamp := now.UTC().Format("20060102T150405Z")
+    for i := range days {
+        date := options.Start.AddDate(0, 0, i)
+        day := calendarDay(days, i, date.Weekday())
+        for _, slot := range day.Plan.SlotMeals() {
+            offset, known := options.MealTimes[slot.Name]
+            if !known {
+                return fmt.Errorf("no time for meal %q: add it to mealTimes, for example %s=12:00", slot.Name, slot.Name)
+            }
+            // Ore e minuti vanno impostati sulla data, non sommati: nei giorni del
+            // cambio dell'ora una somma sposterebbe il pasto di un'ora
+            start := time.Date(date.Year(), date.Month(), date.Day(), int(offset/time.Hour), int(offset%time.Hour/time.Minute), 0, 0, date.Location())
+
+            var description []string
+            for _, item := range slot.Items {
+                text := fmt.Sprintf("%s %g %s", item.Name, item.Quantity, item.Unit)
+                if hint := g.PortionHint(item); hint != "" {
+                    text += " (" + hint + ")"
+                }
+                description = append(description, text)
+            }
+            description = append(description, fmt.Sprintf("Totale: %.0f kcal", slot.Calories))
+
+            line("BEGIN:VEVENT")
+            line("UID:%s-%s@meal-planner", date.Format("20060102"), slot.Name)
+            line("DTSTAMP:%s", stamp)
+            line("DTSTART:%s", start.Format("20060102T150405"))
+            line("DTEND:%s", start.Add(options.Duration).Format("20060102T150405"))
+            line("SUMMARY:%s", escapeICSText(fmt.Sprintf("%s (%.0f kcal)", strings.Title(slot.Name), slot.Calories)))
+            line("DESCRIPTION:%s", escapeICSText(strings.Join(description, "\n")))
+            line("END:VEVENT")
+        }
+    }
+    line("END:VCALENDAR")
+    _, err := io.WriteString(out, b.String())
+    return err
+}
+
+// Giorno del piano da mettere in calendario in una data: quello con lo stesso
+// giorno della settimana, altrimenti quello nella stessa posizione
+func calendarDay(days []planDay, index int, weekday time.Weekday) planDay {
+    for _, day := range days {
+        if planned, known := dayWeekdays[day.Day]; known && planned == weekday {
+            return day
+        }
+    }
+    return days[index]
+}
+
+func escapeICSText(text string) string {
+    return strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\n", `\n`).Replace(text)
+}
+
+// Spezza le righe oltre icsLineLength byte senza dividere i caratteri UTF-8;
+// le continuazioni iniziano con uno spazio, come richiede RFC 5545
+func foldICSLine(line string) string {
+    var b strings.Builder
+    width := 0
+    for _, r := range line {
+        size := len(string(r))
+        if width+size > icsLineLength {
+            b.WriteString("\r\n ")
+            width = 1
+        }
+        b.WriteRune(r)
+        width += size
+    }
+    b.WriteString("\r\n")
+    return b.String()
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+    "bytes"
+    "encoding/csv"
+    "net/http"
+    "net/http/httptest"
+    "strings"
+    "testing"
+    "time"
+    "github.com/denisgjonmarkaj/meal-planner/planner"
+    "github.com/gin-gonic/gin"
+)
+
+func TestParseExportOptions(t *testing.T) {
+    gin.SetMode(gin.TestMode)
+    tests := []struct {
+        name     string
+        query    string
+        accept   string
+        format   string
+        // Orario della cena e durata attesi per ics
+        dinner   time.Duration
+        duration time.Duration
+        wantErr  bool
+    }{
+        {name: "default", format: formatJSON},
+        {name: "query", query: "format=csv", format: formatCSV},
+        {name: "accept header", accept: "text/markdown", format: formatMarkdown},
+        {name: "query wins over accept", query: "format=json", accept: "text/csv", format: formatJSON},
+        {name: "calendar defaults", query: "format=ics&date=2026-10-05", format: formatICS, dinner: 20 * time.Hour, duration: 30 * time.Minute},
+        {name: "calendar times", query: "format=ics&date=2026-10-05&mealTimes=cena=19:15&duration=45", format: formatICS, dinner: 19*time.Hour + 15*time.Minute, duration: 45 * time.Minute},
+        {name: "unknown format", query: "format=xml", wantErr: true},
+        {name: "invalid date", query: "format=ics&date=05-10-2026", wantErr: true},
+        {name: "invalid duration", query: "format=ics&duration=0", wantErr: true},
+        {name: "invalid meal time", query: "format=ics&mealTimes=cena=25:00", wantErr: true},
+        {name: "meal time without equals sign", query: "format=ics&mealTimes=cena", wantErr: true},
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            c, _ := gin.CreateTestContext(httptest.NewRecorder())
+            c.Request = httptest.NewRequest(http.MethodGet, "/api/generate-plan?"+tt.query, nil)
+            if tt.accept != "" {
+                c.Request.Header.Set("Accept", tt.accept)
+            }
+            options, err := parseExportOptions(c)
+            if tt.wantErr {
+                if err == nil {
+                    t.Fatal("expected an error")
+                }
+                return
+            }
+            if err != nil {
+                t.Fatal(err)
+            }
+            if options.Format != tt.format {
+                t.Errorf("format %q, want %q", options.Format, tt.format)
+            }
+            if tt.format == formatICS && (options.Calendar.MealTimes["cena"] != tt.dinner || options.Calendar.Duration != tt.duration) {
+                t.Errorf("dinner at %v for %v, want %v for %v", options.Calendar.MealTimes["cena"], options.Calendar.Duration, tt.dinner, tt.duration)
+            }
+        })
+    }
+}
+
+func TestWritePlanCSV(t *testing.T) {
+    g := testGenerator(t)
+    seed := int64(9)
+    week, err := g.GenerateWeeklyPlan(planner.PlanRequest{TargetCalories: 2000, Seed: &seed})
+    if err != nil {
+        t.Fatal(err)
+    }
+    items := 0
+    for _, day := range week.Days {
+        for _, slot := range day.Slots {
+            items += len(slot.Items)
+        }
+    }
+
+    var out bytes.Buffer
+    if err := writePlanCSV(&out, weeklyPlanDays(week)); err != nil {
+        t.Fatal(err)
+    }
+    rows, err := csv.NewReader(&out).ReadAll()
+    if err != nil {
+        t.Fatal(err)
+    }
+    if len(rows) != items+1 {
+        t.Fatalf("%d rows, want a header and %d items", len(rows), items)
+    }
+    if rows[0][0] != "day" || rows[1][0] != "Lunedì" || rows[len(rows)-1][0] != "Domenica" {
+        t.Errorf("unexpected days: %v, %v", rows[1], rows[len(rows)-1])
+    }
+}
+
+func TestWritePlanICS(t *testing.T) {
+    g := testGenerator(t)
+    seed := int64(9)
+    week, err := g.GenerateWeeklyPlan(planner.PlanRequest{TargetCalories: 2000, Seed: &seed})
+    if err != nil {
+        t.Fatal(err)
+    }
+    rome, err := time.LoadLocation("Europe/Rome")
+    if err != nil {
+        t.Skip("time zone database not available")
+    }
+    mealTimes := make(map[string]time.Duration)
+    for meal := range defaultMealTimes {
+        mealTimes[meal] = 12 * time.Hour
+    }
+    mealTimes["cena"] = 20*time.Hour + 30*time.Minute
+    // Venerdì 27 marzo 2026: la domenica successiva cambia l'ora legale
+    options := calendarOptions{Start: time.Date(2026, time.March, 27, 0, 0, 0, 0, rome), MealTimes: mealTimes, Duration: 30 * time.Minute}
+
+    var out bytes.Buffer
+    if err := writePlanICS(&out, g, weeklyPlanDays(week), options, time.Date(2026, time.March, 1, 9, 0, 0, 0, time.UTC)); err != nil {
+        t.Fatal(err)
+    }
+    ics := out.String()
+    for _, want := range []string{
+        "BEGIN:VCALENDAR\r\n",
+        "DTSTAMP:20260301T090000Z\r\n",
+        // La cena resta alle 20:30 anche il giorno del cambio dell'ora
+        "UID:20260329-cena@meal-planner\r\nDTSTAMP:20260301T090000Z\r\nDTSTART:20260329T203000\r\nDTEND:20260329T210000\r\n",
+        "END:VCALENDAR\r\n",
+    } {
+        if !strings.Contains(ics, want) {
+            t.Errorf("calendar without %q", want)
+        }
+    }
+    if events := strings.Count(ics, "BEGIN:VEVENT"); events != 7*len(week.Days[0].Slots) {
+        t.Errorf("%d events, want %d", events, 7*len(week.Days[0].Slots))
+    }
+    for _, line := range strings.Split(ics, "\r\n") {
+        if len(line) > icsLineLength {
+            t.Errorf("line of %d bytes: %q", len(line), line)
+        }
+    }
+
+    // Il venerdì del calendario riceve il venerdì del piano
+    friday := calendarDay(weeklyPlanDays(week), 0, time.Friday)
+    if friday.Day != "venerdi" {
+        t.Errorf("friday gets %s", friday.Day)
+    }
+
+    delete(options.MealTimes, "merenda")
+    if err := writePlanICS(&out, g, weeklyPlanDays(week), options, time.Now()); err == nil {
+        t.Error("expected an error for a meal without a time")
+    }
+}
+
+func TestFoldICSLine(t *testing.T) {
+    tests := []struct {
+        line string
+        want string
+    }{
+        {line: "SUMMARY:Cena", want: "SUMMARY:Cena\r\n"},
+        {line: strings.Repeat("a", 80), want: strings.Repeat("a", 75) + "\r\n " + strings.Repeat("a", 5) + "\r\n"},
+        // Le lettere accentate occupano due byte e non vanno spezzate
+        {line: strings.Repeat("a", 74) + "èè", want: strings.Repeat("a", 74) + "\r\n èè\r\n"},
+    }
+    for _, tt := range tests {
+        if got := foldICSLine(tt.line); got != tt.want {
+            t.Errorf("foldICSLine(%q) = %q, want %q", tt.line, got, tt.want)
+        }
+    }
+    if got := escapeICSText("Pane, olio; sale\\pepe\nfine"); got != `Pane\, olio\; sale\\pepe\nfine` {
+        t.Errorf("escapeICSText = %q", got)
+    }
+}
@@ -0,0 +1,518 @@
+package main
+
+import (
+    "bufio"
+    "bytes"
+    "encoding/csv"
+    "errors"
+    "fmt"
+    "io"
+    "math"
+    "regexp"
+    "strconv"
+    "strings"
+
+    "github.com/denisgjonmarkaj/meal-planner/planner"
+    "gorm.io/gorm"
+)
+
+// Importazione di alimenti da un CSV esportato da una banca dati nutrizionale
+// (USDA FoodData Central, tabelle CREA): una riga per alimento, valori per 100 g.
+// Gli alimenti già presenti ricevono solo i valori nutrizionali; porzioni, tipi
+// di pasto e gli altri campi curati a mano non vengono toccati. Una riga che
+// sembra un alimento già presente con un altro nome non viene importata
+// finché Keys non indica a quale chiave corrisponde
+type FoodImportOptions struct {
+    // Colonna del CSV da usare per un campo, se il nome non viene riconosciuto
+    Columns   map[string]string `json:"columns"`
+    // Chiave del catalogo per un nome del CSV: una chiave esistente unisce la
+    // riga a quell'alimento, una nuova crea comunque l'alimento
+    Keys      map[string]string `json:"keys"`
+    // Categoria e tipi di pasto dei nuovi alimenti, se il CSV non li indica
+    Category  string            `json:"category"`
+    MealTypes []string          `json:"mealTypes"`
+    // Calcola il resoconto senza modificare il catalogo
+    DryRun    bool              `json:"dryRun"`
+}
+
+type ImportedFood struct {
+    Key    string   `json:"key"`
+    Name   string   `json:"name"`
+    Action string   `json:"action"`
+    // Campi modificati di un alimento esistente
+    Fields []string `json:"fields,omitempty"`
+}
+
+// Riga del CSV non importata; Row conta anche l'intestazione, come un foglio di calcolo
+type SkippedRow struct {
+    Row    int    `json:"row"`
+    Name   string `json:"name,omitempty"`
+    Reason string `json:"reason"`
+    // Chiave dell'alimento esistente di cui la riga sembra un duplicato
+    Match  string `json:"match,omitempty"`
+}
+
+type FoodImportReport struct {
+    // Colonna del CSV usata per ogni campo
+    Columns   map[string]string `json:"columns"`
+    Rows      int               `json:"rows"`
+    Created   int               `json:"created"`
+    Updated   int               `json:"updated"`
+    Unchanged int               `json:"unchanged"`
+    Foods     []ImportedFood    `json:"foods"`
+    Skipped   []SkippedRow      `json:"skipped"`
+    DryRun    bool              `json:"dryRun"`
+}
+
+const (
+    importCreated   = "created"
+    importUpdated   = "updated"
+    importUnchanged = "unchanged"
+)
+
+// Porzioni dei nuovi alimenti, da rivedere a mano dopo l'importazione
+const (
+    importStandardPortion = 100
+    importMinPortion      = 50
+    importMaxPortion      = 200
+    // Tolleranza sulla somma dei macronutrienti per 100 g, per gli arrotondamenti
+    maxMacrosPer100g      = 102
+)
+
+// Campi importabili e nomi di colonna riconosciuti, già normalizzati
+var importColumnAliases = map[string][]string{
+    "key":       {"key", "chiave"},
+    "name":      {"name", "description", "food", "nome", "alimento", "nome alimento", "descrizione"},
+    "calories":  {"calories", "calorie", "kcal", "energy (kcal)", "energy kcal", "energy, kcal", "energia (kcal)", "energia kcal", "energia, kcal", "caloriesper100g"},
+    "protein":   {"protein", "protein (g)", "proteine", "proteine (g)", "proteine totali", "proteine totali (g)", "proteinper100g"},
+    "carbs":     {"carbs", "carbohydrate", "carbohydrate (g)", "carbohydrate, by difference", "carbohydrate, by difference (g)", "carboidrati", "carboidrati (g)", "carboidrati disponibili", "carboidrati disponibili (g)", "carbsper100g"},
+    "fat":       {"fat", "fat (g)", "total lipid (fat)", "total lipid (fat) (g)", "lipidi", "lipidi (g)", "lipidi totali", "lipidi totali (g)", "grassi", "grassi (g)", "fatper100g"},
+    "fiber":     {"fiber", "fiber (g)", "fiber, total dietary", "fiber, total dietary (g)", "fibra", "fibra (g)", "fibra alimentare", "fibra alimentare (g)", "fibra alimentare totale", "fibra alimentare totale (g)", "fiberper100g"},
+    "category":  {"category", "categoria"},
+    "mealTypes": {"mealtypes", "meal types", "pasti"},
+}
+
+// Ordine dei campi nei messaggi
+var importFields = []string{"key", "name", "calories", "protein", "carbs", "fat", "fiber", "category", "mealTypes"}
+
+var requiredImportFields = []string{"name", "calories", "protein", "carbs", "fat"}
+
+var (
+    errInvalidImport = errors.New("invalid import")
+    nonKeyCharacters = regexp.MustCompile(`[^a-z0-9]+`)
+    accentReplacer   = strings.NewReplacer("à", "a", "á", "a", "è", "e", "é", "e", "ì", "i", "í", "i", "ò", "o", "ó", "o", "ù", "u", "ú", "u")
+)
+
+// Parole ignorate nel confronto dei nomi: "Pollo, petto" e "Petto di pollo" coincidono
+var nameStopwords = map[string]bool{
+    "di": true, "del": true, "della": true, "dei": true, "al": true, "alla": true,
+    "e": true, "o": true, "con": true, "in": true, "of": true, "and": true, "or": true, "with": true,
+}
+
+// Riga del CSV convertita; Fiber è nil se il valore manca
+type importRow struct {
+    Key       string
+    Name      string
+    Calories  float64
+    Protein   float64
+    Carbs     float64
+    Fat       float64
+    Fiber     *float64
+    Category  string
+    MealTypes []string
+}
+
+// Legge il CSV, lo confronta con il catalogo del database e applica le
+// modifiche in un'unica transazione; le righe non valide finiscono nel resoconto
+func importFoods(db *gorm.DB, input io.Reader, options FoodImportOptions) (FoodImportReport, error) {
+    report := FoodImportReport{DryRun: options.DryRun, Foods: []ImportedFood{}, Skipped: []SkippedRow{}}
+    reader, err := newImportReader(input)
+    if err != nil {
+        return report, err
+    }
+    header, err := reader.Read()
+    if err == io.EOF {
+        return report, fmt.Errorf("%w: the file is empty", errInvalidImport)
+    }
+    if err != nil {
+        return report, fmt.Errorf("%w: %v", errInvalidImport, err)
+    }
+    columns, err := mapImportColumns(header, options.Columns)
+    if err != nil {
+        return report, err
+    }
+    report.Columns = make(map[string]string, len(columns))
+    for field, index := range columns {
+        report.Columns[field] = strings.TrimSpace(header[index])
+    }
+
+    var records []FoodRecord
+    if err := db.Unscoped().Find(&records).Error; err != nil {
+        return report, err
+    }
+    byKey := make(map[string]*FoodRecord, len(records))
+    byName := make(map[string]*FoodRecord, len(records))
+    tokens := make([]map[string]bool, len(records))
+    for i := range records {
+        byKey[records[i].Key] = &records[i]
+        byName[strings.ToLower(records[i].Name)] = &records[i]
+        tokens[i] = nameTokens(records[i].Name)
+    }
+    keys := make(map[string]string, len(options.Keys))
+    for name, key := range options.Keys {
+        keys[strings.ToLower(strings.TrimSpace(name))] = key
+    }
+
+    var created, updated []FoodRecord
+    seen := make(map[string]int)
+    for line := 2; ; line++ {
+        fields, err := reader.Read()
+        if err == io.EOF {
+            break
+        }
+        report.Rows++
+        if err != nil {
+            report.Skipped = append(report.Skipped, SkippedRow{Row: line, Reason: err.Error()})
+            continue
+        }
+        row, err := parseImportRow(fields, columns)
+        if err != nil {
+            report.Skipped = append(report.Skipped, SkippedRow{Row: line, Name: row.Name, Reason: err.Error()})
+            continue
+        }
+
+        mapped, explicit := keys[strings.ToLower(row.Name)]
+        if explicit {
+            row.Key = mapped
+        }
+        existing := byKey[row.Key]
+        if existing == nil && !explicit {
+            existing = byName[strings.ToLower(row.Name)]
+        }
+        if existing == nil && !explicit {
+            if match := likelyDuplicate(row.Name, records, tokens); match != nil {
+                report.Skipped = append(report.Skipped, SkippedRow{Row: line, Name: row.Name, Match: match.Key,
+                    Reason: fmt.Sprintf("may be the same food as %q (%s): map the name to %s to merge it, or to a new key to create it", match.Key, match.Name, match.Key)})
+                continue
+            }
+        }
+        if existing != nil {
+            row.Key = existing.Key
+        }
+        if previous, duplicate := seen[row.Key]; duplicate {
+            report.Skipped = append(report.Skipped, SkippedRow{Row: line, Name: row.Name, Reason: fmt.Sprintf("same food as row %d", previous)})
+            continue
+        }
+
+        if existing == nil {
+            food := newImportedFood(row, options)
+            if problems := validateFoodEntry(row.Key, food); len(problems) > 0 {
+                report.Skipped = append(report.Skipped, SkippedRow{Row: line, Name: row.Name, Reason: "new food: " + strings.Join(problems, "; ")})
+                continue
+            }
+            seen[row.Key] = line
+            created = append(created, foodRecordFrom(row.Key, food))
+            report.Created++
+            report.Foods = append(report.Foods, ImportedFood{Key: row.Key, Name: food.Name, Action: importCreated})
+            continue
+        }
+        if existing.DeletedAt.Valid {
+            report.Skipped = append(report.Skipped, SkippedRow{Row: line, Name: row.Name, Reason: fmt.Sprintf("food %q is retired", existing.Key)})
+            continue
+        }
+        seen[row.Key] = line
+
+        changed := applyImportedNutrients(existing, row)
+        if len(changed) == 0 {
+            report.Unchanged++
+            report.Foods = append(report.Foods, ImportedFood{Key: existing.Key, Name: existing.Name, Action: importUnchanged})
+            continue
+        }
+        updated = append(updated, *existing)
+        report.Updated++
+        report.Foods = append(report.Foods, ImportedFood{Key: existing.Key, Name: existing.Name, Action: importUpdated, Fields: changed})
+    }
+
+    if options.DryRun || len(created)+len(updated) == 0 {
+        return report, nil
+    }
+    // Il catalogo aggiornato viene validato prima di diventare attivo
+    err = updateCatalog(db, func(tx *gorm.DB) error {
+        for i := range created {
+            if err := tx.Create(&created[i]).Error; err != nil {
+                return err
+            }
+        }
+        for i := range updated {
+            if err := tx.Save(&updated[i]).Error; err != nil {
+                return err
+            }
+        }
+        return nil
+    })
+    return report, err
+}
+
+// Coppie campo=colonna, ad esempio "calories=Energia (kcal)"
+func parseColumnMappings(pairs []string) (map[string]string, error) {
+    columns := make(map[string]string, len(pairs))
+    for _, pair := range pairs {
+        field, column, found := strings.Cut(pair, "=")
+        if !found {
+            return nil, fmt.Errorf("%w: column mapping %q must be in the form field=column", errInvalidImport, pair)
+        }
+        columns[strings.TrimSpace(field)] = strings.TrimSpace(column)
+    }
+    return columns, nil
+}
+
+// Coppie nome=chiave, ad esempio "Pollo, petto=petto_pollo"; il nome può
+// contenere virgole, quindi conta l'ultimo segno di uguale
+func parseKeyMappings(pairs []string) (map[string]string, error) {
+    keys := make(map[string]string, len(pairs))
+    for _, pair := range pairs {
+        separator := strings.LastIndex(pair, "=")
+        if separator < 0 {
+            return nil, fmt.Errorf("%w: key mapping %q must be in the form name=key", errInvalidImport, pair)
+        }
+        name, key := strings.TrimSpace(pair[:separator]), strings.TrimSpace(pair[separator+1:])
+        if name == "" || !foodKeyPattern.MatchString(key) {
+            return nil, fmt.Errorf("%w: key mapping %q must be in the form name=key, with a key of lowercase letters, digits and underscores", errInvalidImport, pair)
+        }
+        keys[name] = key
+    }
+    return keys, nil
+}
+
+// I CSV della banca dati CREA e dei fogli di calcolo italiani usano il punto e virgola
+func newImportReader(input io.Reader) (*csv.Reader, error) {
+    buffered := bufio.NewReader(input)
+    firstLine, err := buffered.Peek(4096)
+    if err != nil && err != io.EOF && err != bufio.ErrBufferFull {
+        return nil, err
+    }
+    if end := bytes.IndexByte(firstLine, '\n'); end >= 0 {
+        firstLine = firstLine[:end]
+    }
+
+    reader := csv.NewReader(buffered)
+    reader.FieldsPerRecord = -1
+    reader.LazyQuotes = true
+    reader.TrimLeadingSpace = true
+    switch {
+    case bytes.Count(firstLine, []byte(";")) > bytes.Count(firstLine, []byte(",")):
+        reader.Comma = ';'
+    case bytes.Count(firstLine, []byte("\t")) > bytes.Count(firstLine, []byte(",")):
+        reader.Comma = '\t'
+    }
+    return reader, nil
+}
+
+func normalizeColumn(name string) string {
+    name = strings.TrimPrefix(name, "\ufeff")
+    return strings.Join(strings.Fields(strings.ToLower(strings.ReplaceAll(name, "_", " "))), " ")
+}
+
+// Indice della colonna di ogni campo: prima quelle indicate dall'utente,
+// poi i nomi riconosciuti; mancare un campo obbligatorio è un errore
+func mapImportColumns(header []string, overrides map[string]string) (map[string]int, error) {
+    indexes := make(map[string]int, len(header))
+    for i, name := range header {
+        if _, exists := indexes[normalizeColumn(name)]; !exists {
+            indexes[normalizeColumn(name)] = i
+        }
+    }
+
+    columns := make(map[string]int)
+    for field, name := range overrides {
+        if _, known := importColumnAliases[field]; !known {
+            return nil, fmt.Errorf("%w: unknown field %q, expected one of %s", errInvalidImport, field, strings.Join(importFields, ", "))
+        }
+        index, exists := indexes[normalizeColumn(name)]
+        if !exists {
+            return nil, fmt.Errorf("%w: column %q for %s not found", errInvalidImport, name, field)
+        }
+        columns[field] = index
+    }
+    for _, field := range importFields {
+        if _, mapped := columns[field]; mapped {
+            continue
+        }
+        for _, alias := range importColumnAliases[field] {
+            if index, exists := indexes[alias]; exists {
+                columns[field] = index
+                break
+            }
+        }
+    }
+
+    var missing []string
+    for _, field := range requiredImportFields {
+        if _, mapped := columns[field]; !mapped {
+            missing = append(missing, field)
+        }
+    }
+    if len(missing) > 0 {
+        return nil, fmt.Errorf("%w: no column for %s in %q; map them with field=column, for example calories=Energia (kcal)",
+            errInvalidImport, strings.Join(missing, ", "), header)
+    }
+    return columns, nil
+}
+
+func parseImportRow(fields []string, columns map[string]int) (importRow, error) {
+    var row importRow
+    value := func(field string) string {
+        index, mapped := columns[field]
+        if !mapped || index >= len(fields) {
+            return ""
+        }
+        return strings.TrimSpace(fields[index])
+    }
+
+    row.Name = value("name")
+    if row.Name == "" {
+        return row, errors.New("name is empty")
+    }
+    row.Key = value("key")
+    if row.Key == "" {
+        row.Key = foodKeyFromName(row.Name)
+    }
+    row.Category = value("category")
+    row.MealTypes = strings.FieldsFunc(value("mealTypes"), func(r rune) bool { return r == '|' || r == ',' || r == ' ' })
+
+    targets := map[string]*float64{"calories": &row.Calories, "protein": &row.Protein, "carbs": &row.Carbs, "fat": &row.Fat}
+    for _, field := range requiredImportFields[1:] {
+        parsed, present, err := parseNutrient(value(field))
+        if err != nil {
+            return row, fmt.Errorf("%s: %v", field, err)
+        }
+        if !present {
+            return row, fmt.Errorf("%s is missing", field)
+        }
+        *targets[field] = parsed
+    }
+    if _, mapped := columns["fiber"]; mapped {
+        fiber, present, err := parseNutrient(value("fiber"))
+        if err != nil {
+            return row, fmt.Errorf("fiber: %v", err)
+        }
+        if present {
+            row.Fiber = &fiber
+        }
+    }
+
+    if row.Calories > 900 {
+        return row, fmt.Errorf("%g kcal per 100 g is not plausible", row.Calories)
+    }
+    if total := row.Protein + row.Carbs + row.Fat; total > maxMacrosPer100g {
+        return row, fmt.Errorf("macronutrients add up to %g g per 100 g", total)
+    }
+    return row, nil
+}
+
+// Valore per 100 g; "tr" (tracce) vale zero, la virgola decimale è accettata e
+// una cella vuota o "-" indica un valore non disponibile
+func parseNutrient(value string) (float64, bool, error) {
+    value = strings.ToLower(strings.TrimSpace(value))
+    switch value {
+    case "", "-", "n.d.", "nd", "n/a":
+        return 0, false, nil
+    case "tr", "tracce", "trace":
+        return 0, true, nil
+    }
+    parsed, err := strconv.ParseFloat(strings.Replace(value, ",", ".", 1), 64)
+    if err != nil || parsed < 0 || math.IsNaN(parsed) || math.IsInf(parsed, 0) {
+        return 0, false, fmt.Errorf("%q is not a valid amount", value)
+    }
+    return parsed, true, nil
+}
+
+// "Pane di frumento, tipo 0" diventa "pane_di_frumento_tipo_0"
+func foodKeyFromName(name string) string {
+    key := nonKeyCharacters.ReplaceAllString(accentReplacer.Replace(strings.ToLower(name)), "_")
+    key = strings.Trim(key, "_")
+    if len(key) > 60 {
+        key = strings.TrimRight(key[:60], "_")
+    }
+    return key
+}
+
+// Parole significative del nome, senza accenti né punteggiatura
+func nameTokens(name string) map[string]bool {
+    tokens := make(map[string]bool)
+    for _, word := range strings.Fields(nonKeyCharacters.ReplaceAllString(accentReplacer.Replace(strings.ToLower(name)), " ")) {
+        if !nameStopwords[word] {
+            tokens[word] = true
+        }
+    }
+    return tokens
+}
+
+// Alimento esistente i cui nomi hanno le stesse parole in altro ordine, o le cui
+// parole sono tutte nel nome della riga (o viceversa); vince quello con più parole in comune
+func likelyDuplicate(name string, records []FoodRecord, tokens []map[string]bool) *FoodRecord {
+    rowTokens := nameTokens(name)
+    var best *FoodRecord
+    bestShared := 0
+    for i := range records {
+        shared := 0
+        for token := range rowTokens {
+            if tokens[i][token] {
+                shared++
+            }
+        }
+        if shared == 0 || (shared < len(rowTokens) && shared < len(tokens[i])) {
+            continue
+        }
+        if shared > bestShared {
+            best = &records[i]
+            bestShared = shared
+        }
+    }
+    return best
+}
+
+func newImportedFood(row importRow, options FoodImportOptions) planner.FoodRules {
+    food := planner.FoodRules{
+        Name:            row.Name,
+        StandardPortion: importStandardPortion,
+        MinPortion:      importMinPortion,
+        MaxPortion:      importMaxPortion,
+        Unit:            "g",
+        CaloriesPer100g: row.Calories,
+        ProteinPer100g:  row.Protein,
+        CarbsPer100g:    row.Carbs,
+        FatPer100g:      row.Fat,
+        Category:        row.Category,
+        MealTypes:       row.MealTypes,
+    }
+    if row.Fiber != nil {
+        food.FiberPer100g = *row.Fiber
+    }
+    if food.Category == "" {
+        food.Category = options.Category
+    }
+    if len(food.MealTypes) == 0 {
+        food.MealTypes = options.MealTypes
+    }
+    return food
+}
+
+// Aggiorna solo i valori nutrizionali e restituisce i campi cambiati
+func applyImportedNutrients(record *FoodRecord, row importRow) []string {
+    var changed []string
+    set := func(name string, target *float64, value float64) {
+        if *target != value {
+            *target = value
+            changed = append(changed, name)
+        }
+    }
+    set("caloriesPer100g", &record.CaloriesPer100g, row.Calories)
+    set("proteinPer100g", &record.ProteinPer100g, row.Protein)
+    set("carbsPer100g", &record.CarbsPer100g, row.Carbs)
+    set("fatPer100g", &record.FatPer100g, row.Fat)
+    if row.Fiber != nil {
+        set("fiberPer100g", &record.FiberPer100g, *row.Fiber)
+    }
+    return changed
+}
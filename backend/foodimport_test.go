@@ -0,0 +1,176 @@
+package main
+
+import (
+    "errors"
+    "reflect"
+    "testing"
+)
+
+func TestParseNutrient(t *testing.T) {
+    tests := []struct {
+        value   string
+        want    float64
+        present bool
+        wantErr bool
+    }{
+        {value: "12.5", want: 12.5, present: true},
+        {value: " 3,2 ", want: 3.2, present: true},
+        {value: "0", want: 0, present: true},
+        {value: "tr", want: 0, present: true},
+        {value: "Tracce", want: 0, present: true},
+        {value: ""},
+        {value: "-"},
+        {value: "n.d."},
+        {value: "N/A"},
+        {value: "abc", wantErr: true},
+        {value: "-4", wantErr: true},
+        {value: "1,234.5", wantErr: true},
+        {value: "NaN", wantErr: true},
+        {value: "Inf", wantErr: true},
+    }
+    for _, tt := range tests {
+        got, present, err := parseNutrient(tt.value)
+        if (err != nil) != tt.wantErr {
+            t.Errorf("parseNutrient(%q) error = %v, want error: %v", tt.value, err, tt.wantErr)
+            continue
+        }
+        if got != tt.want || present != tt.present {
+            t.Errorf("parseNutrient(%q) = %g, %v, want %g, %v", tt.value, got, present, tt.want, tt.present)
+        }
+    }
+}
+
+func TestMapImportColumns(t *testing.T) {
+    tests := []struct {
+        name      string
+        header    []string
+        overrides map[string]string
+        want      map[string]int
+        wantErr   bool
+    }{
+        {
+            name:   "english header",
+            header: []string{"Name", "Calories", "Protein", "Carbs", "Fat", "Fiber"},
+            want:   map[string]int{"name": 0, "calories": 1, "protein": 2, "carbs": 3, "fat": 4, "fiber": 5},
+        },
+        {
+            name:   "CREA header with extra columns",
+            header: []string{"\ufeffCodice", "Nome alimento", "Energia (kcal)", "Proteine totali (g)", "Carboidrati disponibili (g)", "Lipidi totali (g)", "Fibra alimentare totale (g)", "Categoria"},
+            want:   map[string]int{"name": 1, "calories": 2, "protein": 3, "carbs": 4, "fat": 5, "fiber": 6, "category": 7},
+        },
+        {
+            name:   "export of the catalog",
+            header: []string{"key", "name", "caloriesPer100g", "proteinPer100g", "carbsPer100g", "fatPer100g", "meal_types"},
+            want:   map[string]int{"key": 0, "name": 1, "calories": 2, "protein": 3, "carbs": 4, "fat": 5, "mealTypes": 6},
+        },
+        {
+            name:      "explicit mapping wins over the aliases",
+            header:    []string{"Alimento", "kcal", "Energia  (KCAL) ricalcolata", "Proteine", "Carboidrati", "Grassi"},
+            overrides: map[string]string{"calories": "energia (kcal) ricalcolata"},
+            want:      map[string]int{"name": 0, "calories": 2, "protein": 3, "carbs": 4, "fat": 5},
+        },
+        {
+            name:    "missing required column",
+            header:  []string{"Name", "Calories", "Protein", "Carbs"},
+            wantErr: true,
+        },
+        {
+            name:      "mapping to an unknown field",
+            header:    []string{"Name", "Calories", "Protein", "Carbs", "Fat"},
+            overrides: map[string]string{"sugar": "Sugars"},
+            wantErr:   true,
+        },
+        {
+            name:      "mapping to a missing column",
+            header:    []string{"Name", "Calories", "Protein", "Carbs", "Fat"},
+            overrides: map[string]string{"fiber": "Fibra"},
+            wantErr:   true,
+        },
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            columns, err := mapImportColumns(tt.header, tt.overrides)
+            if tt.wantErr {
+                if !errors.Is(err, errInvalidImport) {
+                    t.Fatalf("got %v, want %v", err, errInvalidImport)
+                }
+                return
+            }
+            if err != nil {
+                t.Fatal(err)
+            }
+            if !reflect.DeepEqual(columns, tt.want) {
+                t.Errorf("got %v, want %v", columns, tt.want)
+            }
+        })
+    }
+}
+
+func TestParseKeyMappings(t *testing.T) {
+    tests := []struct {
+        name    string
+        pairs   []string
+        want    map[string]string
+        wantErr bool
+    }{
+        {name: "name with commas", pairs: []string{"Pollo, petto=petto_pollo"}, want: map[string]string{"Pollo, petto": "petto_pollo"}},
+        {name: "last equals sign", pairs: []string{"Bevanda a=b = bevanda_ab"}, want: map[string]string{"Bevanda a=b": "bevanda_ab"}},
+        {name: "several mappings", pairs: []string{"Riso=riso", "Farro perlato=farro"}, want: map[string]string{"Riso": "riso", "Farro perlato": "farro"}},
+        {name: "no separator", pairs: []string{"petto_pollo"}, wantErr: true},
+        {name: "empty name", pairs: []string{"=petto_pollo"}, wantErr: true},
+        {name: "invalid key", pairs: []string{"Pollo=Petto Pollo"}, wantErr: true},
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            keys, err := parseKeyMappings(tt.pairs)
+            if tt.wantErr {
+                if !errors.Is(err, errInvalidImport) {
+                    t.Fatalf("got %v, want %v", err, errInvalidImport)
+                }
+                return
+            }
+            if err != nil {
+                t.Fatal(err)
+            }
+            if !reflect.DeepEqual(keys, tt.want) {
+                t.Errorf("got %v, want %v", keys, tt.want)
+            }
+        })
+    }
+}
+
+func TestLikelyDuplicate(t *testing.T) {
+    records := []FoodRecord{
+        {Key: "petto_pollo", Name: "Petto di pollo"},
+        {Key: "riso_basmati", Name: "Riso basmati"},
+        {Key: "riso_venere", Name: "Riso venere"},
+        {Key: "yogurt_greco", Name: "Yogurt greco"},
+    }
+    tokens := make([]map[string]bool, len(records))
+    for i, record := range records {
+        tokens[i] = nameTokens(record.Name)
+    }
+
+    tests := []struct {
+        name string
+        want string
+    }{
+        {name: "Pollo, petto", want: "petto_pollo"},
+        {name: "PETTO DI POLLO", want: "petto_pollo"},
+        {name: "Riso basmati, crudo", want: "riso_basmati"},
+        {name: "Yogurt", want: "yogurt_greco"},
+        {name: "Riso integrale", want: ""},
+        {name: "Tacchino, fesa", want: ""},
+    }
+    for _, tt := range tests {
+        var got string
+        if record := likelyDuplicate(tt.name, records, tokens); record != nil {
+            got = record.Key
+        }
+        if got != tt.want {
+            t.Errorf("likelyDuplicate(%q) = %q, want %q", tt.name, got, tt.want)
+        }
+    }
+}
@@ -1,844 +1,771 @@
 package main
 
 import (
+    "crypto/subtle"
+    "errors"
+    "flag"
+    "fmt"
     "log"
     "net/http"
-    "math"
-    "math/rand"
-    "time"
-    "sort"
+    "os"
+    "strconv"
     "strings"
+    "time"
+    "github.com/denisgjonmarkaj/meal-planner/planner"
     "github.com/gin-gonic/gin"
+    "gorm.io/gorm"
 )
 
-// Strutture di base
-type Food struct {
-    Name     string  `json:"name"`
-    Quantity float64 `json:"quantity"`
-    Unit     string  `json:"unit"`
-    Calories float64 `json:"calories"`
+func envOrDefault(name, fallback string) string {
+    if value := os.Getenv(name); value != "" {
+        return value
+    }
+    return fallback
 }
 
-type Meal struct {
-    Items    []Food  `json:"items"`
-    Calories float64 `json:"calories"`
+// Legge un parametro numerico facoltativo della query
+func parseOptionalFloat(name, value string, fallback float64) (float64, error) {
+    if value == "" {
+        return fallback, nil
+    }
+    parsed, err := strconv.ParseFloat(value, 64)
+    if err != nil {
+        return 0, fmt.Errorf("%s must be a number", name)
+    }
+    return parsed, nil
 }
 
-type MealPlan struct {
-    Colazione Meal `json:"colazione"`
-    Spuntino  Meal `json:"spuntino"`
-    Pranzo    Meal `json:"pranzo"`
-    Merenda   Meal `json:"merenda"`
-    Cena      Meal `json:"cena"`
+// Stato HTTP per gli errori del generatore: vincoli impossibili da
+// soddisfare, alimento inesistente o richiesta non valida
+func planErrorStatus(err error) int {
+    var unsatisfiable *planner.UnsatisfiableError
+    switch {
+    case errors.As(err, &unsatisfiable):
+        return http.StatusUnprocessableEntity
+    case errors.Is(err, planner.ErrFoodNotFound):
+        return http.StatusNotFound
+    default:
+        return http.StatusBadRequest
+    }
 }
 
-// Strutture per l'organizzazione degli ingredienti
-type IngredientCategory struct {
-    Name        string   `json:"name"`
-    Ingredients []string `json:"ingredients"`
+// Middleware: richiede in X-Admin-Token il valore di MEAL_PLANNER_ADMIN_TOKEN;
+// senza token configurato le modifiche al catalogo sono disabilitate
+func requireAdmin(c *gin.Context) {
+    token := os.Getenv("MEAL_PLANNER_ADMIN_TOKEN")
+    if token == "" {
+        c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "catalog changes are disabled: MEAL_PLANNER_ADMIN_TOKEN is not set"})
+        return
+    }
+    if subtle.ConstantTimeCompare([]byte(c.GetHeader("X-Admin-Token")), []byte(token)) != 1 {
+        c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "invalid admin token"})
+        return
+    }
+    c.Next()
 }
 
-type MealIngredients struct {
-    MealName    string               `json:"mealName"`
-    Categories  []IngredientCategory `json:"categories"`
+// explain=true nella query equivale a "explain": true nel corpo della richiesta
+func explainQuery(c *gin.Context) bool {
+    explain, _ := strconv.ParseBool(c.Query("explain"))
+    return explain
 }
 
-// Strutture delle regole
-type FoodRules struct {
-    Name            string   `json:"name"`
-    StandardPortion float64  `json:"standardPortion"`
-    Unit            string   `json:"unit"`
-    CaloriesPer100g float64  `json:"caloriesPer100g"`
-    Category        string   `json:"category"`
-    Description     string   `json:"description"`
-    MealTypes       []string `json:"mealTypes"`
-    MinPortion      float64  `json:"minPortion"`
-    MaxPortion      float64  `json:"maxPortion"`
-    Required        bool     `json:"required"`
-    Frequency       int      `json:"frequency"`
-}
+func main() {
+    // Con un sottocomando il programma lavora offline e non avvia il server
+    if len(os.Args) > 1 {
+        if _, exists := cliCommands[os.Args[1]]; exists {
+            os.Exit(runCLI(os.Args[1], os.Args[2:]))
+        }
+    }
 
-type MealRules struct {
-    RequiredCategories []string
-    CategoryLimits    map[string]float64
-    MinProtein        float64
-    MinCarbs          float64
-    MaxFat            float64
-}
+    foodsPath := flag.String("foods", os.Getenv("MEAL_PLANNER_FOODS"), "food catalog file (JSON or YAML); defaults to the built-in catalog")
+    mealRulesPath := flag.String("meal-rules", os.Getenv("MEAL_PLANNER_MEAL_RULES"), "meal rules file (JSON or YAML); defaults to the built-in rules")
+    dbPath := flag.String("db", envOrDefault("MEAL_PLANNER_DB", "meal-planner.db"), "SQLite database holding the live catalog")
+    flag.Parse()
+
+    // I file del catalogo popolano il database al primo avvio; in seguito
+    // vengono riletti solo con /api/admin/reload-catalog?source=files
+    catalogFiles = catalogSource{FoodsPath: *foodsPath, MealRulesPath: *mealRulesPath}
+    db, err := openCatalogDB(*dbPath, catalogFiles)
+    if err != nil {
+        log.Fatalf("Cannot open catalog database: %v", err)
+    }
+    catalogDB = db
+    if err := loadJWTSecret(); err != nil {
+        log.Fatalf("Cannot set up authentication: %v", err)
+    }
+    if err := refreshCatalogFromDB(catalogDB); err != nil {
+        log.Fatalf("Cannot load catalog: %v", err)
+    }
+    foods, mealTypes := catalogSize()
+    log.Printf("Loaded %d foods and %d meal types", foods, mealTypes)
 
-// Regole dei pasti
-var mealRules = map[string]MealRules{
-    "colazione": {
-        RequiredCategories: []string{"beverage", "carb", "protein"},
-        CategoryLimits: map[string]float64{
-            "carb":     200,
-            "protein":  150,
-            "fat":      100,
-            "beverage": 50,
-        },
-        MinProtein: 15,
-        MinCarbs:   30,
-        MaxFat:     15,
-    },
-    "spuntino": {
-        RequiredCategories: []string{"fruit", "carb"},
-        CategoryLimits: map[string]float64{
-            "fruit": 100,
-            "carb":  150,
-            "fat":   100,
-        },
-        MinProtein: 0,
-        MinCarbs:   15,
-        MaxFat:     10,
-    },
-    "pranzo": {
-        RequiredCategories: []string{"carb", "protein", "vegetable"},
-        CategoryLimits: map[string]float64{
-            "carb":      300,
-            "protein":   250,
-            "vegetable": 100,
-            "fat":       150,
-        },
-        MinProtein: 30,
-        MinCarbs:   60,
-        MaxFat:     25,
-    },
-    "merenda": {
-        RequiredCategories: []string{"fruit", "carb"},
-        CategoryLimits: map[string]float64{
-            "fruit": 100,
-            "carb":  150,
-            "fat":   100,
-        },
-        MinProtein: 0,
-        MinCarbs:   15,
-        MaxFat:     10,
-    },
-    "cena": {
-        RequiredCategories: []string{"protein", "vegetable", "carb"},
-        CategoryLimits: map[string]float64{
-            "protein":   300,
-            "vegetable": 100,
-            "carb":      200,
-            "fat":       100,
-        },
-        MinProtein: 35,
-        MinCarbs:   45,
-        MaxFat:     20,
-    },
-}
+    r := gin.Default()
 
-var foodRules = map[string]FoodRules{
-    // BEVANDE
-    "caffe": {
-        Name:            "Caffè",
-        StandardPortion: 30,
-        Unit:            "g",
-        CaloriesPer100g: 1,
-        Category:        "beverage",
-        Description:     "1 Tazzina",
-        MealTypes:       []string{"colazione"},
-        MinPortion:      30,
-        MaxPortion:      30,
-        Required:        true,
-        Frequency:       1,
-    },
-    "spremuta_arancia": {
-        Name:            "Spremuta di arancia",
-        StandardPortion: 200,
-        Unit:            "g",
-        CaloriesPer100g: 45,
-        Category:        "beverage",
-        Description:     "1 Bicchiere",
-        MealTypes:       []string{"colazione"},
-        MinPortion:      200,
-        MaxPortion:      200,
-        Required:        false,
-        Frequency:       1,
-    },
-    "ace_diet": {
-        Name:            "Ace Diet Hero",
-        StandardPortion: 250,
-        Unit:            "g",
-        CaloriesPer100g: 20,
-        Category:        "beverage",
-        Description:     "Alternativa alla spremuta",
-        MealTypes:       []string{"colazione"},
-        MinPortion:      250,
-        MaxPortion:      250,
-        Required:        false,
-        Frequency:       1,
-    },
-
-    // CARBOIDRATI
-    "panbauletto": {
-        Name:            "Panbauletto Integrale",
-        StandardPortion: 48,
-        Unit:            "g",
-        CaloriesPer100g: 270,
-        Category:        "carb",
-        Description:     "Mulino Bianco",
-        MealTypes:       []string{"colazione", "merenda"},
-        MinPortion:      48,
-        MaxPortion:      48,
-        Required:        true,
-        Frequency:       2,
-    },
-    "pane_integrale": {
-        Name:            "Pane integrale",
-        StandardPortion: 120,
-        Unit:            "g",
-        CaloriesPer100g: 250,
-        Category:        "carb",
-        Description:     "4 Fette",
-        MealTypes:       []string{"pranzo", "cena"},
-        MinPortion:      120,
-        MaxPortion:      120,
-        Required:        true,
-        Frequency:       2,
-    },
-    "crackers_integrali": {
-        Name:            "Crackers integrali",
-        StandardPortion: 30,
-        Unit:            "g",
-        CaloriesPer100g: 430,
-        Category:        "carb",
-        Description:     "1 Pacchetto",
-        MealTypes:       []string{"spuntino", "merenda"},
-        MinPortion:      30,
-        MaxPortion:      30,
-        Required:        false,
-        Frequency:       2,
-    },
-    "riso_venere": {
-        Name:            "Riso venere",
-        StandardPortion: 100,
-        Unit:            "g",
-        CaloriesPer100g: 340,
-        Category:        "carb",
-        Description:     "",
-        MealTypes:       []string{"pranzo"},
-        MinPortion:      100,
-        MaxPortion:      100,
-        Required:        false,
-        Frequency:       1,
-    },
-    "riso_basmati": {
-        Name:            "Riso basmati",
-        StandardPortion: 100,
-        Unit:            "g",
-        CaloriesPer100g: 350,
-        Category:        "carb",
-        Description:     "Alternativa al riso venere",
-        MealTypes:       []string{"pranzo"},
-        MinPortion:      100,
-        MaxPortion:      100,
-        Required:        false,
-        Frequency:       1,
-    },
-    "pasta_integrale": {
-        Name:            "Pasta integrale",
-        StandardPortion: 120,
-        Unit:            "g",
-        CaloriesPer100g: 340,
-        Category:        "carb",
-        Description:     "",
-        MealTypes:       []string{"pranzo"},
-        MinPortion:      120,
-        MaxPortion:      120,
-        Required:        false,
-        Frequency:       1,
-    },
-
-    // PROTEINE
-    "prosciutto_cotto": {
-        Name:            "Prosciutto cotto",
-        StandardPortion: 50,
-        Unit:            "g",
-        CaloriesPer100g: 145,
-        Category:        "protein",
-        Description:     "Alta qualità - sgrassato",
-        MealTypes:       []string{"colazione"},
-        MinPortion:      50,
-        MaxPortion:      50,
-        Required:        false,
-        Frequency:       1,
-    },
-    "salmone_affumicato": {
-        Name:            "Salmone affumicato",
-        StandardPortion: 50,
-        Unit:            "g",
-        CaloriesPer100g: 217,
-        Category:        "protein",
-        Description:     "",
-        MealTypes:       []string{"colazione", "pranzo"},
-        MinPortion:      50,
-        MaxPortion:      100,
-        Required:        false,
-        Frequency:       1,
-    },
-    "uova_albume": {
-        Name:            "Albume d'uovo",
-        StandardPortion: 80,
-        Unit:            "g",
-        CaloriesPer100g: 52,
-        Category:        "protein",
-        Description:     "",
-        MealTypes:       []string{"colazione"},
-        MinPortion:      80,
-        MaxPortion:      80,
-        Required:        false,
-        Frequency:       1,
-    },
-    "ricotta_light": {
-        Name:            "Ricotta Light",
-        StandardPortion: 60,
-        Unit:            "g",
-        CaloriesPer100g: 146,
-        Category:        "protein",
-        Description:     "Galbani",
-        MealTypes:       []string{"colazione"},
-        MinPortion:      60,
-        MaxPortion:      60,
-        Required:        false,
-        Frequency:       1,
-    },
-    "mozzarella_light": {
-        Name:            "Mozzarella Light",
-        StandardPortion: 125,
-        Unit:            "g",
-        CaloriesPer100g: 206,
-        Category:        "protein",
-        Description:     "Santa Lucia",
-        MealTypes:       []string{"pranzo"},
-        MinPortion:      125,
-        MaxPortion:      250,
-        Required:        false,
-        Frequency:       1,
-    },
-    "tonno_naturale": {
-        Name:            "Tonno al naturale",
-        StandardPortion: 160,
-        Unit:            "g",
-        CaloriesPer100g: 130,
-        Category:        "protein",
-        Description:     "Mareblu",
-        MealTypes:       []string{"pranzo"},
-        MinPortion:      160,
-        MaxPortion:      160,
-        Required:        false,
-        Frequency:       1,
-    },
-    "petto_pollo": {
-        Name:            "Petto di pollo",
-        StandardPortion: 250,
-        Unit:            "g",
-        CaloriesPer100g: 165,
-        Category:        "protein",
-        Description:     "",
-        MealTypes:       []string{"pranzo", "cena"},
-        MinPortion:      160,
-        MaxPortion:      250,
-        Required:        false,
-        Frequency:       1,
-    },
-    "tacchino_petto": {
-        Name:            "Tacchino petto",
-        StandardPortion: 250,
-        Unit:            "g",
-        CaloriesPer100g: 104,
-        Category:        "protein",
-        Description:     "",
-        MealTypes:       []string{"cena"},
-        MinPortion:      250,
-        MaxPortion:      250,
-        Required:        false,
-        Frequency:       1,
-    },
-    "pesce_spada": {
-        Name:            "Pesce spada",
-        StandardPortion: 250,
-        Unit:            "g",
-        CaloriesPer100g: 144,
-        Category:        "protein",
-        Description:     "",
-        MealTypes:       []string{"cena"},
-        MinPortion:      250,
-        MaxPortion:      250,
-        Required:        false,
-        Frequency:       1,
-    },
-    "salmone_fresco": {
-        Name:            "Salmone fresco",
-        StandardPortion: 200,
-        Unit:            "g",
-        CaloriesPer100g: 208,
-        Category:        "protein",
-        Description:     "",
-        MealTypes:       []string{"cena"},
-        MinPortion:      200,
-        MaxPortion:      200,
-        Required:        false,
-        Frequency:       1,
-    },
-    "merluzzo": {
-        Name:            "Merluzzo o nasello",
-        StandardPortion: 250,
-        Unit:            "g",
-        CaloriesPer100g: 82,
-        Category:        "protein",
-        Description:     "",
-        MealTypes:       []string{"cena"},
-        MinPortion:      250,
-        MaxPortion:      250,
-        Required:        false,
-        Frequency:       1,
-    },
-    "orata": {
-        Name:            "Orata fresca",
-        StandardPortion: 300,
-        Unit:            "g",
-        CaloriesPer100g: 124,
-        Category:        "protein",
-        Description:     "",
-        MealTypes:       []string{"cena"},
-        MinPortion:      300,
-        MaxPortion:      300,
-        Required:        false,
-        Frequency:       1,
-    },
-
-    // LATTICINI E FORMAGGI
-    "yogurt_greco": {
-        Name:            "Yogurt greco magro alla frutta",
-        StandardPortion: 150,
-        Unit:            "g",
-        CaloriesPer100g: 97,
-        Category:        "protein",
-        Description:     "",
-        MealTypes:       []string{"colazione", "merenda"},
-        MinPortion:      150,
-        MaxPortion:      170,
-        Required:        false,
-        Frequency:       2,
-    },
-    "grana": {
-        Name:            "Grana",
-        StandardPortion: 30,
-        Unit:            "g",
-        CaloriesPer100g: 392,
-        Category:        "protein",
-        Description:     "",
-        MealTypes:       []string{"pranzo", "merenda"},
-        MinPortion:      20,
-        MaxPortion:      50,
-        Required:        false,
-        Frequency:       1,
-    },
-
-    // LEGUMI
-    "lenticchie": {
-        Name:            "Lenticchie secche",
-        StandardPortion: 70,
-        Unit:            "g",
-        CaloriesPer100g: 325,
-        Category:        "protein",
-        Description:     "",
-        MealTypes:       []string{"pranzo"},
-        MinPortion:      70,
-        MaxPortion:      70,
-        Required:        false,
-        Frequency:       1,
-    },
-
-    // VERDURE
-    "broccoli": {
-        Name:            "Broccolo",
-        StandardPortion: 300,
-        Unit:            "g",
-        CaloriesPer100g: 34,
-        Category:        "vegetable",
-        Description:     "a testa",
-        MealTypes:       []string{"pranzo", "cena"},
-        MinPortion:      300,
-        MaxPortion:      300,
-        Required:        false,
-        Frequency:       2,
-    },
-    "zucchine": {
-        Name:            "Zucchine",
-        StandardPortion: 300,
-        Unit:            "g",
-        CaloriesPer100g: 17,
-        Category:        "vegetable",
-        Description:     "",
-        MealTypes:       []string{"pranzo", "cena"},
-        MinPortion:      200,
-        MaxPortion:      300,
-        Required:        false,
-        Frequency:       2,
-    },
-    "carote": {
-        Name:            "Carote",
-        StandardPortion: 150,
-        Unit:            "g",
-        CaloriesPer100g: 41,
-        Category:        "vegetable",
-        Description:     "",
-        MealTypes:       []string{"pranzo", "cena"},
-        MinPortion:      150,
-        MaxPortion:      200,
-        Required:        false,
-        Frequency:       2,
-    },
-    "lattuga": {
-        Name:            "Lattuga",
-        StandardPortion: 80,
-        Unit:            "g",
-        CaloriesPer100g: 15,
-        Category:        "vegetable",
-        Description:     "",
-        MealTypes:       []string{"pranzo", "cena"},
-        MinPortion:      80,
-        MaxPortion:      160,
-        Required:        false,
-        Frequency:       2,
-    },
-    "pomodori": {
-        Name:            "Pomodori da insalata",
-        StandardPortion: 200,
-        Unit:            "g",
-        CaloriesPer100g: 18,
-        Category:        "vegetable",
-        Description:     "",
-        MealTypes:       []string{"pranzo", "cena"},
-        MinPortion:      200,
-        MaxPortion:      200,
-        Required:        false,
-        Frequency:       2,
-    },
-    "melanzane": {
-        Name:            "Melanzane",
-        StandardPortion: 200,
-        Unit:            "g",
-        CaloriesPer100g: 25,
-        Category:        "vegetable",
-        Description:     "",
-        MealTypes:       []string{"pranzo", "cena"},
-        MinPortion:      200,
-        MaxPortion:      300,
-        Required:        false,
-        Frequency:       2,
-    },
-    "funghi": {
-        Name:            "Funghi coltivati prataioli",
-        StandardPortion: 300,
-        Unit:            "g",
-        CaloriesPer100g: 22,
-        Category:        "vegetable",
-        Description:     "",
-        MealTypes:       []string{"pranzo", "cena"},
-        MinPortion:      300,
-        MaxPortion:      300,
-        Required:        false,
-        Frequency:       2,
-    },
-    "rucola": {
-        Name:            "Rughetta o rucola",
-        StandardPortion: 100,
-        Unit:            "g",
-        CaloriesPer100g: 25,
-        Category:        "vegetable",
-        Description:     "",
-        MealTypes:       []string{"pranzo", "cena"},
-        MinPortion:      100,
-        MaxPortion:      100,
-        Required:        false,
-        Frequency:       2,
-    },
-
-    // FRUTTA E FRUTTA SECCA
-    "frutta_fresca": {
-        Name:            "Frutta fresca",
-        StandardPortion: 150,
-        Unit:            "g",
-        CaloriesPer100g: 50,
-        Category:        "fruit",
-        Description:     "media",
-        MealTypes:       []string{"colazione", "spuntino", "merenda"},
-        MinPortion:      150,
-        MaxPortion:      200,
-        Required:        true,
-        Frequency:       2,
-    },
-}
+    // CORS middleware
+    r.Use(func(c *gin.Context) {
+        c.Writer.Header().Set("Access-Control-Allow-Origin", "*")
+        c.Writer.Header().Set("Access-Control-Allow-Credentials", "true")
+        c.Writer.Header().Set("Access-Control-Allow-Headers", "Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization, accept, origin, Cache-Control, X-Requested-With")
+        c.Writer.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS, GET, PUT, DELETE")
 
-// Helper functions
-func calculateCalories(quantity float64, caloriesPer100g float64) float64 {
-    return (quantity * caloriesPer100g) / 100
-}
+        if c.Request.Method == "OPTIONS" {
+            c.AbortWithStatus(204)
+            return
+        }
+        c.Next()
+    })
 
-func containsCategory(items []Food, category string) bool {
-    for _, item := range items {
-        for _, rule := range foodRules {
-            if rule.Name == item.Name && rule.Category == category {
-                return true
-            }
+    // Ricarica il catalogo attivo dal database, ad esempio dopo modifiche esterne;
+    // con ?source=files riporta prima nel database il contenuto dei file
+    r.POST("/api/admin/reload-catalog", requireAdmin, func(c *gin.Context) {
+        var err error
+        switch source := c.DefaultQuery("source", "db"); source {
+        case "db":
+            err = refreshCatalogFromDB(catalogDB)
+        case "files":
+            err = syncCatalogFromFiles(catalogDB, catalogFiles)
+        default:
+            c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("unknown source %q, expected db or files", source)})
+            return
+        }
+        if err != nil {
+            log.Printf("Catalog reload failed: %v", err)
+            c.JSON(foodErrorStatus(err), gin.H{"error": err.Error()})
+            return
         }
-    }
-    return false
-}
 
-func getCategoryCalories(items []Food, category string) float64 {
-    var calories float64 = 0
-    for _, item := range items {
-        for _, rule := range foodRules {
-            if rule.Name == item.Name && rule.Category == category {
-                calories += item.Calories
-            }
+        foods, mealTypes := catalogSize()
+        log.Printf("Reloaded %d foods and %d meal types", foods, mealTypes)
+        c.JSON(http.StatusOK, gin.H{"foods": foods, "mealTypes": mealTypes})
+    })
+
+    // Importa alimenti da un CSV nutrizionale inviato come corpo della richiesta;
+    // ?column=campo=colonna e ?key=nome=chiave (ripetibili), ?category=, ?mealTypes= e ?dryRun=true
+    r.POST("/api/admin/import-foods", requireAdmin, func(c *gin.Context) {
+        columns, err := parseColumnMappings(c.QueryArray("column"))
+        if err != nil {
+            c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+            return
         }
-    }
-    return calories
-}
+        keys, err := parseKeyMappings(c.QueryArray("key"))
+        if err != nil {
+            c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+            return
+        }
+        dryRun, _ := strconv.ParseBool(c.Query("dryRun"))
+        report, err := importFoods(catalogDB, c.Request.Body, FoodImportOptions{
+            Columns:   columns,
+            Keys:      keys,
+            Category:  c.Query("category"),
+            MealTypes: splitList(c.Query("mealTypes")),
+            DryRun:    dryRun,
+        })
+        if errors.Is(err, errInvalidImport) {
+            c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+            return
+        }
+        if err != nil {
+            c.JSON(foodErrorStatus(err), gin.H{"error": err.Error()})
+            return
+        }
+        log.Printf("Imported foods: %d created, %d updated, %d skipped, dry run: %t",
+            report.Created, report.Updated, len(report.Skipped), dryRun)
+        c.JSON(http.StatusOK, report)
+    })
 
-func isAppropriateForMeal(rule FoodRules, mealType string) bool {
-    for _, allowedMeal := range rule.MealTypes {
-        if allowedMeal == mealType {
-            return true
+    // Catalogo degli alimenti: le modifiche aggiornano subito il catalogo attivo
+    r.GET("/api/foods", func(c *gin.Context) {
+        foods, err := listFoods(catalogDB, c.Query("includeRetired") == "true")
+        if err != nil {
+            c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+            return
         }
-    }
-    return false
-}
+        c.JSON(http.StatusOK, foods)
+    })
 
-func addFoodItem(items *[]Food, totalCalories *float64, rule FoodRules, targetCalories float64) bool {
-    calories := calculateCalories(rule.StandardPortion, rule.CaloriesPer100g)
-    if *totalCalories + calories <= targetCalories {
-        *items = append(*items, Food{
-            Name:     rule.Name,
-            Quantity: rule.StandardPortion,
-            Unit:     rule.Unit,
-            Calories: math.Round(calories),
+    r.GET("/api/foods/:key", func(c *gin.Context) {
+        record, err := findFoodRecord(catalogDB, c.Param("key"))
+        if err != nil {
+            c.JSON(foodErrorStatus(err), gin.H{"error": err.Error()})
+            return
+        }
+        c.JSON(http.StatusOK, FoodEntry{Key: record.Key, FoodRules: record.toFoodRules()})
+    })
+
+    // Le modifiche al catalogo sono riservate agli amministratori
+    r.POST("/api/foods", requireAdmin, func(c *gin.Context) {
+        var entry FoodEntry
+        if err := c.BindJSON(&entry); err != nil {
+            c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+            return
+        }
+        if problems := validateFoodEntry(entry.Key, entry.FoodRules); len(problems) > 0 {
+            c.JSON(http.StatusBadRequest, gin.H{"error": "invalid food", "problems": problems})
+            return
+        }
+        var restored bool
+        err := updateCatalog(catalogDB, func(tx *gorm.DB) (err error) {
+            restored, err = createFood(tx, entry.Key, entry.FoodRules)
+            return err
         })
-        *totalCalories += calories
-        return true
-    }
-    return false
-}
+        if err != nil {
+            c.JSON(foodErrorStatus(err), gin.H{"error": err.Error()})
+            return
+        }
+        if restored {
+            log.Printf("Restored food %s", entry.Key)
+        } else {
+            log.Printf("Added food %s", entry.Key)
+        }
+        c.JSON(http.StatusCreated, entry)
+    })
 
-// Funzione per organizzare gli ingredienti
-func organizeIngredients() []MealIngredients {
-    // Mappa iniziale per organizzare gli ingredienti per pasto e categoria
-    mealMap := map[string]map[string][]string{
-        "colazione": {
-            "Bevande":    {},
-            "Carboidrati": {},
-            "Proteine":    {},
-            "Frutta":      {},
-            "Extra":       {},
-        },
-        "spuntino": {
-            "Frutta":     {},
-            "Snack":      {},
-            "Extra":      {},
-        },
-        "pranzo": {
-            "Carboidrati": {},
-            "Proteine":    {},
-            "Verdure":     {},
-            "Extra":       {},
-        },
-        "merenda": {
-            "Frutta":     {},
-            "Snack":      {},
-            "Proteine":   {},
-            "Extra":      {},
-        },
-        "cena": {
-            "Carboidrati": {},
-            "Proteine":    {},
-            "Verdure":     {},
-            "Extra":       {},
-        },
-    }
+    r.PUT("/api/foods/:key", requireAdmin, func(c *gin.Context) {
+        var entry FoodEntry
+        if err := c.BindJSON(&entry); err != nil {
+            c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+            return
+        }
+        entry.Key = c.Param("key")
+        if problems := validateFoodEntry(entry.Key, entry.FoodRules); len(problems) > 0 {
+            c.JSON(http.StatusBadRequest, gin.H{"error": "invalid food", "problems": problems})
+            return
+        }
+        err := updateCatalog(catalogDB, func(tx *gorm.DB) error {
+            return updateFood(tx, entry.Key, entry.FoodRules)
+        })
+        if err != nil {
+            c.JSON(foodErrorStatus(err), gin.H{"error": err.Error()})
+            return
+        }
+        log.Printf("Updated food %s", entry.Key)
+        c.JSON(http.StatusOK, entry)
+    })
 
-    // Mapping delle categorie interne alle categorie visualizzate
-    categoryMapping := map[string]string{
-        "beverage":  "Bevande",
-        "carb":      "Carboidrati",
-        "protein":   "Proteine",
-        "vegetable": "Verdure",
-        "fruit":     "Frutta",
-        "fat":       "Extra",
-    }
+    r.DELETE("/api/foods/:key", requireAdmin, func(c *gin.Context) {
+        key := c.Param("key")
+        err := updateCatalog(catalogDB, func(tx *gorm.DB) error {
+            return retireFood(tx, key)
+        })
+        if err != nil {
+            c.JSON(foodErrorStatus(err), gin.H{"error": err.Error()})
+            return
+        }
+        log.Printf("Retired food %s", key)
+        c.Status(http.StatusNoContent)
+    })
 
-    // Mappa per tenere traccia degli ingredienti già aggiunti in ogni pasto
-    seenInMeal := make(map[string]map[string]bool)
-    for mealType := range mealMap {
-        seenInMeal[mealType] = make(map[string]bool)
-    }
+    // Account: registrazione e login restituiscono un token JWT
+    r.POST("/api/auth/register", func(c *gin.Context) {
+        var credentials Credentials
+        if err := c.BindJSON(&credentials); err != nil {
+            c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+            return
+        }
+        credentials, err := normalizeCredentials(credentials)
+        if err != nil {
+            c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+            return
+        }
+        user, err := registerUser(catalogDB, credentials)
+        if err != nil {
+            c.JSON(accountErrorStatus(err), gin.H{"error": err.Error()})
+            return
+        }
+        token, expiresAt, err := issueToken(user.ID)
+        if err != nil {
+            c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+            return
+        }
+        log.Printf("Registered user %d", user.ID)
+        c.JSON(http.StatusCreated, gin.H{"id": user.ID, "email": user.Email, "token": token, "expiresAt": expiresAt})
+    })
 
-    // Popola la mappa con gli ingredienti
-    for key, rule := range foodRules {
-        displayCategory := categoryMapping[rule.Category]
-        if displayCategory == "" {
-            displayCategory = "Extra"
-        }
-
-        for _, mealType := range rule.MealTypes {
-            if categories, exists := mealMap[mealType]; exists {
-                if !seenInMeal[mealType][key] {
-                    categories[displayCategory] = append(
-                        categories[displayCategory],
-                        key,
-                    )
-                    seenInMeal[mealType][key] = true
-                }
-            }
+    r.POST("/api/auth/login", func(c *gin.Context) {
+        var credentials Credentials
+        if err := c.BindJSON(&credentials); err != nil {
+            c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+            return
         }
-    }
+        user, err := authenticate(catalogDB, credentials)
+        if err != nil {
+            c.JSON(accountErrorStatus(err), gin.H{"error": err.Error()})
+            return
+        }
+        token, expiresAt, err := issueToken(user.ID)
+        if err != nil {
+            c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+            return
+        }
+        c.JSON(http.StatusOK, gin.H{"id": user.ID, "email": user.Email, "token": token, "expiresAt": expiresAt})
+    })
 
-    // Converti la mappa in slice per il JSON
-    var result []MealIngredients
-    
-    // Ordine predefinito dei pasti
-    mealOrder := []string{"colazione", "spuntino", "pranzo", "merenda", "cena"}
-    
-    for _, mealType := range mealOrder {
-        if categories, exists := mealMap[mealType]; exists {
-            var mealCategories []IngredientCategory
-            
-            // Ordine predefinito delle categorie
-            categoryOrder := []string{"Bevande", "Carboidrati", "Proteine", "Verdure", "Frutta", "Snack", "Extra"}
-            
-            for _, catName := range categoryOrder {
-                if ingredients, exists := categories[catName]; exists && len(ingredients) > 0 {
-                    // Ordina gli ingredienti alfabeticamente
-                    sort.Strings(ingredients)
-                    mealCategories = append(mealCategories, IngredientCategory{
-                        Name:        catName,
-                        Ingredients: ingredients,
-                    })
-                }
-            }
+    // Piani salvati: ogni utente vede solo i propri
+    plans := r.Group("/api/plans", requireAuth, withGenerator)
 
-            result = append(result, MealIngredients{
-                MealName:   strings.Title(mealType),
-                Categories: mealCategories,
-            })
+    plans.POST("", func(c *gin.Context) {
+        var request struct {
+            Name string           `json:"name"`
+            Plan planner.MealPlan `json:"plan"`
         }
-    }
+        if err := c.BindJSON(&request); err != nil {
+            c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+            return
+        }
+        request.Name = strings.TrimSpace(request.Name)
+        if request.Name == "" || len(request.Name) > maxPlanNameLength {
+            c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("name is required and must be at most %d characters", maxPlanNameLength)})
+            return
+        }
+        if len(request.Plan.Slots) == 0 {
+            c.JSON(http.StatusBadRequest, gin.H{"error": "plan has no meals"})
+            return
+        }
+        record, err := savePlan(catalogDB, requestUserID(c), request.Name, request.Plan)
+        if err != nil {
+            c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+            return
+        }
+        log.Printf("User %d saved plan %d", record.UserID, record.ID)
+        c.JSON(http.StatusCreated, record.full())
+    })
 
-    return result
-}
+    plans.GET("", func(c *gin.Context) {
+        records, err := listPlans(catalogDB, requestUserID(c))
+        if err != nil {
+            c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+            return
+        }
+        summaries := make([]SavedPlan, 0, len(records))
+        for _, record := range records {
+            summaries = append(summaries, record.summary())
+        }
+        c.JSON(http.StatusOK, summaries)
+    })
 
-// Funzione per generare il piano pasti
-func generateMealWithUserIngredients(mealType string, userIngredients []string, targetCalories float64) Meal {
-    rand.Seed(time.Now().UnixNano())
-    
-    var items []Food
-    var totalCalories float64 = 0
-    rules := mealRules[mealType]
-    addedCategories := make(map[string]bool)
-
-    // 1. Prima aggiungi gli ingredienti dell'utente che sono appropriati per questo pasto
-    for _, ing := range userIngredients {
-        if rule, exists := foodRules[ing]; exists {
-            if isAppropriateForMeal(rule, mealType) && !addedCategories[rule.Category] {
-                if categoryLimit, ok := rules.CategoryLimits[rule.Category]; ok {
-                    calories := calculateCalories(rule.StandardPortion, rule.CaloriesPer100g)
-                    if calories <= categoryLimit && totalCalories + calories <= targetCalories {
-                        if addFoodItem(&items, &totalCalories, rule, targetCalories) {
-                            addedCategories[rule.Category] = true
-                        }
-                    }
-                }
-            }
+    plans.GET("/:id", func(c *gin.Context) {
+        options, err := parseExportOptions(c)
+        if err != nil {
+            c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+            return
         }
-    }
+        record, err := findPlan(catalogDB, requestUserID(c), c.Param("id"))
+        if err != nil {
+            c.JSON(accountErrorStatus(err), gin.H{"error": err.Error()})
+            return
+        }
+        sendPlanExport(c, requestGenerator(c), options, record.full(), dailyPlan(record.Plan), record.Name)
+    })
 
-    // 2. Poi aggiungi gli elementi obbligatori mancanti
-    for _, category := range rules.RequiredCategories {
-        if !containsCategory(items, category) {
-            var availableIngredients []string
-            for k, v := range foodRules {
-                if v.Category == category && isAppropriateForMeal(v, mealType) {
-                    availableIngredients = append(availableIngredients, k)
-                }
-            }
-            if len(availableIngredients) > 0 {
-                randomIndex := rand.Intn(len(availableIngredients))
-                if rule, exists := foodRules[availableIngredients[randomIndex]]; exists {
-                    addFoodItem(&items, &totalCalories, rule, targetCalories)
-                }
+    // Scheda stampabile del piano salvato; ?shoppingList=true aggiunge la lista della spesa
+    plans.GET("/:id/pdf", func(c *gin.Context) {
+        record, err := findPlan(catalogDB, requestUserID(c), c.Param("id"))
+        if err != nil {
+            c.JSON(accountErrorStatus(err), gin.H{"error": err.Error()})
+            return
+        }
+        shoppingList, _ := strconv.ParseBool(c.Query("shoppingList"))
+        sendPDF(c, requestGenerator(c), PDFRequest{
+            Title:        record.Name,
+            Client:       c.Query("client"),
+            Plan:         &record.Plan,
+            ShoppingList: shoppingList,
+            GroupBy:      c.Query("groupBy"),
+        }, fmt.Sprintf("piano-%d.pdf", record.ID))
+    })
+
+    plans.DELETE("/:id", func(c *gin.Context) {
+        if err := deletePlan(catalogDB, requestUserID(c), c.Param("id")); err != nil {
+            c.JSON(accountErrorStatus(err), gin.H{"error": err.Error()})
+            return
+        }
+        c.Status(http.StatusNoContent)
+    })
+
+    // Aderenza al piano salvato: un giorno (predefinito oggi) o sette a partire da from
+    plans.GET("/:id/adherence", func(c *gin.Context) {
+        date, err := parseDate("date", c.DefaultQuery("date", time.Now().Format(dateLayout)))
+        if err != nil {
+            c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+            return
+        }
+        days, err := planAdherence(catalogDB, requestGenerator(c), requestUserID(c), c.Param("id"), date, 1)
+        if err != nil {
+            c.JSON(diaryErrorStatus(err), gin.H{"error": err.Error()})
+            return
+        }
+        c.JSON(http.StatusOK, days[0])
+    })
+
+    plans.GET("/:id/adherence/week", func(c *gin.Context) {
+        from, err := parseDate("from", c.DefaultQuery("from", time.Now().AddDate(0, 0, -6).Format(dateLayout)))
+        if err != nil {
+            c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+            return
+        }
+        days, err := planAdherence(catalogDB, requestGenerator(c), requestUserID(c), c.Param("id"), from, 7)
+        if err != nil {
+            c.JSON(diaryErrorStatus(err), gin.H{"error": err.Error()})
+            return
+        }
+        c.JSON(http.StatusOK, planner.WeekAdherenceOf(days[0].Date, days[len(days)-1].Date, days))
+    })
+
+    // Diario alimentare: cosa è stato mangiato, pasto per pasto, rispetto a un piano salvato
+    diary := r.Group("/api/diary", requireAuth, withGenerator)
+
+    diary.POST("", func(c *gin.Context) {
+        var request DiaryEntryRequest
+        if err := c.BindJSON(&request); err != nil {
+            c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+            return
+        }
+        record, err := logDiaryEntry(catalogDB, requestGenerator(c), requestUserID(c), request)
+        if err != nil {
+            c.JSON(diaryErrorStatus(err), gin.H{"error": err.Error()})
+            return
+        }
+        c.JSON(http.StatusCreated, record.entry())
+    })
+
+    // ?date= per un giorno oppure ?from=&to=; ?planId= limita a un piano
+    diary.GET("", func(c *gin.Context) {
+        from, to := c.Query("from"), c.Query("to")
+        if date := c.Query("date"); date != "" {
+            from, to = date, date
+        }
+        if _, err := parseDate("from", from); err != nil {
+            c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+            return
+        }
+        if _, err := parseDate("to", to); err != nil {
+            c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+            return
+        }
+        var planID uint64
+        if value := c.Query("planId"); value != "" {
+            var err error
+            if planID, err = strconv.ParseUint(value, 10, 64); err != nil {
+                c.JSON(http.StatusBadRequest, gin.H{"error": "planId must be a positive integer"})
+                return
             }
         }
-    }
 
-    // 3. Per spuntino e merenda, assicurati di avere almeno frutta o snack
-    if (mealType == "spuntino" || mealType == "merenda") && len(items) == 0 {
-        // Prova ad aggiungere frutta
-        if rule, exists := foodRules["frutta_fresca"]; exists {
-            addFoodItem(&items, &totalCalories, rule, targetCalories)
+        records, err := listDiaryEntries(catalogDB, requestUserID(c), uint(planID), from, to)
+        if err != nil {
+            c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+            return
         }
-        // Prova ad aggiungere crackers
-        if rule, exists := foodRules["crackers_integrali"]; exists {
-            addFoodItem(&items, &totalCalories, rule, targetCalories)
+        entries := make([]DiaryEntry, 0, len(records))
+        for _, record := range records {
+            entries = append(entries, record.entry())
         }
-    }
+        c.JSON(http.StatusOK, entries)
+    })
 
-    return Meal{
-        Items:    items,
-        Calories: math.Round(totalCalories),
-    }
-}
+    diary.DELETE("/:id", func(c *gin.Context) {
+        if err := deleteDiaryEntry(catalogDB, requestUserID(c), c.Param("id")); err != nil {
+            c.JSON(diaryErrorStatus(err), gin.H{"error": err.Error()})
+            return
+        }
+        c.Status(http.StatusNoContent)
+    })
 
-func main() {
-    r := gin.Default()
+    // Pesate, andamento del peso e target calorico adattivo
+    weight := r.Group("/api/weight", requireAuth)
 
-    // CORS middleware
-    r.Use(func(c *gin.Context) {
-        c.Writer.Header().Set("Access-Control-Allow-Origin", "*")
-        c.Writer.Header().Set("Access-Control-Allow-Credentials", "true")
-        c.Writer.Header().Set("Access-Control-Allow-Headers", "Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization, accept, origin, Cache-Control, X-Requested-With")
-        c.Writer.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS, GET, PUT, DELETE")
+    weight.POST("", func(c *gin.Context) {
+        var weighIn planner.WeighIn
+        if err := c.BindJSON(&weighIn); err != nil {
+            c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+            return
+        }
+        record, created, err := logWeighIn(catalogDB, requestUserID(c), weighIn)
+        if err != nil {
+            c.JSON(weightErrorStatus(err), gin.H{"error": err.Error()})
+            return
+        }
+        status := http.StatusOK
+        if created {
+            status = http.StatusCreated
+        }
+        c.JSON(status, record.entry())
+    })
 
-        if c.Request.Method == "OPTIONS" {
-            c.AbortWithStatus(204)
+    // ?from=&to= (predefiniti: le ultime settimane usate per l'andamento)
+    weight.GET("", func(c *gin.Context) {
+        to, err := parseDate("to", c.DefaultQuery("to", time.Now().Format(dateLayout)))
+        if err != nil {
+            c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
             return
         }
-        c.Next()
+        from, err := parseDate("from", c.DefaultQuery("from", to.AddDate(0, 0, -planner.WeightHistoryDays).Format(dateLayout)))
+        if err != nil {
+            c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+            return
+        }
+        records, err := listWeighIns(catalogDB, requestUserID(c), from.Format(dateLayout), to.Format(dateLayout))
+        if err != nil {
+            c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+            return
+        }
+        entries := make([]WeighInEntry, 0, len(records))
+        for _, record := range records {
+            entries = append(entries, record.entry())
+        }
+        c.JSON(http.StatusOK, entries)
+    })
+
+    weight.DELETE("/:id", func(c *gin.Context) {
+        if err := deleteWeighIn(catalogDB, requestUserID(c), c.Param("id")); err != nil {
+            c.JSON(weightErrorStatus(err), gin.H{"error": err.Error()})
+            return
+        }
+        c.Status(http.StatusNoContent)
+    })
+
+    // Andamento fino a ?to= (predefinito oggi)
+    weight.GET("/trend", func(c *gin.Context) {
+        to, err := parseDate("to", c.DefaultQuery("to", time.Now().Format(dateLayout)))
+        if err != nil {
+            c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+            return
+        }
+        weighIns, err := recentWeighIns(catalogDB, requestUserID(c), to)
+        if err != nil {
+            c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+            return
+        }
+        trend, err := planner.ComputeWeightTrend(weighIns)
+        if err != nil {
+            c.JSON(weightErrorStatus(err), gin.H{"error": err.Error()})
+            return
+        }
+        c.JSON(http.StatusOK, trend)
+    })
+
+    // Calorie suggerite per il prossimo piano settimanale, con il ragionamento
+    weight.POST("/adaptive-target", func(c *gin.Context) {
+        var request planner.AdaptiveTargetRequest
+        if err := c.BindJSON(&request); err != nil {
+            c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+            return
+        }
+        weighIns, err := recentWeighIns(catalogDB, requestUserID(c), time.Now())
+        if err != nil {
+            c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+            return
+        }
+        target, err := planner.SuggestAdaptiveTarget(request, weighIns)
+        if errors.Is(err, planner.ErrNoWeighIns) {
+            c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+            return
+        }
+        if err != nil {
+            c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+            return
+        }
+        c.JSON(http.StatusOK, target)
     })
 
-    // Routes
-    r.GET("/api/ingredients", func(c *gin.Context) {
-        ingredients := organizeIngredients()
+    // Routes: ogni richiesta usa il generatore attivo al suo arrivo
+    api := r.Group("/api", withGenerator)
+
+    api.GET("/ingredients", func(c *gin.Context) {
+        ingredients := requestGenerator(c).Ingredients()
         log.Printf("Sending %d meal categories", len(ingredients))
         c.JSON(http.StatusOK, ingredients)
     })
 
-    r.POST("/api/generate-plan", func(c *gin.Context) {
-        var request struct {
-            Ingredients    []string `json:"ingredients"`
-            TargetCalories int      `json:"targetCalories"`
+    // Alternative a un alimento con porzioni equivalenti per calorie e macronutrienti
+    api.GET("/ingredients/:name/alternatives", func(c *gin.Context) {
+        quantity, err := parseOptionalFloat("quantity", c.Query("quantity"), 0)
+        if err != nil {
+            c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+            return
+        }
+        tolerance, err := parseOptionalFloat("tolerance", c.Query("tolerance"), planner.DefaultSubstitutionTolerance)
+        if err != nil {
+            c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+            return
+        }
+
+        substitution, err := requestGenerator(c).Alternatives(planner.AlternativesRequest{
+            Key:              c.Param("name"),
+            MealType:         c.Query("mealType"),
+            Quantity:         quantity,
+            Tolerance:        tolerance,
+            ExcludeAllergens: c.QueryArray("excludeAllergens"),
+            Diets:            c.QueryArray("diets"),
+        })
+        if err != nil {
+            c.JSON(planErrorStatus(err), gin.H{"error": err.Error()})
+            return
         }
+        c.JSON(http.StatusOK, substitution)
+    })
+
+    api.POST("/generate-plan", func(c *gin.Context) {
+        var request planner.PlanRequest
 
         if err := c.BindJSON(&request); err != nil {
             c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
             return
         }
+        request.Explain = request.Explain || explainQuery(c)
+        options, err := parseExportOptions(c)
+        if err != nil {
+            c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+            return
+        }
 
-        log.Printf("Generating plan for %d ingredients, target calories: %d", 
-            len(request.Ingredients), request.TargetCalories)
+        if request.Count > 0 {
+            if options.Format != formatJSON {
+                c.JSON(http.StatusBadRequest, gin.H{"error": "ranked plans are only available as json"})
+                return
+            }
+            ranked, err := requestGenerator(c).GeneratePlans(request)
+            if err != nil {
+                c.JSON(planErrorStatus(err), gin.H{"error": err.Error()})
+                return
+            }
+            log.Printf("Generated %d ranked plans for %d ingredients, seed: %d",
+                len(ranked.Plans), len(request.Ingredients), ranked.Seed)
 
-        plan := MealPlan{
-            Colazione: generateMealWithUserIngredients("colazione", request.Ingredients, float64(request.TargetCalories)*0.25),
-            Spuntino:  generateMealWithUserIngredients("spuntino", request.Ingredients, float64(request.TargetCalories)*0.10),
-            Pranzo:    generateMealWithUserIngredients("pranzo", request.Ingredients, float64(request.TargetCalories)*0.35),
-            Merenda:   generateMealWithUserIngredients("merenda", request.Ingredients, float64(request.TargetCalories)*0.10),
-            Cena:      generateMealWithUserIngredients("cena", request.Ingredients, float64(request.TargetCalories)*0.20),
+            c.JSON(http.StatusOK, ranked)
+            return
+        }
+
+        plan, err := requestGenerator(c).GeneratePlan(request)
+        if err != nil {
+            c.JSON(planErrorStatus(err), gin.H{"error": err.Error()})
+            return
+        }
+        log.Printf("Generated plan for %d ingredients, calories: %.0f, seed: %d",
+            len(request.Ingredients), plan.Calories, *plan.Seed)
+
+        sendPlanExport(c, requestGenerator(c), options, plan, dailyPlan(plan), "Piano alimentare")
+    })
+
+    api.POST("/generate-weekly-plan", func(c *gin.Context) {
+        var request planner.PlanRequest
+
+        if err := c.BindJSON(&request); err != nil {
+            c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+            return
         }
+        request.Explain = request.Explain || explainQuery(c)
+        options, err := parseExportOptions(c)
+        if err != nil {
+            c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+            return
+        }
+
+        week, err := requestGenerator(c).GenerateWeeklyPlan(request)
+        if err != nil {
+            c.JSON(planErrorStatus(err), gin.H{"error": err.Error()})
+            return
+        }
+        log.Printf("Generated weekly plan for %d ingredients, calories: %.0f, seed: %d",
+            len(request.Ingredients), week.Calories, week.Seed)
+
+        sendPlanExport(c, requestGenerator(c), options, week, weeklyPlanDays(week), "Piano settimanale")
+    })
+
+    api.POST("/generate-household-plan", func(c *gin.Context) {
+        var request planner.HouseholdRequest
+
+        if err := c.BindJSON(&request); err != nil {
+            c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+            return
+        }
+        request.Explain = request.Explain || explainQuery(c)
+
+        household, err := requestGenerator(c).GenerateHouseholdPlan(request)
+        if err != nil {
+            c.JSON(planErrorStatus(err), gin.H{"error": err.Error()})
+            return
+        }
+        log.Printf("Generated household plan for %d members, %d shared meals, seed: %d",
+            len(household.Members), len(household.SharedMeals), household.Seed)
+
+        c.JSON(http.StatusOK, household)
+    })
+
+    // Rigenera un solo pasto di un piano esistente, lasciando invariati gli altri
+    api.POST("/regenerate-meal", func(c *gin.Context) {
+        var request planner.RegenerateMealRequest
 
-        c.JSON(http.StatusOK, plan)
+        if err := c.BindJSON(&request); err != nil {
+            c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+            return
+        }
+        request.Explain = request.Explain || explainQuery(c)
+
+        regenerated, err := requestGenerator(c).RegenerateMeal(request)
+        if err != nil {
+            c.JSON(planErrorStatus(err), gin.H{"error": err.Error()})
+            return
+        }
+        log.Printf("Regenerated meal %s with %d locked items, seed: %d", regenerated.Meal, len(request.Locked), regenerated.Seed)
+
+        c.JSON(http.StatusOK, regenerated)
+    })
+
+    // Verifica un piano, ad esempio modificato a mano, e ne elenca le violazioni
+    api.POST("/validate-plan", func(c *gin.Context) {
+        var plan planner.MealPlan
+
+        if err := c.BindJSON(&plan); err != nil {
+            c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+            return
+        }
+        targetCalories, err := parseOptionalFloat("targetCalories", c.Query("targetCalories"), 0)
+        if err != nil {
+            c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+            return
+        }
+
+        c.JSON(http.StatusOK, requestGenerator(c).ValidatePlan(plan, targetCalories))
+    })
+
+    // Lista della spesa da uno o più piani giornalieri o da un piano settimanale
+    api.POST("/shopping-list", func(c *gin.Context) {
+        var request planner.ShoppingListRequest
+
+        if err := c.BindJSON(&request); err != nil {
+            c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+            return
+        }
+
+        list, err := requestGenerator(c).ShoppingList(request)
+        if err != nil {
+            c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+            return
+        }
+        log.Printf("Built shopping list with %d groups", len(list.Groups))
+
+        if c.Query("format") == "text" {
+            c.String(http.StatusOK, list.Text)
+            return
+        }
+        c.JSON(http.StatusOK, list)
+    })
+
+    // Scheda stampabile di un piano giornaliero o settimanale
+    api.POST("/export/pdf", func(c *gin.Context) {
+        var request PDFRequest
+
+        if err := c.BindJSON(&request); err != nil {
+            c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+            return
+        }
+        filename := "piano.pdf"
+        if request.WeeklyPlan != nil {
+            filename = "piano-settimanale.pdf"
+        }
+        sendPDF(c, requestGenerator(c), request, filename)
     })
 
     log.Println("Server starting on :8080")
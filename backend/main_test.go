@@ -0,0 +1,43 @@
+package main
+
+import (
+    "net/http"
+    "net/http/httptest"
+    "testing"
+    "github.com/gin-gonic/gin"
+)
+
+func TestRequireAdmin(t *testing.T) {
+    gin.SetMode(gin.TestMode)
+    tests := []struct {
+        name   string
+        token  string
+        header string
+        want   int
+    }{
+        {name: "no token configured", want: http.StatusForbidden},
+        {name: "no token configured, header sent", header: "secret", want: http.StatusForbidden},
+        {name: "missing header", token: "secret", want: http.StatusUnauthorized},
+        {name: "wrong token", token: "secret", header: "secreT", want: http.StatusUnauthorized},
+        {name: "token prefix", token: "secret", header: "sec", want: http.StatusUnauthorized},
+        {name: "valid token", token: "secret", header: "secret", want: http.StatusNoContent},
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            t.Setenv("MEAL_PLANNER_ADMIN_TOKEN", tt.token)
+            r := gin.New()
+            r.POST("/api/foods", requireAdmin, func(c *gin.Context) { c.Status(http.StatusNoContent) })
+
+            request := httptest.NewRequest(http.MethodPost, "/api/foods", nil)
+            if tt.header != "" {
+                request.Header.Set("X-Admin-Token", tt.header)
+            }
+            recorder := httptest.NewRecorder()
+            r.ServeHTTP(recorder, request)
+            if recorder.Code != tt.want {
+                t.Errorf("status %d, want %d", recorder.Code, tt.want)
+            }
+        })
+    }
+}
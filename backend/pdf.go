@@ -0,0 +1,197 @@
+package main
+
+import (
+    "bytes"
+    "errors"
+    "fmt"
+    "io"
+    "net/http"
+    "strings"
+    "time"
+
+    "github.com/denisgjonmarkaj/meal-planner/planner"
+    "github.com/gin-gonic/gin"
+    "github.com/go-pdf/fpdf"
+)
+
+// Richiesta di esportazione in PDF: un piano giornaliero oppure uno settimanale
+type PDFRequest struct {
+    Title        string              `json:"title"`
+    // Nome del cliente stampato sotto il titolo
+    Client       string              `json:"client"`
+    Plan         *planner.MealPlan   `json:"plan"`
+    WeeklyPlan   *planner.WeeklyPlan `json:"weeklyPlan"`
+    // Aggiunge una pagina con la lista della spesa
+    ShoppingList bool                `json:"shoppingList"`
+    GroupBy      string              `json:"groupBy"`
+}
+
+const (
+    defaultPDFTitle = "Piano alimentare"
+    pdfMargin       = 15
+    pdfRowHeight    = 7
+)
+
+// Larghezze in mm delle colonne delle tabelle dei pasti (A4 meno i margini)
+var pdfColumns = []float64{75, 45, 30, 30}
+
+func (r PDFRequest) days() ([]planDay, error) {
+    switch {
+    case r.Plan != nil && r.WeeklyPlan != nil:
+        return nil, errors.New("provide either plan or weeklyPlan, not both")
+    case r.Plan != nil:
+        return dailyPlan(*r.Plan), nil
+    case r.WeeklyPlan != nil && len(r.WeeklyPlan.Days) > 0:
+        return weeklyPlanDays(*r.WeeklyPlan), nil
+    default:
+        return nil, errors.New("plan or weeklyPlan is required")
+    }
+}
+
+// Scrive la scheda del piano: un giorno per pagina con i pasti in ordine,
+// le porzioni con l'indicazione pratica e le calorie di pasti e giornata
+func writePlanPDF(out io.Writer, g *planner.Generator, request PDFRequest) error {
+    days, err := request.days()
+    if err != nil {
+        return err
+    }
+    var list planner.ShoppingList
+    if request.ShoppingList {
+        shopping := planner.ShoppingListRequest{WeeklyPlan: request.WeeklyPlan, GroupBy: request.GroupBy}
+        if request.Plan != nil {
+            shopping.Plans = []planner.MealPlan{*request.Plan}
+        }
+        if list, err = g.ShoppingList(shopping); err != nil {
+            return err
+        }
+    }
+    title := strings.TrimSpace(request.Title)
+    if title == "" {
+        title = defaultPDFTitle
+    }
+
+    pdf := fpdf.New("P", "mm", "A4", "")
+    pdf.SetMargins(pdfMargin, pdfMargin, pdfMargin)
+    pdf.SetAutoPageBreak(true, pdfMargin)
+    pdf.SetTitle(title, true)
+    pdf.SetCreator("meal-planner", true)
+    // I font standard usano la codifica cp1252, sufficiente per l'italiano
+    tr := pdf.UnicodeTranslatorFromDescriptor("")
+    pdf.SetFooterFunc(func() {
+        pdf.SetY(-pdfMargin + 5)
+        pdf.SetFont("Helvetica", "I", 8)
+        pdf.SetTextColor(120, 120, 120)
+        pdf.CellFormat(0, 5, tr(fmt.Sprintf("%s - pagina %d", title, pdf.PageNo())), "", 0, "C", false, 0, "")
+        pdf.SetTextColor(0, 0, 0)
+    })
+
+    for _, day := range days {
+        pdf.AddPage()
+        writePDFHeader(pdf, tr, title, request.Client, day.Name)
+        writePDFDay(pdf, tr, g, day.Plan)
+    }
+    if request.ShoppingList {
+        pdf.AddPage()
+        writePDFHeader(pdf, tr, title, request.Client, "Lista della spesa")
+        writePDFShoppingList(pdf, tr, list)
+    }
+    return pdf.Output(out)
+}
+
+func writePDFHeader(pdf *fpdf.Fpdf, tr func(string) string, title, client, subtitle string) {
+    pdf.SetFont("Helvetica", "B", 18)
+    pdf.CellFormat(0, 10, tr(title), "", 1, "L", false, 0, "")
+    pdf.SetFont("Helvetica", "", 10)
+    details := time.Now().Format("02/01/2006")
+    if client = strings.TrimSpace(client); client != "" {
+        details = client + " - " + details
+    }
+    pdf.CellFormat(0, 6, tr(details), "", 1, "L", false, 0, "")
+    if subtitle != "" {
+        pdf.Ln(2)
+        pdf.SetFont("Helvetica", "B", 14)
+        pdf.CellFormat(0, 8, tr(subtitle), "", 1, "L", false, 0, "")
+    }
+    pdf.Ln(3)
+}
+
+func writePDFDay(pdf *fpdf.Fpdf, tr func(string) string, g *planner.Generator, plan planner.MealPlan) {
+    for _, slot := range plan.SlotMeals() {
+        // Intestazione e tabella del pasto restano sulla stessa pagina
+        _, pageHeight := pdf.GetPageSize()
+        if pdf.GetY()+float64(len(slot.Items)+2)*pdfRowHeight > pageHeight-pdfMargin {
+            pdf.AddPage()
+        }
+
+        pdf.SetFont("Helvetica", "B", 12)
+        pdf.SetFillColor(225, 238, 225)
+        pdf.CellFormat(sum(pdfColumns[:3]), pdfRowHeight+1, tr(strings.Title(slot.Name)), "", 0, "L", true, 0, "")
+        pdf.CellFormat(pdfColumns[3], pdfRowHeight+1, fmt.Sprintf("%.0f kcal", slot.Calories), "", 1, "R", true, 0, "")
+
+        pdf.SetFont("Helvetica", "I", 9)
+        for i, heading := range []string{"Alimento", "Porzione", "Quantità", "kcal"} {
+            align := "L"
+            if i >= 2 {
+                align = "R"
+            }
+            pdf.CellFormat(pdfColumns[i], pdfRowHeight-1, tr(heading), "B", 0, align, false, 0, "")
+        }
+        pdf.Ln(-1)
+
+        pdf.SetFont("Helvetica", "", 10)
+        for _, item := range slot.Items {
+            pdf.CellFormat(pdfColumns[0], pdfRowHeight, tr(item.Name), "", 0, "L", false, 0, "")
+            pdf.CellFormat(pdfColumns[1], pdfRowHeight, tr(g.PortionHint(item)), "", 0, "L", false, 0, "")
+            pdf.CellFormat(pdfColumns[2], pdfRowHeight, fmt.Sprintf("%g %s", item.Quantity, item.Unit), "", 0, "R", false, 0, "")
+            pdf.CellFormat(pdfColumns[3], pdfRowHeight, fmt.Sprintf("%.0f", item.Calories), "", 1, "R", false, 0, "")
+        }
+        pdf.Ln(4)
+    }
+
+    pdf.SetFont("Helvetica", "B", 11)
+    pdf.CellFormat(0, pdfRowHeight, fmt.Sprintf("Totale giornaliero: %.0f kcal", plan.Calories), "T", 1, "L", false, 0, "")
+    pdf.SetFont("Helvetica", "", 10)
+    pdf.CellFormat(0, pdfRowHeight, fmt.Sprintf("Proteine %.1f g - Carboidrati %.1f g - Grassi %.1f g - Fibre %.1f g", plan.Protein, plan.Carbs, plan.Fat, plan.Fiber), "", 1, "L", false, 0, "")
+}
+
+func writePDFShoppingList(pdf *fpdf.Fpdf, tr func(string) string, list planner.ShoppingList) {
+    for _, group := range list.Groups {
+        pdf.SetFont("Helvetica", "B", 12)
+        pdf.SetFillColor(225, 238, 225)
+        pdf.CellFormat(0, pdfRowHeight+1, tr(group.Name), "", 1, "L", true, 0, "")
+        pdf.SetFont("Helvetica", "", 10)
+        for _, item := range group.Items {
+            packages := ""
+            if item.Packages > 0 {
+                packages = fmt.Sprintf("%d x %s da %g %s", item.Packages, item.PackageName, item.PackageSize, item.Unit)
+            }
+            // Casella da spuntare durante la spesa
+            x, y := pdf.GetXY()
+            pdf.Rect(x+1, y+1.5, 4, 4, "D")
+            pdf.CellFormat(8, pdfRowHeight, "", "", 0, "L", false, 0, "")
+            pdf.CellFormat(pdfColumns[0]-8, pdfRowHeight, tr(item.Name), "", 0, "L", false, 0, "")
+            pdf.CellFormat(pdfColumns[1], pdfRowHeight, fmt.Sprintf("%g %s", item.Quantity, item.Unit), "", 0, "R", false, 0, "")
+            pdf.CellFormat(0, pdfRowHeight, tr(packages), "", 1, "R", false, 0, "")
+        }
+        pdf.Ln(3)
+    }
+}
+
+// Risponde con il PDF come allegato da scaricare
+func sendPDF(c *gin.Context, g *planner.Generator, request PDFRequest, filename string) {
+    var buffer bytes.Buffer
+    if err := writePlanPDF(&buffer, g, request); err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+        return
+    }
+    c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+    c.Data(http.StatusOK, "application/pdf", buffer.Bytes())
+}
+
+func sum(values []float64) float64 {
+    var total float64
+    for _, value := range values {
+        total += value
+    }
+    return total
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+    "bytes"
+    "regexp"
+    "testing"
+    "github.com/denisgjonmarkaj/meal-planner/planner"
+)
+
+// Oggetti pagina del PDF, esclusa la radice /Pages
+var pdfPage = regexp.MustCompile(`/Type /Page\b[^s]`)
+
+func testGenerator(t *testing.T) *planner.Generator {
+    t.Helper()
+    foods, rules, err := loadCatalog(catalogSource{})
+    if err != nil {
+        t.Fatal(err)
+    }
+    return planner.NewGenerator(planner.NewMapCatalog(foods), rules, planner.Options{})
+}
+
+func TestWritePlanPDF(t *testing.T) {
+    g := testGenerator(t)
+    seed := int64(2)
+    plan, err := g.GeneratePlan(planner.PlanRequest{TargetCalories: 2000, Seed: &seed})
+    if err != nil {
+        t.Fatal(err)
+    }
+    week, err := g.GenerateWeeklyPlan(planner.PlanRequest{TargetCalories: 2000, Seed: &seed})
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    tests := []struct {
+        name    string
+        request PDFRequest
+        pages   int
+        wantErr bool
+    }{
+        {name: "daily plan", request: PDFRequest{Plan: &plan, Client: "Mario Rossi"}, pages: 1},
+        {name: "daily plan with shopping list", request: PDFRequest{Plan: &plan, ShoppingList: true, GroupBy: "aisle"}, pages: 2},
+        {name: "weekly plan", request: PDFRequest{Title: "Settimana", WeeklyPlan: &week}, pages: 7},
+        {name: "both plans", request: PDFRequest{Plan: &plan, WeeklyPlan: &week}, wantErr: true},
+        {name: "no plan", request: PDFRequest{}, wantErr: true},
+        {name: "empty weekly plan", request: PDFRequest{WeeklyPlan: &planner.WeeklyPlan{}}, wantErr: true},
+        {name: "unknown grouping", request: PDFRequest{Plan: &plan, ShoppingList: true, GroupBy: "store"}, wantErr: true},
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            var out bytes.Buffer
+            err := writePlanPDF(&out, g, tt.request)
+            if tt.wantErr {
+                if err == nil {
+                    t.Fatal("expected an error")
+                }
+                return
+            }
+            if err != nil {
+                t.Fatal(err)
+            }
+            if !bytes.HasPrefix(out.Bytes(), []byte("%PDF-")) {
+                t.Fatal("output is not a PDF")
+            }
+            if pages := len(pdfPage.FindAll(out.Bytes(), -1)); pages != tt.pages {
+                t.Errorf("%d pages, want %d", pages, tt.pages)
+            }
+        })
+    }
+}
+
+func TestPortionHint(t *testing.T) {
+    g := testGenerator(t)
+    tests := []struct {
+        key      string
+        quantity float64
+        want     string
+    }{
+        {key: "pane_integrale", quantity: 120, want: "4 Fette"},
+        {key: "pane_integrale", quantity: 90, want: "3 Fette"},
+        {key: "pane_integrale", quantity: 45, want: "1,5 Fette"},
+        {key: "pane_integrale", quantity: 5, want: "0,5 Fette"},
+        {key: "caffe", quantity: 30, want: "1 Tazzina"},
+        {key: "riso_basmati", quantity: 80, want: "Alternativa al riso venere"},
+        {key: "zucchine", quantity: 200, want: ""},
+    }
+    for _, tt := range tests {
+        rule, _ := g.Catalog().Food(tt.key)
+        food := planner.Food{Key: tt.key, Name: rule.Name, Quantity: tt.quantity}
+        if got := g.PortionHint(food); got != tt.want {
+            t.Errorf("%s %g g: got %q, want %q", tt.key, tt.quantity, got, tt.want)
+        }
+    }
+}
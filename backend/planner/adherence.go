@@ -0,0 +1,226 @@
+package planner
+
+import (
+    "errors"
+    "math"
+)
+
+// Esito del confronto tra un pasto previsto e quanto registrato nel diario
+const (
+    // Mangiati gli alimenti previsti, senza sostituzioni né aggiunte
+    MealFollowed  = "followed"
+    // Mangiato con sostituzioni, alimenti mancanti o aggiunti
+    MealModified  = "modified"
+    MealSkipped   = "skipped"
+    // Registrato nel diario ma non previsto dal piano
+    MealUnplanned = "unplanned"
+)
+
+// Calorie e macronutrienti di un insieme di alimenti
+type Intake struct {
+    Calories float64 `json:"calories"`
+    Macros
+}
+
+// Alimento previsto sostituito da un altro della stessa categoria
+type FoodSwap struct {
+    Category string `json:"category"`
+    Planned  string `json:"planned"`
+    Eaten    string `json:"eaten"`
+}
+
+type MealAdherence struct {
+    Meal          string     `json:"meal"`
+    Status        string     `json:"status"`
+    Planned       Intake     `json:"planned"`
+    Eaten         Intake     `json:"eaten"`
+    Substitutions []FoodSwap `json:"substitutions,omitempty"`
+    // Alimenti previsti e non mangiati, e mangiati ma non previsti, senza sostituto
+    Missing       []string   `json:"missing,omitempty"`
+    Extra         []string   `json:"extra,omitempty"`
+}
+
+type DayAdherence struct {
+    Date              string          `json:"date"`
+    // Falso se per il giorno non c'è nessuna registrazione
+    Logged            bool            `json:"logged"`
+    Planned           Intake          `json:"planned"`
+    Eaten             Intake          `json:"eaten"`
+    CalorieDifference float64         `json:"calorieDifference"`
+    // 1 se le calorie mangiate coincidono con quelle previste, 0 se lo scarto è del 100% o più
+    CalorieAdherence  float64         `json:"calorieAdherence"`
+    SkippedMeals      []string        `json:"skippedMeals,omitempty"`
+    Substitutions     int             `json:"substitutions"`
+    Meals             []MealAdherence `json:"meals"`
+}
+
+// Riepilogo di più giorni: i totali considerano solo i giorni registrati
+type WeekAdherence struct {
+    From              string         `json:"from"`
+    To                string         `json:"to"`
+    LoggedDays        int            `json:"loggedDays"`
+    Planned           Intake         `json:"planned"`
+    Eaten             Intake         `json:"eaten"`
+    CalorieDifference float64        `json:"calorieDifference"`
+    // Media dell'aderenza calorica dei giorni registrati
+    CalorieAdherence  float64        `json:"calorieAdherence"`
+    SkippedMeals      int            `json:"skippedMeals"`
+    Substitutions     int            `json:"substitutions"`
+    Days              []DayAdherence `json:"days"`
+}
+
+// Alimento da registrare nel diario, con i valori calcolati dal catalogo
+func (g *Generator) LoggedFood(key string, quantity float64) (Food, error) {
+    rule, exists := g.catalog.Food(key)
+    if !exists {
+        return Food{}, ErrFoodNotFound
+    }
+    if quantity <= 0 {
+        return Food{}, errors.New("quantity must be positive")
+    }
+    return newFood(key, rule, quantity), nil
+}
+
+// Confronta il piano con quanto mangiato in un giorno, pasto per pasto;
+// eaten raccoglie gli alimenti del diario per nome del pasto
+func (g *Generator) DayAdherence(plan MealPlan, date string, eaten map[string][]Food) DayAdherence {
+    plan = plan.withSlots()
+    day := DayAdherence{Date: date, Logged: len(eaten) > 0}
+
+    planned := make(map[string]bool)
+    for _, slot := range plan.Slots {
+        planned[slot.Name] = true
+        day.addMeal(g.compareMeal(slot.Name, slot.Items, eaten[slot.Name]))
+    }
+    for _, name := range SortedKeys(eaten) {
+        if !planned[name] {
+            day.addMeal(g.compareMeal(name, nil, eaten[name]))
+        }
+    }
+
+    var plannedItems, eatenItems []Food
+    for _, meal := range plan.Slots {
+        plannedItems = append(plannedItems, meal.Items...)
+    }
+    for _, items := range eaten {
+        eatenItems = append(eatenItems, items...)
+    }
+    day.Planned = g.intake(plannedItems)
+    day.Eaten = g.intake(eatenItems)
+    day.CalorieDifference = day.Eaten.Calories - day.Planned.Calories
+    day.CalorieAdherence = calorieAdherence(day.Planned.Calories, day.Eaten.Calories)
+    return day
+}
+
+func (d *DayAdherence) addMeal(meal MealAdherence) {
+    if meal.Status == MealSkipped {
+        d.SkippedMeals = append(d.SkippedMeals, meal.Meal)
+    }
+    d.Substitutions += len(meal.Substitutions)
+    d.Meals = append(d.Meals, meal)
+}
+
+// Riassume i giorni indicati, ignorando nei totali quelli senza registrazioni
+func WeekAdherenceOf(from, to string, days []DayAdherence) WeekAdherence {
+    week := WeekAdherence{From: from, To: to, Days: days}
+    var adherence float64
+    for _, day := range days {
+        if !day.Logged {
+            continue
+        }
+        week.LoggedDays++
+        week.Planned.Calories += day.Planned.Calories
+        week.Planned.Macros.add(day.Planned.Macros)
+        week.Eaten.Calories += day.Eaten.Calories
+        week.Eaten.Macros.add(day.Eaten.Macros)
+        week.SkippedMeals += len(day.SkippedMeals)
+        week.Substitutions += day.Substitutions
+        adherence += day.CalorieAdherence
+    }
+    week.Planned.Macros = week.Planned.Macros.rounded()
+    week.Eaten.Macros = week.Eaten.Macros.rounded()
+    week.CalorieDifference = week.Eaten.Calories - week.Planned.Calories
+    if week.LoggedDays > 0 {
+        week.CalorieAdherence = roundScore(adherence / float64(week.LoggedDays))
+    }
+    return week
+}
+
+// Abbina gli alimenti previsti e non mangiati a quelli mangiati e non previsti
+// della stessa categoria; quelli rimasti senza coppia sono mancanti o aggiunti
+func (g *Generator) compareMeal(name string, planned, eaten []Food) MealAdherence {
+    meal := MealAdherence{Meal: name, Planned: g.intake(planned), Eaten: g.intake(eaten)}
+
+    eatenKeys := make(map[string]bool)
+    for _, item := range eaten {
+        eatenKeys[foodIdentity(item)] = true
+    }
+    plannedKeys := make(map[string]bool)
+    var missing []Food
+    for _, item := range planned {
+        plannedKeys[foodIdentity(item)] = true
+        if !eatenKeys[foodIdentity(item)] {
+            missing = append(missing, item)
+        }
+    }
+    var extra []Food
+    for _, item := range eaten {
+        if !plannedKeys[foodIdentity(item)] {
+            extra = append(extra, item)
+        }
+    }
+
+    switch {
+    case len(planned) == 0:
+        meal.Status = MealUnplanned
+    case len(eaten) == 0:
+        meal.Status = MealSkipped
+        return meal
+    }
+
+    matched := make([]bool, len(extra))
+    for _, item := range missing {
+        _, plannedRule, known := g.resolveFood(item)
+        swapped := false
+        for i, candidate := range extra {
+            if !known || matched[i] {
+                continue
+            }
+            if _, eatenRule, ok := g.resolveFood(candidate); ok && eatenRule.Category == plannedRule.Category {
+                meal.Substitutions = append(meal.Substitutions, FoodSwap{Category: plannedRule.Category, Planned: item.Name, Eaten: candidate.Name})
+                matched[i] = true
+                swapped = true
+                break
+            }
+        }
+        if !swapped {
+            meal.Missing = append(meal.Missing, item.Name)
+        }
+    }
+    for i, item := range extra {
+        if !matched[i] {
+            meal.Extra = append(meal.Extra, item.Name)
+        }
+    }
+
+    if meal.Status == "" {
+        meal.Status = MealFollowed
+        if len(meal.Substitutions) > 0 || len(meal.Missing) > 0 || len(meal.Extra) > 0 {
+            meal.Status = MealModified
+        }
+    }
+    return meal
+}
+
+// Valori ricalcolati dal catalogo per le quantità indicate
+func (g *Generator) intake(items []Food) Intake {
+    calories, macros := g.sumItems(items)
+    return Intake{Calories: math.Round(calories), Macros: macros.rounded()}
+}
+
+func calorieAdherence(planned, eaten float64) float64 {
+    if planned <= 0 {
+        return 0
+    }
+    return roundScore(1 - math.Min(1, math.Abs(eaten-planned)/planned))
+}
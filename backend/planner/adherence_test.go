@@ -0,0 +1,156 @@
+package planner
+
+import (
+    "reflect"
+    "testing"
+)
+
+func TestDayAdherence(t *testing.T) {
+    g := testGenerator(t)
+    food := func(key string, quantity float64) Food {
+        rule, _ := g.catalog.Food(key)
+        return newFood(key, rule, quantity)
+    }
+    // Pranzo da 408 + 264 + 34 = 706 kcal
+    lunch := []Food{food("pasta_integrale", 120), food("petto_pollo", 160), food("zucchine", 200)}
+    plan := MealPlan{Slots: []SlotMeal{{Name: "pranzo", Profile: "pranzo", Share: 1, Meal: Meal{Items: lunch}}}}
+
+    tests := []struct {
+        name          string
+        eaten         map[string][]Food
+        logged        bool
+        status        string
+        substitutions int
+        missing       []string
+        extra         []string
+        adherence     float64
+    }{
+        {
+            name:   "nothing logged",
+            eaten:  map[string][]Food{},
+            status: MealSkipped,
+        },
+        {
+            name:      "followed",
+            eaten:     map[string][]Food{"pranzo": lunch},
+            logged:    true,
+            status:    MealFollowed,
+            adherence: 1,
+        },
+        {
+            name:          "same category swap",
+            eaten:         map[string][]Food{"pranzo": {food("riso_basmati", 100), food("petto_pollo", 160), food("zucchine", 200)}},
+            logged:        true,
+            status:        MealModified,
+            substitutions: 1,
+            // 648 kcal su 706
+            adherence:     0.918,
+        },
+        {
+            name:      "missing and extra foods",
+            eaten:     map[string][]Food{"pranzo": {food("pasta_integrale", 120), food("petto_pollo", 160), food("frutta_fresca", 150)}},
+            logged:    true,
+            status:    MealModified,
+            missing:   []string{"Zucchine"},
+            extra:     []string{"Frutta fresca"},
+            // 747 kcal su 706
+            adherence: 0.942,
+        },
+        {
+            name:      "double portion",
+            eaten:     map[string][]Food{"pranzo": {food("pasta_integrale", 240), food("petto_pollo", 320), food("zucchine", 400)}},
+            logged:    true,
+            status:    MealFollowed,
+            adherence: 0,
+        },
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            day := g.DayAdherence(plan, "2026-10-12", tt.eaten)
+            meal := day.Meals[0]
+            if day.Logged != tt.logged {
+                t.Errorf("logged = %v, want %v", day.Logged, tt.logged)
+            }
+            if meal.Status != tt.status {
+                t.Errorf("status = %q, want %q", meal.Status, tt.status)
+            }
+            if day.Substitutions != tt.substitutions {
+                t.Errorf("substitutions = %d, want %d", day.Substitutions, tt.substitutions)
+            }
+            if !reflect.DeepEqual(meal.Missing, tt.missing) || !reflect.DeepEqual(meal.Extra, tt.extra) {
+                t.Errorf("missing %v, extra %v, want %v and %v", meal.Missing, meal.Extra, tt.missing, tt.extra)
+            }
+            if day.CalorieAdherence != tt.adherence {
+                t.Errorf("calorie adherence = %g, want %g", day.CalorieAdherence, tt.adherence)
+            }
+            if day.CalorieDifference != day.Eaten.Calories-day.Planned.Calories {
+                t.Errorf("calorie difference = %g, want %g", day.CalorieDifference, day.Eaten.Calories-day.Planned.Calories)
+            }
+        })
+    }
+}
+
+func TestDayAdherenceUnplannedMeal(t *testing.T) {
+    g := testGenerator(t)
+    fruit, _ := g.catalog.Food("frutta_fresca")
+    chicken, _ := g.catalog.Food("petto_pollo")
+    lunch := SlotMeal{Name: "pranzo", Profile: "pranzo", Share: 1, Meal: Meal{Items: []Food{newFood("petto_pollo", chicken, 160)}}}
+    day := g.DayAdherence(MealPlan{Slots: []SlotMeal{lunch}}, "2026-10-12", map[string][]Food{"merenda": {newFood("frutta_fresca", fruit, 150)}})
+
+    statuses := make(map[string]string)
+    for _, meal := range day.Meals {
+        statuses[meal.Meal] = meal.Status
+    }
+    want := map[string]string{"pranzo": MealSkipped, "merenda": MealUnplanned}
+    if !reflect.DeepEqual(statuses, want) {
+        t.Errorf("statuses %v, want %v", statuses, want)
+    }
+    if !reflect.DeepEqual(day.SkippedMeals, []string{"pranzo"}) {
+        t.Errorf("skipped meals %v, want [pranzo]", day.SkippedMeals)
+    }
+}
+
+func TestCalorieAdherence(t *testing.T) {
+    tests := []struct {
+        planned, eaten, want float64
+    }{
+        {planned: 2000, eaten: 2000, want: 1},
+        {planned: 2000, eaten: 1800, want: 0.9},
+        {planned: 2000, eaten: 2300, want: 0.85},
+        {planned: 2000, eaten: 4500, want: 0},
+        {planned: 2000, eaten: 0, want: 0},
+        {planned: 0, eaten: 500, want: 0},
+    }
+    for _, tt := range tests {
+        if got := calorieAdherence(tt.planned, tt.eaten); got != tt.want {
+            t.Errorf("calorieAdherence(%g, %g) = %g, want %g", tt.planned, tt.eaten, got, tt.want)
+        }
+    }
+}
+
+func TestWeekAdherenceOf(t *testing.T) {
+    days := []DayAdherence{
+        {Date: "2026-10-12", Logged: true, Planned: Intake{Calories: 2000}, Eaten: Intake{Calories: 1800}, CalorieAdherence: 0.9, SkippedMeals: []string{"merenda"}, Substitutions: 1},
+        {Date: "2026-10-13", Logged: true, Planned: Intake{Calories: 2000}, Eaten: Intake{Calories: 2100}, CalorieAdherence: 0.95, Substitutions: 2},
+        // Giorno senza registrazioni: escluso dai totali e dalla media
+        {Date: "2026-10-14", Planned: Intake{Calories: 2000}, SkippedMeals: []string{"colazione", "pranzo"}},
+    }
+    week := WeekAdherenceOf("2026-10-12", "2026-10-14", days)
+
+    want := WeekAdherence{
+        From:              "2026-10-12",
+        To:                "2026-10-14",
+        LoggedDays:        2,
+        Planned:           Intake{Calories: 4000},
+        Eaten:             Intake{Calories: 3900},
+        CalorieDifference: -100,
+        CalorieAdherence:  0.925,
+        SkippedMeals:      1,
+        Substitutions:     3,
+        Days:              days,
+    }
+    if !reflect.DeepEqual(week, want) {
+        t.Errorf("got %+v, want %+v", week, want)
+    }
+}
@@ -0,0 +1,173 @@
+package planner
+
+import (
+    "fmt"
+    "sort"
+    "strings"
+)
+
+// Catalogo degli alimenti usato dal generatore; le liste di chiavi sono
+// ordinate, così che a parità di seed il risultato non cambi
+type Catalog interface {
+    Food(key string) (FoodRules, bool)
+    Keys() []string
+    FoodsInCategory(category string) []string
+    FoodsForMeal(mealType string) []string
+}
+
+// Catalogo in memoria costruito da una mappa chiave -> alimento
+type MapCatalog struct {
+    foods      map[string]FoodRules
+    keys       []string
+    byCategory map[string][]string
+    byMeal     map[string][]string
+}
+
+func NewMapCatalog(foods map[string]FoodRules) *MapCatalog {
+    catalog := &MapCatalog{
+        foods:      make(map[string]FoodRules, len(foods)),
+        byCategory: make(map[string][]string),
+        byMeal:     make(map[string][]string),
+    }
+    for _, key := range SortedKeys(foods) {
+        food := foods[key]
+        catalog.foods[key] = food
+        catalog.keys = append(catalog.keys, key)
+        catalog.byCategory[food.Category] = append(catalog.byCategory[food.Category], key)
+        for _, mealType := range food.MealTypes {
+            catalog.byMeal[mealType] = append(catalog.byMeal[mealType], key)
+        }
+    }
+    return catalog
+}
+
+func (c *MapCatalog) Food(key string) (FoodRules, bool) {
+    food, exists := c.foods[key]
+    return food, exists
+}
+
+func (c *MapCatalog) Keys() []string {
+    return c.keys
+}
+
+func (c *MapCatalog) FoodsInCategory(category string) []string {
+    return c.byCategory[category]
+}
+
+func (c *MapCatalog) FoodsForMeal(mealType string) []string {
+    return c.byMeal[mealType]
+}
+
+// Categorie di alimenti riconosciute dal generatore
+var knownCategories = map[string]bool{
+    "beverage":  true,
+    "carb":      true,
+    "protein":   true,
+    "vegetable": true,
+    "fruit":     true,
+    "fat":       true,
+}
+
+// Controlla regole e alimenti insieme e restituisce tutti i problemi trovati
+func ValidateCatalog(foods map[string]FoodRules, rules map[string]MealRules) []string {
+    var problems []string
+    problems = append(problems, ValidateMealRules(rules)...)
+    problems = append(problems, ValidateFoods(foods, rules)...)
+    return problems
+}
+
+func ValidateMealRules(rules map[string]MealRules) []string {
+    var problems []string
+    if len(rules) == 0 {
+        problems = append(problems, "meal rules: no meal types defined")
+    }
+
+    for _, mealType := range SortedKeys(rules) {
+        rule := rules[mealType]
+        for _, category := range rule.RequiredCategories {
+            if !knownCategories[category] {
+                problems = append(problems, fmt.Sprintf("meal %q: unknown required category %q", mealType, category))
+            }
+        }
+        for category, limit := range rule.CategoryLimits {
+            if !knownCategories[category] {
+                problems = append(problems, fmt.Sprintf("meal %q: unknown category %q in categoryLimits", mealType, category))
+            }
+            if limit <= 0 {
+                problems = append(problems, fmt.Sprintf("meal %q: categoryLimits[%q] must be positive", mealType, category))
+            }
+        }
+        if rule.MinProtein < 0 || rule.MinCarbs < 0 || rule.MaxFat < 0 {
+            problems = append(problems, fmt.Sprintf("meal %q: macro limits must not be negative", mealType))
+        }
+    }
+    return problems
+}
+
+func ValidateFoods(foods map[string]FoodRules, rules map[string]MealRules) []string {
+    var problems []string
+    if len(foods) == 0 {
+        problems = append(problems, "foods: catalog is empty")
+    }
+
+    for _, key := range SortedKeys(foods) {
+        for _, problem := range ValidateFood(foods[key], rules) {
+            problems = append(problems, fmt.Sprintf("food %q: %s", key, problem))
+        }
+    }
+    return problems
+}
+
+// Controlla un singolo alimento rispetto alle regole dei pasti
+func ValidateFood(food FoodRules, rules map[string]MealRules) []string {
+    var problems []string
+    if strings.TrimSpace(food.Name) == "" {
+        problems = append(problems, "name is required")
+    }
+    if food.Unit == "" {
+        problems = append(problems, "unit is required")
+    }
+    if !knownCategories[food.Category] {
+        problems = append(problems, fmt.Sprintf("unknown category %q", food.Category))
+    }
+    if food.CaloriesPer100g < 0 || food.ProteinPer100g < 0 || food.CarbsPer100g < 0 || food.FatPer100g < 0 || food.FiberPer100g < 0 {
+        problems = append(problems, "nutritional values must not be negative")
+    }
+    if food.MinPortion <= 0 || food.StandardPortion <= 0 {
+        problems = append(problems, "standardPortion and minPortion must be positive")
+    }
+    if food.MinPortion > food.MaxPortion {
+        problems = append(problems, fmt.Sprintf("minPortion %g is greater than maxPortion %g", food.MinPortion, food.MaxPortion))
+    } else if food.StandardPortion < food.MinPortion || food.StandardPortion > food.MaxPortion {
+        problems = append(problems, fmt.Sprintf("standardPortion %g is outside [%g, %g]", food.StandardPortion, food.MinPortion, food.MaxPortion))
+    }
+    if food.PackageSize < 0 {
+        problems = append(problems, "packageSize must not be negative")
+    }
+    if food.Frequency < 0 {
+        problems = append(problems, "frequency must not be negative")
+    }
+    if food.Required && food.Frequency > 0 && food.Frequency < len(weekDays) {
+        problems = append(problems, fmt.Sprintf("frequency %d is too low for a required food: it must be 0 (no limit) or at least %d, one per day", food.Frequency, len(weekDays)))
+    }
+    problems = append(problems, validateDietTags(food)...)
+    if len(food.MealTypes) == 0 {
+        problems = append(problems, "at least one meal type is required")
+    }
+    for _, mealType := range food.MealTypes {
+        if _, exists := rules[mealType]; !exists {
+            problems = append(problems, fmt.Sprintf("unknown meal type %q", mealType))
+        }
+    }
+    return problems
+}
+
+// Chiavi della mappa in ordine alfabetico, per iterare in modo deterministico
+func SortedKeys[V any](m map[string]V) []string {
+    keys := make([]string, 0, len(m))
+    for key := range m {
+        keys = append(keys, key)
+    }
+    sort.Strings(keys)
+    return keys
+}
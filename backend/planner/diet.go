@@ -0,0 +1,143 @@
+package planner
+
+import (
+    "fmt"
+    "strings"
+)
+
+// Allergeni ed esclusioni indicati negli alimenti del catalogo; "meat" segna
+// carne e salumi, esclusi dai regimi vegetariani
+var knownAllergens = map[string]bool{
+    "lactose": true,
+    "gluten":  true,
+    "fish":    true,
+    "egg":     true,
+    "meat":    true,
+}
+
+// Regimi alimentari; per ognuno gli allergeni che un alimento compatibile
+// non può contenere
+var knownDiets = map[string][]string{
+    "vegetarian":   {"fish", "meat"},
+    "vegan":        {"fish", "meat", "egg", "lactose"},
+    "pescatarian":  {"meat"},
+    "gluten-free":  {"gluten"},
+    "lactose-free": {"lactose"},
+}
+
+// Vincoli sugli alimenti (chiavi del catalogo) per un pasto: i vietati non
+// vengono mai usati, quelli da evitare solo se non c'è alternativa; i bloccati
+// restano nel pasto con la quantità indicata
+type foodConstraints struct {
+    Forbidden map[string]bool
+    Avoid     map[string]bool
+    // Volte in cui ogni alimento è già stato usato: tra quelli da evitare si
+    // ripiega prima sui meno usati
+    Uses      map[string]int
+    Locked    []Food
+    // Se vero, gli alimenti del pasto riportano il motivo della scelta
+    Explain   bool
+}
+
+func (c foodConstraints) allows(key string) bool {
+    return !c.Forbidden[key] && !c.Avoid[key]
+}
+
+// Controlla che allergeni e regimi dichiarati da un alimento siano noti e coerenti
+func validateDietTags(food FoodRules) []string {
+    var problems []string
+    for _, allergen := range food.Allergens {
+        if !knownAllergens[allergen] {
+            problems = append(problems, fmt.Sprintf("unknown allergen %q", allergen))
+        }
+    }
+    for _, diet := range food.Diets {
+        excluded, exists := knownDiets[diet]
+        if !exists {
+            problems = append(problems, fmt.Sprintf("unknown diet %q", diet))
+            continue
+        }
+        for _, allergen := range excluded {
+            if containsString(food.Allergens, allergen) {
+                problems = append(problems, fmt.Sprintf("diet %q conflicts with allergen %q", diet, allergen))
+            }
+        }
+    }
+    return problems
+}
+
+// Nessun alimento ammesso dai vincoli può coprire una categoria obbligatoria
+type UnsatisfiableError struct {
+    Meal     string
+    Category string
+}
+
+func (e *UnsatisfiableError) Error() string {
+    return fmt.Sprintf("meal %q: no food in required category %q satisfies the requested allergens and diets", e.Meal, e.Category)
+}
+
+// Traduce allergeni esclusi e regimi richiesti negli alimenti vietati
+func (g *Generator) resolveConstraints(excludeAllergens, diets []string) (foodConstraints, error) {
+    for _, allergen := range excludeAllergens {
+        if !knownAllergens[allergen] {
+            return foodConstraints{}, fmt.Errorf("unknown allergen %q, expected one of %s", allergen, strings.Join(SortedKeys(knownAllergens), ", "))
+        }
+    }
+    for _, diet := range diets {
+        if _, exists := knownDiets[diet]; !exists {
+            return foodConstraints{}, fmt.Errorf("unknown diet %q, expected one of %s", diet, strings.Join(SortedKeys(knownDiets), ", "))
+        }
+    }
+
+    forbidden := make(map[string]bool)
+    for _, key := range g.catalog.Keys() {
+        rule, _ := g.catalog.Food(key)
+        for _, allergen := range excludeAllergens {
+            if containsString(rule.Allergens, allergen) {
+                forbidden[key] = true
+            }
+        }
+        // Un alimento è compatibile con un regime solo se lo dichiara e non
+        // contiene nessuno degli allergeni che il regime esclude
+        for _, diet := range diets {
+            if !containsString(rule.Diets, diet) {
+                forbidden[key] = true
+            }
+            for _, allergen := range knownDiets[diet] {
+                if containsString(rule.Allergens, allergen) {
+                    forbidden[key] = true
+                }
+            }
+        }
+    }
+    return foodConstraints{Forbidden: forbidden}, nil
+}
+
+// Verifica che ogni categoria obbligatoria degli slot abbia almeno un
+// alimento ammesso dai vincoli
+func (g *Generator) checkConstraints(slots []MealSlot, constraints foodConstraints) error {
+    for _, slot := range slots {
+        for _, category := range g.rules[slot.Profile].RequiredCategories {
+            available := false
+            for _, key := range g.foodsFor(category, slot.Profile) {
+                if !constraints.Forbidden[key] {
+                    available = true
+                    break
+                }
+            }
+            if !available {
+                return &UnsatisfiableError{Meal: slot.Name, Category: category}
+            }
+        }
+    }
+    return nil
+}
+
+func containsString(values []string, value string) bool {
+    for _, v := range values {
+        if v == value {
+            return true
+        }
+    }
+    return false
+}
@@ -0,0 +1,53 @@
+package planner
+
+import (
+    "testing"
+)
+
+func TestValidateDietTags(t *testing.T) {
+    tests := []struct {
+        name      string
+        allergens []string
+        diets     []string
+        valid     bool
+    }{
+        {name: "meat without vegetarian diets", allergens: []string{"meat"}, diets: []string{"gluten-free", "lactose-free"}, valid: true},
+        {name: "meat tagged vegetarian", allergens: []string{"meat"}, diets: []string{"vegetarian"}},
+        {name: "meat tagged pescatarian", allergens: []string{"meat"}, diets: []string{"pescatarian"}},
+        {name: "fish tagged pescatarian", allergens: []string{"fish"}, diets: []string{"pescatarian", "gluten-free"}, valid: true},
+        {name: "egg tagged vegan", allergens: []string{"egg"}, diets: []string{"vegan"}},
+        {name: "unknown allergen", allergens: []string{"nuts"}},
+        {name: "unknown diet", diets: []string{"keto"}},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            problems := validateDietTags(FoodRules{Allergens: tt.allergens, Diets: tt.diets})
+            if (len(problems) == 0) != tt.valid {
+                t.Errorf("problems %v, want valid %v", problems, tt.valid)
+            }
+        })
+    }
+}
+
+func TestResolveConstraintsChecksDietAllergens(t *testing.T) {
+    g := testGenerator(t)
+    // Un alimento di carne dichiarato vegetariano resta vietato ai vegetariani
+    rule, _ := g.catalog.Food("petto_pollo")
+    rule.Diets = append(rule.Diets, "vegetarian")
+    g.catalog.(*MapCatalog).foods["petto_pollo"] = rule
+
+    constraints, err := g.resolveConstraints(nil, []string{"vegetarian"})
+    if err != nil {
+        t.Fatal(err)
+    }
+    for _, key := range []string{"petto_pollo", "tacchino_petto", "prosciutto_cotto", "merluzzo"} {
+        if !constraints.Forbidden[key] {
+            t.Errorf("%s allowed in a vegetarian plan", key)
+        }
+    }
+    for _, key := range []string{"tofu", "uova_intere", "lenticchie"} {
+        if constraints.Forbidden[key] {
+            t.Errorf("%s forbidden in a vegetarian plan", key)
+        }
+    }
+}
@@ -0,0 +1,174 @@
+package planner
+
+import (
+    "fmt"
+    "math"
+)
+
+// Dati della persona per stimare il fabbisogno energetico
+type Biometrics struct {
+    Sex           string  `json:"sex"`
+    Age           int     `json:"age"`
+    HeightCm      float64 `json:"heightCm"`
+    WeightKg      float64 `json:"weightKg"`
+    ActivityLevel string  `json:"activityLevel"`
+    Goal          string  `json:"goal"`
+}
+
+type MacroTargets struct {
+    ProteinGrams float64 `json:"proteinGrams"`
+    CarbsGrams   float64 `json:"carbsGrams"`
+    FatGrams     float64 `json:"fatGrams"`
+    ProteinPct   float64 `json:"proteinPct"`
+    CarbsPct     float64 `json:"carbsPct"`
+    FatPct       float64 `json:"fatPct"`
+}
+
+// Passaggi del calcolo restituiti insieme al piano
+type EnergyCalculation struct {
+    BMRMifflinStJeor  float64      `json:"bmrMifflinStJeor"`
+    BMRHarrisBenedict float64      `json:"bmrHarrisBenedict"`
+    ActivityFactor    float64      `json:"activityFactor"`
+    TDEE              float64      `json:"tdee"`
+    GoalAdjustment    float64      `json:"goalAdjustment"`
+    TargetCalories    float64      `json:"targetCalories"`
+    Macros            MacroTargets `json:"macros"`
+    Notes             []string     `json:"notes,omitempty"`
+}
+
+// Moltiplicatori del metabolismo basale per livello di attività
+var activityFactors = map[string]float64{
+    "sedentary":   1.2,
+    "light":       1.375,
+    "moderate":    1.55,
+    "active":      1.725,
+    "very_active": 1.9,
+}
+
+// Variazione del TDEE per obiettivo e proteine in g per kg di peso
+var goalSettings = map[string]struct {
+    Adjustment   float64
+    ProteinPerKg float64
+}{
+    "lose":     {Adjustment: -0.20, ProteinPerKg: 2.0},
+    "maintain": {Adjustment: 0, ProteinPerKg: 1.6},
+    "gain":     {Adjustment: 0.10, ProteinPerKg: 1.8},
+}
+
+const (
+    // Quota di calorie dai grassi nella ripartizione dei macronutrienti
+    fatShare = 0.28
+    // Calorie minime sotto cui non si scende in una fase di dimagrimento
+    minCaloriesFemale = 1200
+    minCaloriesMale   = 1500
+)
+
+func (b Biometrics) validate() error {
+    if b.Sex != "male" && b.Sex != "female" {
+        return fmt.Errorf("sex must be \"male\" or \"female\"")
+    }
+    if b.Age < 18 || b.Age > 100 {
+        return fmt.Errorf("age must be between 18 and 100")
+    }
+    if b.HeightCm < 120 || b.HeightCm > 230 {
+        return fmt.Errorf("heightCm must be between 120 and 230")
+    }
+    if b.WeightKg < 35 || b.WeightKg > 300 {
+        return fmt.Errorf("weightKg must be between 35 and 300")
+    }
+    if _, ok := activityFactors[b.ActivityLevel]; !ok {
+        return fmt.Errorf("unknown activityLevel %q", b.ActivityLevel)
+    }
+    if _, ok := goalSettings[b.Goal]; !ok {
+        return fmt.Errorf("goal must be \"lose\", \"maintain\" or \"gain\"")
+    }
+    return nil
+}
+
+func mifflinStJeor(b Biometrics) float64 {
+    bmr := 10*b.WeightKg + 6.25*b.HeightCm - 5*float64(b.Age)
+    if b.Sex == "male" {
+        return bmr + 5
+    }
+    return bmr - 161
+}
+
+// Formula di Harris-Benedict rivista da Roza e Shizgal (1984)
+func harrisBenedict(b Biometrics) float64 {
+    if b.Sex == "male" {
+        return 88.362 + 13.397*b.WeightKg + 4.799*b.HeightCm - 5.677*float64(b.Age)
+    }
+    return 447.593 + 9.247*b.WeightKg + 3.098*b.HeightCm - 4.330*float64(b.Age)
+}
+
+// Calcola il fabbisogno: il TDEE parte dal BMR di Mifflin-St Jeor, il più
+// affidabile dei due; Harris-Benedict è riportato come confronto
+func CalculateEnergy(b Biometrics) (EnergyCalculation, error) {
+    if err := b.validate(); err != nil {
+        return EnergyCalculation{}, err
+    }
+
+    calc := EnergyCalculation{
+        BMRMifflinStJeor:  math.Round(mifflinStJeor(b)),
+        BMRHarrisBenedict: math.Round(harrisBenedict(b)),
+        ActivityFactor:    activityFactors[b.ActivityLevel],
+    }
+    calc.TDEE = math.Round(calc.BMRMifflinStJeor * calc.ActivityFactor)
+
+    goal := goalSettings[b.Goal]
+    calc.GoalAdjustment = math.Round(calc.TDEE * goal.Adjustment)
+    calc.TargetCalories = calc.TDEE + calc.GoalAdjustment
+
+    minimum := float64(minCaloriesFemale)
+    if b.Sex == "male" {
+        minimum = minCaloriesMale
+    }
+    if calc.TargetCalories < minimum {
+        calc.Notes = append(calc.Notes, fmt.Sprintf("target alzato da %.0f al minimo di %.0f kcal", calc.TargetCalories, minimum))
+        calc.GoalAdjustment += minimum - calc.TargetCalories
+        calc.TargetCalories = minimum
+    }
+
+    // Proteine in base al peso, grassi a quota fissa, carboidrati il resto
+    protein := goal.ProteinPerKg * b.WeightKg
+    fat := calc.TargetCalories * fatShare / 9
+    carbs := (calc.TargetCalories - protein*4 - fat*9) / 4
+    if carbs < 0 {
+        calc.Notes = append(calc.Notes, "proteine ridotte per lasciare spazio ai grassi")
+        carbs = 0
+        protein = (calc.TargetCalories - fat*9) / 4
+    }
+    calc.Macros = MacroTargets{
+        ProteinGrams: math.Round(protein),
+        CarbsGrams:   math.Round(carbs),
+        FatGrams:     math.Round(fat),
+        ProteinPct:   roundTo1(protein * 4 / calc.TargetCalories * 100),
+        CarbsPct:     roundTo1(carbs * 4 / calc.TargetCalories * 100),
+        FatPct:       roundTo1(fat * 9 / calc.TargetCalories * 100),
+    }
+    return calc, nil
+}
+
+// Calorie da usare per il piano: quelle indicate dal client hanno la
+// precedenza, altrimenti si calcolano dai dati biometrici
+func resolveTargetCalories(request PlanRequest) (float64, *EnergyCalculation, error) {
+    if request.TargetCalories < 0 {
+        return 0, nil, fmt.Errorf("targetCalories must be positive")
+    }
+    if request.Biometrics == nil {
+        if request.TargetCalories == 0 {
+            return 0, nil, fmt.Errorf("targetCalories or biometrics is required")
+        }
+        return float64(request.TargetCalories), nil, nil
+    }
+
+    calc, err := CalculateEnergy(*request.Biometrics)
+    if err != nil {
+        return 0, nil, err
+    }
+    if request.TargetCalories > 0 {
+        calc.Notes = append(calc.Notes, fmt.Sprintf("il piano usa le %d kcal richieste invece del target calcolato", request.TargetCalories))
+        return float64(request.TargetCalories), &calc, nil
+    }
+    return calc.TargetCalories, &calc, nil
+}
@@ -0,0 +1,127 @@
+package planner
+
+import (
+    "reflect"
+    "testing"
+)
+
+func TestCalculateEnergy(t *testing.T) {
+    tests := []struct {
+        name       string
+        biometrics Biometrics
+        want       EnergyCalculation
+    }{
+        {
+            // Mifflin 10·80 + 6,25·180 − 5·30 + 5 = 1780; Harris-Benedict 1853,6
+            name:       "male, moderate, maintain",
+            biometrics: Biometrics{Sex: "male", Age: 30, HeightCm: 180, WeightKg: 80, ActivityLevel: "moderate", Goal: "maintain"},
+            want: EnergyCalculation{
+                BMRMifflinStJeor: 1780, BMRHarrisBenedict: 1854, ActivityFactor: 1.55, TDEE: 2759, GoalAdjustment: 0, TargetCalories: 2759,
+                Macros: MacroTargets{ProteinGrams: 128, CarbsGrams: 369, FatGrams: 86, ProteinPct: 18.6, CarbsPct: 53.4, FatPct: 28},
+            },
+        },
+        {
+            // Mifflin 10·60 + 6,25·165 − 5·30 − 161 = 1320,25; Harris-Benedict 1383,7
+            name:       "female, sedentary, lose",
+            biometrics: Biometrics{Sex: "female", Age: 30, HeightCm: 165, WeightKg: 60, ActivityLevel: "sedentary", Goal: "lose"},
+            want: EnergyCalculation{
+                BMRMifflinStJeor: 1320, BMRHarrisBenedict: 1384, ActivityFactor: 1.2, TDEE: 1584, GoalAdjustment: -317, TargetCalories: 1267,
+                Macros: MacroTargets{ProteinGrams: 120, CarbsGrams: 108, FatGrams: 39, ProteinPct: 37.9, CarbsPct: 34.1, FatPct: 28},
+            },
+        },
+        {
+            name:       "female below the 1200 kcal floor",
+            biometrics: Biometrics{Sex: "female", Age: 60, HeightCm: 155, WeightKg: 50, ActivityLevel: "sedentary", Goal: "lose"},
+            want: EnergyCalculation{
+                BMRMifflinStJeor: 1008, BMRHarrisBenedict: 1130, ActivityFactor: 1.2, TDEE: 1210, GoalAdjustment: -10, TargetCalories: 1200,
+                Macros: MacroTargets{ProteinGrams: 100, CarbsGrams: 116, FatGrams: 37, ProteinPct: 33.3, CarbsPct: 38.7, FatPct: 28},
+                Notes:  []string{"target alzato da 968 al minimo di 1200 kcal"},
+            },
+        },
+        {
+            name:       "male below the 1500 kcal floor",
+            biometrics: Biometrics{Sex: "male", Age: 70, HeightCm: 160, WeightKg: 55, ActivityLevel: "sedentary", Goal: "lose"},
+            want: EnergyCalculation{
+                BMRMifflinStJeor: 1205, BMRHarrisBenedict: 1196, ActivityFactor: 1.2, TDEE: 1446, GoalAdjustment: 54, TargetCalories: 1500,
+                Macros: MacroTargets{ProteinGrams: 110, CarbsGrams: 160, FatGrams: 47, ProteinPct: 29.3, CarbsPct: 42.7, FatPct: 28},
+                Notes:  []string{"target alzato da 1157 al minimo di 1500 kcal"},
+            },
+        },
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            got, err := CalculateEnergy(tt.biometrics)
+            if err != nil {
+                t.Fatal(err)
+            }
+            if !reflect.DeepEqual(got, tt.want) {
+                t.Errorf("got %+v, want %+v", got, tt.want)
+            }
+        })
+    }
+}
+
+func TestCalculateEnergyRejectsInvalidBiometrics(t *testing.T) {
+    valid := Biometrics{Sex: "female", Age: 30, HeightCm: 165, WeightKg: 60, ActivityLevel: "light", Goal: "maintain"}
+    tests := []struct {
+        name   string
+        change func(*Biometrics)
+    }{
+        {name: "sex", change: func(b *Biometrics) { b.Sex = "other" }},
+        {name: "age", change: func(b *Biometrics) { b.Age = 16 }},
+        {name: "height", change: func(b *Biometrics) { b.HeightCm = 250 }},
+        {name: "weight", change: func(b *Biometrics) { b.WeightKg = 20 }},
+        {name: "activity level", change: func(b *Biometrics) { b.ActivityLevel = "extreme" }},
+        {name: "goal", change: func(b *Biometrics) { b.Goal = "bulk" }},
+    }
+    for _, tt := range tests {
+        biometrics := valid
+        tt.change(&biometrics)
+        if _, err := CalculateEnergy(biometrics); err == nil {
+            t.Errorf("%s: expected an error", tt.name)
+        }
+    }
+}
+
+func TestResolveTargetCalories(t *testing.T) {
+    biometrics := &Biometrics{Sex: "female", Age: 35, HeightCm: 165, WeightKg: 62, ActivityLevel: "light", Goal: "maintain"}
+    tests := []struct {
+        name       string
+        request    PlanRequest
+        want       float64
+        wantEnergy bool
+        wantErr    bool
+    }{
+        {name: "explicit target", request: PlanRequest{TargetCalories: 1800}, want: 1800},
+        {name: "explicit target wins over biometrics", request: PlanRequest{TargetCalories: 1800, Biometrics: biometrics}, want: 1800, wantEnergy: true},
+        {name: "target from biometrics", request: PlanRequest{Biometrics: biometrics}, wantEnergy: true},
+        {name: "zero target", request: PlanRequest{TargetCalories: 0}, wantErr: true},
+        {name: "negative target", request: PlanRequest{TargetCalories: -500}, wantErr: true},
+        {name: "negative target with biometrics", request: PlanRequest{TargetCalories: -500, Biometrics: biometrics}, wantErr: true},
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            target, energy, err := resolveTargetCalories(tt.request)
+            if tt.wantErr {
+                if err == nil {
+                    t.Fatalf("expected an error, got %g kcal", target)
+                }
+                return
+            }
+            if err != nil {
+                t.Fatal(err)
+            }
+            if (energy != nil) != tt.wantEnergy {
+                t.Errorf("energy = %v, want present: %v", energy, tt.wantEnergy)
+            }
+            if tt.want == 0 && energy != nil {
+                tt.want = energy.TargetCalories
+            }
+            if target != tt.want || target <= 0 {
+                t.Errorf("target %g kcal, want %g", target, tt.want)
+            }
+        })
+    }
+}
@@ -0,0 +1,81 @@
+package planner
+
+import (
+    "fmt"
+    "math"
+)
+
+// Origine di un alimento nel pasto
+const (
+    SourceUserIngredient   = "user_ingredient"
+    SourceLocked           = "locked"
+    SourceRequiredCategory = "required_category"
+    SourceSnackFallback    = "snack_fallback"
+    SourceMacroRepair      = "macro_repair"
+    SourceLeanerSwap       = "leaner_swap"
+    SourceCalorieFill      = "calorie_fill"
+)
+
+// Motivi per cui un candidato è stato scartato durante la costruzione del pasto
+const (
+    RejectedCategoryLimit = "category_limit"
+    RejectedCalorieBudget = "calorie_budget"
+)
+
+// Perché un alimento è nel pasto; presente solo con explain
+type FoodExplanation struct {
+    Source string `json:"source"`
+    Reason string `json:"reason"`
+}
+
+// Un alimento provato e scartato per i limiti di categoria o il budget calorico
+type RejectedCandidate struct {
+    Key      string  `json:"key"`
+    Category string  `json:"category"`
+    Source   string  `json:"source"`
+    Reason   string  `json:"reason"`
+    Calories float64 `json:"calories"`
+    Message  string  `json:"message"`
+}
+
+// Annota l'ultimo alimento aggiunto al pasto
+func explainLast(items []Food, source, reason string) {
+    items[len(items)-1].Explanation = &FoodExplanation{Source: source, Reason: reason}
+}
+
+// Scarto per budget: si riporta la porzione più piccola, l'ultima provata
+func budgetRejection(key string, rule FoodRules, source string, totalCalories, targetCalories float64) RejectedCandidate {
+    calories := calculateCalories(smallestPortion(rule), rule.CaloriesPer100g)
+    return RejectedCandidate{
+        Key:      key,
+        Category: rule.Category,
+        Source:   source,
+        Reason:   RejectedCalorieBudget,
+        Calories: calories,
+        Message:  fmt.Sprintf("%s (%.0f kcal) supera le %.0f kcal disponibili nel pasto", rule.Name, calories, math.Max(0, targetCalories-totalCalories)),
+    }
+}
+
+func (g *Generator) categoryRejection(items []Food, key string, rule FoodRules, source string, rules MealRules) RejectedCandidate {
+    calories := calculateCalories(smallestPortion(rule), rule.CaloriesPer100g)
+    return RejectedCandidate{
+        Key:      key,
+        Category: rule.Category,
+        Source:   source,
+        Reason:   RejectedCategoryLimit,
+        Calories: calories,
+        Message: fmt.Sprintf("%s (%.0f kcal) supera il limite di %s: %.0f kcal già usate su %.0f", rule.Name, calories,
+            categoryDisplayNames[rule.Category], g.getCategoryCalories(items, rule.Category), rules.CategoryLimits[rule.Category]),
+    }
+}
+
+// Toglie le spiegazioni quando non sono state richieste
+func (m *Meal) stripExplanations() {
+    items := make([]Food, len(m.Items))
+    for i, item := range m.Items {
+        item.Explanation = nil
+        items[i] = item
+    }
+    m.Items = items
+    m.Rejected = nil
+}
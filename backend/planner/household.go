@@ -0,0 +1,211 @@
+package planner
+
+import (
+    "errors"
+    "fmt"
+    "math"
+    "math/rand"
+    "strings"
+)
+
+// Componente della famiglia con il proprio target calorico e le proprie esclusioni
+type HouseholdMember struct {
+    Name             string      `json:"name"`
+    TargetCalories   int         `json:"targetCalories"`
+    // In alternativa a targetCalories, il target viene calcolato da questi dati
+    Biometrics       *Biometrics `json:"biometrics"`
+    ExcludeAllergens []string    `json:"excludeAllergens"`
+    Diets            []string    `json:"diets"`
+}
+
+type HouseholdRequest struct {
+    Members     []HouseholdMember `json:"members"`
+    Ingredients []string          `json:"ingredients"`
+    Slots       []MealSlot        `json:"slots"`
+    // Slot consumati insieme; se assente, tutti i pasti sono condivisi
+    SharedMeals []string          `json:"sharedMeals"`
+    Seed        *int64            `json:"seed"`
+    Explain     bool              `json:"explain"`
+    // Raggruppamento della lista della spesa: "category" o "aisle"
+    GroupBy     string            `json:"groupBy"`
+}
+
+type MemberPlan struct {
+    Name           string  `json:"name"`
+    TargetCalories float64 `json:"targetCalories"`
+    MealPlan
+}
+
+type HouseholdPlan struct {
+    Members      []MemberPlan         `json:"members"`
+    SharedMeals  []string             `json:"sharedMeals"`
+    // Quantità complessive da acquistare per tutti i componenti
+    ShoppingList ShoppingList         `json:"shoppingList"`
+    Unplaced     []UnplacedIngredient `json:"unplacedIngredients,omitempty"`
+    Seed         int64                `json:"seed"`
+}
+
+// Componente con target e vincoli già risolti
+type householdMember struct {
+    name        string
+    target      float64
+    energy      *EnergyCalculation
+    constraints foodConstraints
+}
+
+// Genera un piano per ogni componente: i pasti condivisi hanno gli stessi
+// alimenti per tutti, con le porzioni proporzionali al target di ciascuno
+func (g *Generator) GenerateHouseholdPlan(request HouseholdRequest) (HouseholdPlan, error) {
+    if len(request.Members) == 0 {
+        return HouseholdPlan{}, errors.New("at least one member is required")
+    }
+    slots, err := g.resolveSlots(request.Slots)
+    if err != nil {
+        return HouseholdPlan{}, err
+    }
+    shared, err := resolveSharedMeals(slots, request.SharedMeals)
+    if err != nil {
+        return HouseholdPlan{}, err
+    }
+    var sharedSlots, ownSlots []MealSlot
+    for _, slot := range slots {
+        if shared[slot.Name] {
+            sharedSlots = append(sharedSlots, slot)
+        } else {
+            ownSlots = append(ownSlots, slot)
+        }
+    }
+
+    members, err := g.resolveMembers(request.Members, ownSlots)
+    if err != nil {
+        return HouseholdPlan{}, err
+    }
+    // I pasti condivisi devono andare bene a tutti
+    sharedConstraints := foodConstraints{Forbidden: make(map[string]bool), Explain: request.Explain}
+    var meanTarget float64
+    for i := range members {
+        members[i].constraints.Explain = request.Explain
+        for key := range members[i].constraints.Forbidden {
+            sharedConstraints.Forbidden[key] = true
+        }
+        meanTarget += members[i].target / float64(len(members))
+    }
+    if err := g.checkConstraints(sharedSlots, sharedConstraints); err != nil {
+        return HouseholdPlan{}, err
+    }
+
+    seed := ResolveSeed(request.Seed)
+    rng := rand.New(rand.NewSource(seed))
+    usage := make(map[string]int)
+    plans := make([]MealPlan, len(members))
+    for _, slot := range slots {
+        rules := g.rules[slot.Profile]
+        if shared[slot.Name] {
+            // Il pasto viene generato per il target medio e poi adattato a ciascuno
+            meal := g.generateMealWithUserIngredients(rng, slot.Profile, prioritizeIngredients(request.Ingredients, usage), meanTarget*slot.Share, sharedConstraints)
+            g.recordUsage(meal, usage)
+            for i, member := range members {
+                plans[i].addMeal(slot, g.scaleMeal(meal, member.target/meanTarget, member.target*slot.Share, rules))
+            }
+            continue
+        }
+        for i, member := range members {
+            meal := g.generateMealWithUserIngredients(rng, slot.Profile, prioritizeIngredients(request.Ingredients, usage), member.target*slot.Share, member.constraints)
+            g.recordUsage(meal, usage)
+            plans[i].addMeal(slot, meal)
+        }
+    }
+
+    household := HouseholdPlan{Seed: seed}
+    for i, member := range members {
+        plans[i].computeTotals()
+        plans[i].Seed = &seed
+        plans[i].Energy = member.energy
+        household.Members = append(household.Members, MemberPlan{Name: member.name, TargetCalories: math.Round(member.target), MealPlan: plans[i]})
+    }
+    for _, slot := range sharedSlots {
+        household.SharedMeals = append(household.SharedMeals, slot.Name)
+    }
+    household.ShoppingList, err = g.buildShoppingList(plans, request.GroupBy)
+    if err != nil {
+        return HouseholdPlan{}, err
+    }
+    household.Unplaced = g.unplacedIngredients(request.Ingredients, slots, sharedConstraints, usage)
+    return household, nil
+}
+
+// Slot condivisi indicati per nome; senza indicazioni lo sono tutti
+func resolveSharedMeals(slots []MealSlot, names []string) (map[string]bool, error) {
+    shared := make(map[string]bool)
+    if names == nil {
+        for _, slot := range slots {
+            shared[slot.Name] = true
+        }
+        return shared, nil
+    }
+    for _, name := range names {
+        found := false
+        for _, slot := range slots {
+            if slot.Name == name {
+                found = true
+                break
+            }
+        }
+        if !found {
+            return nil, fmt.Errorf("shared meal %q is not part of the plan", name)
+        }
+        shared[name] = true
+    }
+    return shared, nil
+}
+
+func (g *Generator) resolveMembers(members []HouseholdMember, ownSlots []MealSlot) ([]householdMember, error) {
+    resolved := make([]householdMember, 0, len(members))
+    seen := make(map[string]bool)
+    for i, member := range members {
+        if strings.TrimSpace(member.Name) == "" {
+            return nil, fmt.Errorf("member %d: name is required", i)
+        }
+        if seen[member.Name] {
+            return nil, fmt.Errorf("member %q: duplicate name", member.Name)
+        }
+        seen[member.Name] = true
+
+        target, energy, err := resolveTargetCalories(PlanRequest{TargetCalories: member.TargetCalories, Biometrics: member.Biometrics})
+        if err != nil {
+            return nil, fmt.Errorf("member %q: %w", member.Name, err)
+        }
+        constraints, err := g.resolveConstraints(member.ExcludeAllergens, member.Diets)
+        if err != nil {
+            return nil, fmt.Errorf("member %q: %w", member.Name, err)
+        }
+        if err := g.checkConstraints(ownSlots, constraints); err != nil {
+            return nil, fmt.Errorf("member %q: %w", member.Name, err)
+        }
+        resolved = append(resolved, householdMember{name: member.Name, target: target, energy: energy, constraints: constraints})
+    }
+    return resolved, nil
+}
+
+// Adatta un pasto condiviso a un componente: stessi alimenti, porzioni
+// moltiplicate per il fattore e arrotondate al passo delle porzioni
+func (g *Generator) scaleMeal(meal Meal, factor, targetCalories float64, rules MealRules) Meal {
+    items := make([]Food, 0, len(meal.Items))
+    for _, item := range meal.Items {
+        key, rule, known := g.resolveFood(item)
+        if !known {
+            items = append(items, item)
+            continue
+        }
+        food := newFood(key, rule, roundPortion(item.Quantity*factor, portionStep, math.Inf(1)))
+        food.Explanation = item.Explanation
+        items = append(items, food)
+    }
+
+    scaled := g.newMeal(items)
+    scaled.TargetCalories = math.Round(targetCalories)
+    scaled.CalorieError = scaled.Calories - scaled.TargetCalories
+    scaled.Warnings = macroViolations(scaled.Macros, rules)
+    scaled.Rejected = meal.Rejected
+    return scaled
+}
@@ -0,0 +1,107 @@
+package planner
+
+import (
+    "math"
+    "testing"
+)
+
+func TestGenerateHouseholdPlan(t *testing.T) {
+    g := testGenerator(t)
+    seed := int64(5)
+    members := []HouseholdMember{
+        {Name: "Anna", TargetCalories: 1600},
+        {Name: "Marco", TargetCalories: 2400, ExcludeAllergens: []string{"lactose"}},
+    }
+    tests := []struct {
+        name    string
+        request HouseholdRequest
+        // Pasti che ciascuno consuma per conto proprio
+        own     []string
+    }{
+        {name: "all meals shared", request: HouseholdRequest{Members: members, Seed: &seed}},
+        {name: "dinner shared", request: HouseholdRequest{Members: members, Seed: &seed, SharedMeals: []string{"cena"}}, own: []string{"colazione", "spuntino", "pranzo", "merenda"}},
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            household, err := g.GenerateHouseholdPlan(tt.request)
+            if err != nil {
+                t.Fatal(err)
+            }
+            if len(household.Members) != len(members) {
+                t.Fatalf("%d member plans, want %d", len(household.Members), len(members))
+            }
+            anna, marco := household.Members[0], household.Members[1]
+            own := make(map[string]bool)
+            for _, name := range tt.own {
+                own[name] = true
+            }
+
+            // Somma delle quantità per chiave, da confrontare con la lista della spesa
+            totals := make(map[string]float64)
+            for i, slot := range anna.Slots {
+                other := marco.Slots[i]
+                for _, plan := range []MealPlan{anna.MealPlan, marco.MealPlan} {
+                    for _, item := range plan.Slots[i].Items {
+                        totals[item.Key] += item.Quantity
+                    }
+                }
+                for _, item := range other.Items {
+                    if rule, _ := g.catalog.Food(item.Key); containsString(rule.Allergens, "lactose") {
+                        t.Errorf("%s: lactose food %s for Marco", other.Name, item.Key)
+                    }
+                }
+                if own[slot.Name] {
+                    continue
+                }
+                if len(slot.Items) != len(other.Items) {
+                    t.Errorf("%s: %d foods for Anna, %d for Marco", slot.Name, len(slot.Items), len(other.Items))
+                    continue
+                }
+                for j, item := range slot.Items {
+                    if other.Items[j].Key != item.Key {
+                        t.Errorf("%s: %s for Anna, %s for Marco", slot.Name, item.Key, other.Items[j].Key)
+                    }
+                    // Porzioni in proporzione ai target (1,5 volte), al passo di 5 g
+                    if math.Abs(other.Items[j].Quantity-item.Quantity*1.5) > 2*portionStep {
+                        t.Errorf("%s, %s: %g g for Marco, %g g for Anna", slot.Name, item.Key, other.Items[j].Quantity, item.Quantity)
+                    }
+                }
+            }
+
+            for _, group := range household.ShoppingList.Groups {
+                for _, item := range group.Items {
+                    if math.Abs(item.Quantity-totals[item.Key]) > 0.5 {
+                        t.Errorf("shopping list has %g %s of %s, plans use %g", item.Quantity, item.Unit, item.Key, totals[item.Key])
+                    }
+                    delete(totals, item.Key)
+                }
+            }
+            if len(totals) > 0 {
+                t.Errorf("foods missing from the shopping list: %v", totals)
+            }
+        })
+    }
+}
+
+func TestGenerateHouseholdPlanErrors(t *testing.T) {
+    g := testGenerator(t)
+    tests := []struct {
+        name    string
+        request HouseholdRequest
+    }{
+        {name: "no members"},
+        {name: "missing name", request: HouseholdRequest{Members: []HouseholdMember{{TargetCalories: 2000}}}},
+        {name: "duplicate name", request: HouseholdRequest{Members: []HouseholdMember{{Name: "Anna", TargetCalories: 2000}, {Name: "Anna", TargetCalories: 1800}}}},
+        {name: "missing target", request: HouseholdRequest{Members: []HouseholdMember{{Name: "Anna"}}}},
+        {name: "unknown shared meal", request: HouseholdRequest{Members: []HouseholdMember{{Name: "Anna", TargetCalories: 2000}}, SharedMeals: []string{"brunch"}}},
+        {name: "unsatisfiable member", request: HouseholdRequest{Members: []HouseholdMember{{Name: "Anna", TargetCalories: 2000, Diets: []string{"vegan"}}}, SharedMeals: []string{}}},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            if _, err := g.GenerateHouseholdPlan(tt.request); err == nil {
+                t.Error("expected an error")
+            }
+        })
+    }
+}
@@ -0,0 +1,92 @@
+package planner
+
+import (
+    "fmt"
+    "sort"
+)
+
+// Motivi per cui un ingrediente scelto dall'utente non compare nel piano
+const (
+    UnplacedUnknownFood   = "unknown_food"
+    UnplacedExcluded      = "excluded_by_constraints"
+    UnplacedNoMeal        = "no_matching_meal"
+    UnplacedCategoryLimit = "category_limit"
+    UnplacedNoRoom        = "no_room"
+)
+
+type UnplacedIngredient struct {
+    Key     string `json:"key"`
+    Reason  string `json:"reason"`
+    Message string `json:"message"`
+}
+
+// Mette prima gli ingredienti usati meno volte, così che il budget di ogni
+// pasto vada a quelli che non hanno ancora trovato posto
+func prioritizeIngredients(ingredients []string, usage map[string]int) []string {
+    ordered := append([]string(nil), ingredients...)
+    sort.SliceStable(ordered, func(i, j int) bool {
+        return usage[ordered[i]] < usage[ordered[j]]
+    })
+    return ordered
+}
+
+func (g *Generator) recordUsage(meal Meal, usage map[string]int) {
+    for _, item := range meal.Items {
+        if key, _, known := g.resolveFood(item); known {
+            usage[key]++
+        }
+    }
+}
+
+// Elenca gli ingredienti dell'utente mai usati nel piano, con il motivo
+func (g *Generator) unplacedIngredients(ingredients []string, slots []MealSlot, constraints foodConstraints, usage map[string]int) []UnplacedIngredient {
+    var unplaced []UnplacedIngredient
+    seen := make(map[string]bool)
+    for _, key := range ingredients {
+        if seen[key] || usage[key] > 0 {
+            continue
+        }
+        seen[key] = true
+
+        rule, exists := g.catalog.Food(key)
+        switch {
+        case !exists:
+            unplaced = append(unplaced, UnplacedIngredient{Key: key, Reason: UnplacedUnknownFood,
+                Message: fmt.Sprintf("%q non è nel catalogo", key)})
+        case constraints.Forbidden[key]:
+            unplaced = append(unplaced, UnplacedIngredient{Key: key, Reason: UnplacedExcluded,
+                Message: fmt.Sprintf("%s è escluso dagli allergeni o dai regimi richiesti", rule.Name)})
+        default:
+            reason, message := g.placementProblem(rule, slots)
+            unplaced = append(unplaced, UnplacedIngredient{Key: key, Reason: reason, Message: message})
+        }
+    }
+    return unplaced
+}
+
+// Distingue un alimento che nessun pasto del piano prevede, uno la cui porzione
+// minima supera sempre il limite della categoria e uno rimasto senza spazio
+func (g *Generator) placementProblem(rule FoodRules, slots []MealSlot) (string, string) {
+    appropriate := false
+    fitsLimit := false
+    calories := calculateCalories(smallestPortion(rule), rule.CaloriesPer100g)
+    for _, slot := range slots {
+        if !isAppropriateForMeal(rule, slot.Profile) {
+            continue
+        }
+        appropriate = true
+        if limit, ok := g.rules[slot.Profile].CategoryLimits[rule.Category]; !ok || calories <= limit {
+            fitsLimit = true
+        }
+    }
+
+    switch {
+    case !appropriate:
+        return UnplacedNoMeal, fmt.Sprintf("%s non è previsto in nessuno dei pasti del piano", rule.Name)
+    case !fitsLimit:
+        return UnplacedCategoryLimit, fmt.Sprintf("la porzione minima di %s (%.0f kcal) supera il limite di %s in tutti i pasti adatti",
+            rule.Name, calories, categoryDisplayNames[rule.Category])
+    default:
+        return UnplacedNoRoom, fmt.Sprintf("%s non ha trovato spazio: calorie e limiti di categoria dei pasti adatti erano già occupati", rule.Name)
+    }
+}
@@ -0,0 +1,289 @@
+package planner
+
+import (
+    "fmt"
+    "math"
+    "sort"
+)
+
+// Macronutrienti espressi in grammi
+type Macros struct {
+    Protein float64 `json:"protein"`
+    Carbs   float64 `json:"carbs"`
+    Fat     float64 `json:"fat"`
+    Fiber   float64 `json:"fiber"`
+}
+
+func (m *Macros) add(other Macros) {
+    m.Protein += other.Protein
+    m.Carbs += other.Carbs
+    m.Fat += other.Fat
+    m.Fiber += other.Fiber
+}
+
+func (m Macros) rounded() Macros {
+    return Macros{
+        Protein: roundTo1(m.Protein),
+        Carbs:   roundTo1(m.Carbs),
+        Fat:     roundTo1(m.Fat),
+        Fiber:   roundTo1(m.Fiber),
+    }
+}
+
+// Grammi minimi del nutriente mancante che un alimento deve aggiungere per
+// essere usato nella correzione dei macronutrienti
+const minRepairGrams = 3
+
+func roundTo1(value float64) float64 {
+    return math.Round(value*10) / 10
+}
+
+func roundTo2(value float64) float64 {
+    return math.Round(value*100) / 100
+}
+
+// Calcola i macronutrienti di una porzione a partire dai valori per 100g
+func calculateMacros(quantity float64, rule FoodRules) Macros {
+    return Macros{
+        Protein: quantity * rule.ProteinPer100g / 100,
+        Carbs:   quantity * rule.CarbsPer100g / 100,
+        Fat:     quantity * rule.FatPer100g / 100,
+        Fiber:   quantity * rule.FiberPer100g / 100,
+    }
+}
+
+// Somma calorie e macronutrienti degli alimenti senza arrotondamenti intermedi
+func (g *Generator) sumItems(items []Food) (float64, Macros) {
+    var calories float64
+    var macros Macros
+    for _, item := range items {
+        if _, rule, known := g.resolveFood(item); known {
+            calories += calculateCalories(item.Quantity, rule.CaloriesPer100g)
+            macros.add(calculateMacros(item.Quantity, rule))
+        } else {
+            calories += item.Calories
+            macros.add(item.Macros)
+        }
+    }
+    return calories, macros
+}
+
+func (g *Generator) newMeal(items []Food) Meal {
+    calories, macros := g.sumItems(items)
+    return Meal{
+        Items:    items,
+        Calories: math.Round(calories),
+        Macros:   macros.rounded(),
+    }
+}
+
+// Aggiorna i totali giornalieri del piano a partire dai singoli pasti
+func (p *MealPlan) computeTotals() {
+    var calories float64
+    var macros Macros
+    for _, meal := range p.Slots {
+        calories += meal.Calories
+        macros.add(meal.Macros)
+    }
+    p.Calories = math.Round(calories)
+    p.Macros = macros.rounded()
+}
+
+// Restituisce le violazioni delle regole sui macronutrienti del pasto
+func macroViolations(macros Macros, rules MealRules) []string {
+    var violations []string
+    if macros.Protein < rules.MinProtein {
+        violations = append(violations, fmt.Sprintf("proteine %.1fg sotto il minimo di %.0fg", macros.Protein, rules.MinProtein))
+    }
+    if macros.Carbs < rules.MinCarbs {
+        violations = append(violations, fmt.Sprintf("carboidrati %.1fg sotto il minimo di %.0fg", macros.Carbs, rules.MinCarbs))
+    }
+    if rules.MaxFat > 0 && macros.Fat > rules.MaxFat {
+        violations = append(violations, fmt.Sprintf("grassi %.1fg sopra il massimo di %.0fg", macros.Fat, rules.MaxFat))
+    }
+    return violations
+}
+
+// Distanza complessiva (in grammi) dal rispetto delle regole sui macronutrienti
+func macroDeficit(macros Macros, rules MealRules) float64 {
+    deficit := math.Max(0, rules.MinProtein-macros.Protein) + math.Max(0, rules.MinCarbs-macros.Carbs)
+    if rules.MaxFat > 0 {
+        deficit += math.Max(0, macros.Fat-rules.MaxFat)
+    }
+    return deficit
+}
+
+func (g *Generator) fitsCategoryLimit(items []Food, rule FoodRules, calories float64, rules MealRules) bool {
+    limit, ok := rules.CategoryLimits[rule.Category]
+    if !ok {
+        return true
+    }
+    return g.getCategoryCalories(items, rule.Category)+calories <= limit
+}
+
+func containsFood(items []Food, name string) bool {
+    for _, item := range items {
+        if item.Name == name {
+            return true
+        }
+    }
+    return false
+}
+
+// Prova a correggere un pasto che non rispetta le regole sui macronutrienti:
+// aggiunge alimenti ricchi del nutriente mancante e sostituisce o toglie
+// quelli più grassi, sempre entro il budget calorico e i limiti di categoria
+func (g *Generator) repairMealMacros(items *[]Food, totalCalories *float64, mealType string, rules MealRules, targetCalories float64, constraints foodConstraints) {
+    _, macros := g.sumItems(*items)
+
+    // Aggiungi fonti di proteine e carboidrati finché servono
+    for _, nutrient := range []string{"protein", "carbs"} {
+        for {
+            _, macros = g.sumItems(*items)
+            missing := rules.MinProtein - macros.Protein
+            if nutrient == "carbs" {
+                missing = rules.MinCarbs - macros.Carbs
+            }
+            if missing <= 0 {
+                break
+            }
+            key, found := g.bestMacroSource(*items, *totalCalories, mealType, nutrient, missing, rules, targetCalories, constraints)
+            if !found || !g.addFoodItem(items, totalCalories, key, targetCalories, rules) {
+                break
+            }
+            if nutrient == "carbs" {
+                explainLast(*items, SourceMacroRepair, "aggiunto per raggiungere il minimo di carboidrati del pasto")
+            } else {
+                explainLast(*items, SourceMacroRepair, "aggiunto per raggiungere il minimo di proteine del pasto")
+            }
+        }
+    }
+
+    // Riduci i grassi sostituendo o togliendo l'alimento più grasso
+    for rules.MaxFat > 0 {
+        _, macros = g.sumItems(*items)
+        if macros.Fat <= rules.MaxFat {
+            break
+        }
+        index := fattiestItem(*items, constraints.Locked)
+        if index < 0 || !g.replaceFattyItem(items, totalCalories, index, mealType, rules, targetCalories, constraints) {
+            break
+        }
+    }
+}
+
+// Sceglie l'alimento che, con la porzione che entra nel budget, copre la parte
+// maggiore del nutriente mancante; a parità vince quello con meno calorie
+func (g *Generator) bestMacroSource(items []Food, totalCalories float64, mealType string, nutrient string, missing float64, rules MealRules, targetCalories float64, constraints foodConstraints) (string, bool) {
+    type candidate struct {
+        key      string
+        grams    float64
+        calories float64
+    }
+    var candidates []candidate
+    for _, key := range g.catalog.FoodsForMeal(mealType) {
+        rule, _ := g.catalog.Food(key)
+        if !constraints.allows(key) || containsFood(items, rule.Name) {
+            continue
+        }
+        quantity, fits := g.portionToAdd(items, totalCalories, rule, targetCalories, rules)
+        if !fits {
+            continue
+        }
+        macros := calculateMacros(quantity, rule)
+        grams := macros.Protein
+        if nutrient == "carbs" {
+            grams = macros.Carbs
+        }
+        // Un alimento che aggiunge pochi grammi occuperebbe solo il posto di altri
+        if grams < math.Min(missing, minRepairGrams) {
+            continue
+        }
+        candidates = append(candidates, candidate{key: key, grams: math.Min(grams, missing), calories: calculateCalories(quantity, rule.CaloriesPer100g)})
+    }
+    if len(candidates) == 0 {
+        return "", false
+    }
+
+    // Le chiavi arrivano ordinate: a parità di grammi e calorie vince la prima
+    sort.SliceStable(candidates, func(i, j int) bool {
+        if candidates[i].grams != candidates[j].grams {
+            return candidates[i].grams > candidates[j].grams
+        }
+        return candidates[i].calories < candidates[j].calories
+    })
+    return candidates[0].key, true
+}
+
+func fattiestItem(items []Food, locked []Food) int {
+    index := -1
+    var maxFat float64
+    for i, item := range items {
+        if item.Fat > maxFat && !containsFood(locked, item.Name) {
+            maxFat = item.Fat
+            index = i
+        }
+    }
+    return index
+}
+
+// Sostituisce l'alimento con un'alternativa più magra della stessa categoria;
+// se non ce ne sono lo toglie, a meno che sia l'unico di una categoria obbligatoria
+func (g *Generator) replaceFattyItem(items *[]Food, totalCalories *float64, index int, mealType string, rules MealRules, targetCalories float64, constraints foodConstraints) bool {
+    current := (*items)[index]
+    _, currentRule, exists := g.resolveFood(current)
+    if !exists {
+        return false
+    }
+
+    remaining := make([]Food, 0, len(*items)-1)
+    remaining = append(remaining, (*items)[:index]...)
+    remaining = append(remaining, (*items)[index+1:]...)
+    remainingCalories := *totalCalories - calculateCalories(current.Quantity, currentRule.CaloriesPer100g)
+
+    fat := func(key string) float64 {
+        rule, _ := g.catalog.Food(key)
+        return calculateMacros(rule.StandardPortion, rule).Fat
+    }
+    var leaner []string
+    for _, key := range g.foodsFor(currentRule.Category, mealType) {
+        rule, _ := g.catalog.Food(key)
+        if !constraints.allows(key) || containsFood(*items, rule.Name) {
+            continue
+        }
+        if fat(key) >= current.Fat {
+            continue
+        }
+        calories := calculateCalories(rule.StandardPortion, rule.CaloriesPer100g)
+        if remainingCalories+calories > targetCalories || !g.fitsCategoryLimit(remaining, rule, calories, rules) {
+            continue
+        }
+        leaner = append(leaner, key)
+    }
+
+    // La sostituzione si prova su una copia: il pasto cambia solo se
+    // l'alternativa entra davvero
+    sort.SliceStable(leaner, func(i, j int) bool {
+        return fat(leaner[i]) < fat(leaner[j])
+    })
+    for _, key := range leaner {
+        swapped := append([]Food(nil), remaining...)
+        swappedCalories := remainingCalories
+        if !g.addFoodItem(&swapped, &swappedCalories, key, targetCalories, rules) {
+            continue
+        }
+        explainLast(swapped, SourceLeanerSwap, fmt.Sprintf("sostituisce %s per restare sotto il massimo di grassi", current.Name))
+        *items = swapped
+        *totalCalories = swappedCalories
+        return true
+    }
+
+    for _, category := range rules.RequiredCategories {
+        if category == currentRule.Category && !g.containsCategory(remaining, category) {
+            return false
+        }
+    }
+    *items = remaining
+    *totalCalories = remainingCalories
+    return true
+}
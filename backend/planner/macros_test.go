@@ -0,0 +1,71 @@
+package planner
+
+import (
+    "math"
+    "reflect"
+    "testing"
+)
+
+func TestReplaceFattyItem(t *testing.T) {
+    foods := map[string]FoodRules{
+        "salmone":  {Name: "Salmone", Unit: "g", CaloriesPer100g: 208, ProteinPer100g: 20, FatPer100g: 13.4, Category: "protein", MealTypes: []string{"cena"}, StandardPortion: 200, MinPortion: 150, MaxPortion: 250},
+        "merluzzo": {Name: "Merluzzo", Unit: "g", CaloriesPer100g: 82, ProteinPer100g: 18, FatPer100g: 0.7, Category: "protein", MealTypes: []string{"cena"}, StandardPortion: 200, MinPortion: 150, MaxPortion: 300},
+        "zucchine": {Name: "Zucchine", Unit: "g", CaloriesPer100g: 20, CarbsPer100g: 2, Category: "vegetable", MealTypes: []string{"cena"}, StandardPortion: 200, MinPortion: 100, MaxPortion: 400},
+        "olio":     {Name: "Olio", Unit: "g", CaloriesPer100g: 900, FatPer100g: 100, Category: "fat", MealTypes: []string{"cena"}, StandardPortion: 10, MinPortion: 5, MaxPortion: 20},
+    }
+    g := NewGenerator(NewMapCatalog(foods), nil, Options{})
+    rules := MealRules{RequiredCategories: []string{"protein", "vegetable"}, CategoryLimits: map[string]float64{"protein": 500, "vegetable": 100}, MaxFat: 20}
+    items := func(keys ...string) []Food {
+        var result []Food
+        for _, key := range keys {
+            result = append(result, newFood(key, foods[key], foods[key].StandardPortion))
+        }
+        return result
+    }
+
+    tests := []struct {
+        name        string
+        items       []Food
+        index       int
+        constraints foodConstraints
+        replaced    bool
+        // Nomi degli alimenti attesi dopo la chiamata
+        want        []string
+    }{
+        {name: "leaner protein", items: items("salmone", "zucchine"), replaced: true, want: []string{"Zucchine", "Merluzzo"}},
+        {name: "optional item removed", items: items("merluzzo", "olio"), index: 1, replaced: true, want: []string{"Merluzzo"}},
+        {
+            name:        "only protein without alternatives",
+            items:       items("salmone", "zucchine"),
+            constraints: foodConstraints{Forbidden: map[string]bool{"merluzzo": true}},
+            want:        []string{"Salmone", "Zucchine"},
+        },
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            meal := append([]Food(nil), tt.items...)
+            totalCalories, _ := g.sumItems(meal)
+            before := totalCalories
+            replaced := g.replaceFattyItem(&meal, &totalCalories, tt.index, "cena", rules, 700, tt.constraints)
+            if replaced != tt.replaced {
+                t.Fatalf("replaced = %v, want %v", replaced, tt.replaced)
+            }
+            var names []string
+            for _, item := range meal {
+                names = append(names, item.Name)
+            }
+            if !reflect.DeepEqual(names, tt.want) {
+                t.Errorf("items %v, want %v", names, tt.want)
+            }
+            // Il totale deve restare allineato agli alimenti, anche se non cambia nulla
+            calories, _ := g.sumItems(meal)
+            if math.Abs(totalCalories-calories) > 0.5 {
+                t.Errorf("total calories %g, items sum to %g", totalCalories, calories)
+            }
+            if !tt.replaced && totalCalories != before {
+                t.Errorf("total calories changed from %g to %g", before, totalCalories)
+            }
+        })
+    }
+}
@@ -0,0 +1,644 @@
+// Package planner genera piani alimentari a partire da un catalogo di alimenti
+// e dalle regole dei pasti, senza dipendere dal server HTTP
+package planner
+
+import (
+    "fmt"
+    "math"
+    "math/rand"
+    "sort"
+    "strings"
+    "time"
+)
+
+// Strutture di base
+type Food struct {
+    // Chiave dell'alimento nel catalogo
+    Key         string           `json:"key,omitempty"`
+    Name        string           `json:"name"`
+    Quantity    float64          `json:"quantity"`
+    Unit        string           `json:"unit"`
+    Calories    float64          `json:"calories"`
+    Macros
+    // Come l'alimento è finito nel pasto, solo se richiesto con explain
+    Explanation *FoodExplanation `json:"explanation,omitempty"`
+}
+
+type Meal struct {
+    Items          []Food              `json:"items"`
+    Calories       float64             `json:"calories"`
+    Macros
+    // Calorie assegnate al pasto e scarto rimasto (positivo se sopra il target)
+    TargetCalories float64             `json:"targetCalories"`
+    CalorieError   float64             `json:"calorieError"`
+    Warnings       []string            `json:"warnings,omitempty"`
+    // Candidati scartati per limiti di categoria o budget, solo con explain
+    Rejected       []RejectedCandidate `json:"rejected,omitempty"`
+}
+
+type MealPlan struct {
+    // Pasti della giornata nell'ordine richiesto
+    Slots     []SlotMeal           `json:"slots"`
+    // Forma storica: valorizzata per gli slot con il nome di uno dei cinque pasti
+    Colazione *Meal                `json:"colazione,omitempty"`
+    Spuntino  *Meal                `json:"spuntino,omitempty"`
+    Pranzo    *Meal                `json:"pranzo,omitempty"`
+    Merenda   *Meal                `json:"merenda,omitempty"`
+    Cena      *Meal                `json:"cena,omitempty"`
+    Calories  float64              `json:"calories"`
+    Macros
+    // Seed usato per generare il piano, per poterlo riprodurre
+    Seed      *int64               `json:"seed,omitempty"`
+    // Calcolo del fabbisogno, se il target deriva dai dati biometrici
+    Energy    *EnergyCalculation   `json:"energy,omitempty"`
+    // Ingredienti scelti dall'utente che non è stato possibile usare
+    Unplaced  []UnplacedIngredient `json:"unplacedIngredients,omitempty"`
+}
+
+// Richiesta di generazione di un piano
+type PlanRequest struct {
+    Ingredients      []string    `json:"ingredients"`
+    TargetCalories   int         `json:"targetCalories"`
+    Seed             *int64      `json:"seed"`
+    // Pasti della giornata; se assenti si usano quelli delle opzioni
+    Slots            []MealSlot  `json:"slots"`
+    // In alternativa a targetCalories, il target viene calcolato da questi dati
+    Biometrics       *Biometrics `json:"biometrics"`
+    // Allergeni da escludere e regimi alimentari da rispettare
+    ExcludeAllergens []string    `json:"excludeAllergens"`
+    Diets            []string    `json:"diets"`
+    // Se indicato, genera più piani distinti ordinati per punteggio (solo piano giornaliero)
+    Count            int         `json:"count"`
+    // Se vero, ogni alimento riporta il motivo per cui è nel pasto
+    Explain          bool        `json:"explain"`
+}
+
+// Strutture per l'organizzazione degli ingredienti
+type IngredientCategory struct {
+    Name        string   `json:"name"`
+    Ingredients []string `json:"ingredients"`
+}
+
+type MealIngredients struct {
+    MealName    string               `json:"mealName"`
+    Categories  []IngredientCategory `json:"categories"`
+}
+
+// Strutture delle regole
+type FoodRules struct {
+    Name            string   `json:"name" yaml:"name"`
+    StandardPortion float64  `json:"standardPortion" yaml:"standardPortion"`
+    Unit            string   `json:"unit" yaml:"unit"`
+    CaloriesPer100g float64  `json:"caloriesPer100g" yaml:"caloriesPer100g"`
+    ProteinPer100g  float64  `json:"proteinPer100g" yaml:"proteinPer100g"`
+    CarbsPer100g    float64  `json:"carbsPer100g" yaml:"carbsPer100g"`
+    FatPer100g      float64  `json:"fatPer100g" yaml:"fatPer100g"`
+    FiberPer100g    float64  `json:"fiberPer100g" yaml:"fiberPer100g"`
+    Category        string   `json:"category" yaml:"category"`
+    Description     string   `json:"description" yaml:"description"`
+    MealTypes       []string `json:"mealTypes" yaml:"mealTypes"`
+    MinPortion      float64  `json:"minPortion" yaml:"minPortion"`
+    MaxPortion      float64  `json:"maxPortion" yaml:"maxPortion"`
+    Required        bool     `json:"required" yaml:"required"`
+    Frequency       int      `json:"frequency" yaml:"frequency"`
+    // Allergeni contenuti e regimi alimentari compatibili
+    Allergens       []string `json:"allergens,omitempty" yaml:"allergens,omitempty"`
+    Diets           []string `json:"diets,omitempty" yaml:"diets,omitempty"`
+    // Reparto del negozio e confezione in vendita (nell'unità dell'alimento)
+    Aisle           string   `json:"aisle,omitempty" yaml:"aisle,omitempty"`
+    PackageSize     float64  `json:"packageSize,omitempty" yaml:"packageSize,omitempty"`
+    PackageName     string   `json:"packageName,omitempty" yaml:"packageName,omitempty"`
+}
+
+type MealRules struct {
+    RequiredCategories []string           `json:"requiredCategories" yaml:"requiredCategories"`
+    CategoryLimits     map[string]float64 `json:"categoryLimits" yaml:"categoryLimits"`
+    MinProtein         float64            `json:"minProtein" yaml:"minProtein"`
+    MinCarbs           float64            `json:"minCarbs" yaml:"minCarbs"`
+    MaxFat             float64            `json:"maxFat" yaml:"maxFat"`
+}
+
+// Parametri del generatore; i campi a zero assumono i valori predefiniti
+type Options struct {
+    // Pasti usati quando la richiesta non ne indica
+    Slots            []MealSlot
+    // Tentativi di generazione prima di accettare un pasto che non rispetta
+    // tutte le regole sui macronutrienti
+    MaxAttempts      int
+    // Scarto calorico accettato per un pasto, in frazione del suo target
+    CalorieTolerance float64
+}
+
+const (
+    defaultMaxAttempts      = 10
+    defaultCalorieTolerance = 0.05
+)
+
+// Generatore di piani: legge solo il catalogo e le regole ricevuti alla
+// creazione, quindi può essere usato da più goroutine contemporaneamente
+type Generator struct {
+    catalog Catalog
+    rules   map[string]MealRules
+    options Options
+}
+
+func NewGenerator(catalog Catalog, rules map[string]MealRules, options Options) *Generator {
+    if len(options.Slots) == 0 {
+        options.Slots = DefaultMealSlots
+    }
+    if options.MaxAttempts <= 0 {
+        options.MaxAttempts = defaultMaxAttempts
+    }
+    if options.CalorieTolerance <= 0 {
+        options.CalorieTolerance = defaultCalorieTolerance
+    }
+    return &Generator{catalog: catalog, rules: rules, options: options}
+}
+
+func (g *Generator) Catalog() Catalog {
+    return g.catalog
+}
+
+func (g *Generator) Rules() map[string]MealRules {
+    return g.rules
+}
+
+// Helper functions
+func calculateCalories(quantity float64, caloriesPer100g float64) float64 {
+    return (quantity * caloriesPer100g) / 100
+}
+
+func (g *Generator) containsCategory(items []Food, category string) bool {
+    for _, item := range items {
+        if _, rule, known := g.resolveFood(item); known && rule.Category == category {
+            return true
+        }
+    }
+    return false
+}
+
+func (g *Generator) getCategoryCalories(items []Food, category string) float64 {
+    var calories float64 = 0
+    for _, item := range items {
+        if _, rule, known := g.resolveFood(item); known && rule.Category == category {
+            calories += item.Calories
+        }
+    }
+    return calories
+}
+
+// Restituisce il seed richiesto dal client o ne sceglie uno nuovo
+func ResolveSeed(seed *int64) int64 {
+    if seed != nil {
+        return *seed
+    }
+    return time.Now().UnixNano()
+}
+
+func isAppropriateForMeal(rule FoodRules, mealType string) bool {
+    for _, allowedMeal := range rule.MealTypes {
+        if allowedMeal == mealType {
+            return true
+        }
+    }
+    return false
+}
+
+// Alimenti del catalogo di una categoria adatti al pasto
+func (g *Generator) foodsFor(category, mealType string) []string {
+    var keys []string
+    for _, key := range g.catalog.FoodsInCategory(category) {
+        if rule, _ := g.catalog.Food(key); isAppropriateForMeal(rule, mealType) {
+            keys = append(keys, key)
+        }
+    }
+    return keys
+}
+
+func newFood(key string, rule FoodRules, quantity float64) Food {
+    return Food{
+        Key:      key,
+        Name:     rule.Name,
+        Quantity: quantity,
+        Unit:     rule.Unit,
+        Calories: math.Round(calculateCalories(quantity, rule.CaloriesPer100g)),
+        Macros:   calculateMacros(quantity, rule).rounded(),
+    }
+}
+
+func smallestPortion(rule FoodRules) float64 {
+    if rule.MinPortion > 0 && rule.MinPortion < rule.StandardPortion {
+        return rule.MinPortion
+    }
+    return rule.StandardPortion
+}
+
+// Calorie minime necessarie a coprire le categorie obbligatorie che mancano
+// ancora al pasto, esclusa quella dell'alimento che si sta aggiungendo; le
+// categorie che nessun alimento può coprire entro il limite non contano
+func (g *Generator) requiredReserve(items []Food, category, mealType string, rules MealRules, constraints foodConstraints) float64 {
+    var reserve float64
+    for _, required := range rules.RequiredCategories {
+        if required == category || g.containsCategory(items, required) {
+            continue
+        }
+        cheapest := math.Inf(1)
+        for _, key := range g.foodsFor(required, mealType) {
+            rule, _ := g.catalog.Food(key)
+            calories := calculateCalories(smallestPortion(rule), rule.CaloriesPer100g)
+            if !constraints.Forbidden[key] && g.fitsCategoryLimit(nil, rule, calories, rules) {
+                cheapest = math.Min(cheapest, calories)
+            }
+        }
+        if !math.IsInf(cheapest, 1) {
+            reserve += cheapest
+        }
+    }
+    return reserve
+}
+
+// Aggiunge l'alimento con la porzione standard o, se non rientra nel budget,
+// con la porzione minima; il budget comprende la tolleranza calorica, perché
+// l'ottimizzatore delle porzioni riporta poi il pasto verso il target
+func (g *Generator) addFoodItem(items *[]Food, totalCalories *float64, key string, targetCalories float64, rules MealRules) bool {
+    rule, exists := g.catalog.Food(key)
+    if !exists {
+        return false
+    }
+    quantity, fits := g.portionToAdd(*items, *totalCalories, rule, targetCalories, rules)
+    if !fits {
+        return false
+    }
+    *items = append(*items, newFood(key, rule, quantity))
+    *totalCalories += calculateCalories(quantity, rule.CaloriesPer100g)
+    return true
+}
+
+// Porzione con cui addFoodItem aggiungerebbe l'alimento al pasto
+func (g *Generator) portionToAdd(items []Food, totalCalories float64, rule FoodRules, targetCalories float64, rules MealRules) (float64, bool) {
+    budget := targetCalories * (1 + g.options.CalorieTolerance)
+    for _, quantity := range []float64{rule.StandardPortion, rule.MinPortion} {
+        if quantity <= 0 {
+            continue
+        }
+        calories := calculateCalories(quantity, rule.CaloriesPer100g)
+        if totalCalories + calories <= budget && g.fitsCategoryLimit(items, rule, calories, rules) {
+            return quantity, true
+        }
+    }
+    return 0, false
+}
+
+// Mapping delle categorie interne alle categorie visualizzate
+var categoryDisplayNames = map[string]string{
+    "beverage":  "Bevande",
+    "carb":      "Carboidrati",
+    "protein":   "Proteine",
+    "vegetable": "Verdure",
+    "fruit":     "Frutta",
+    "fat":       "Extra",
+}
+
+// Ingredienti del catalogo organizzati per pasto e categoria
+func (g *Generator) Ingredients() []MealIngredients {
+    // Mappa iniziale per organizzare gli ingredienti per pasto e categoria
+    mealMap := map[string]map[string][]string{
+        "colazione": {
+            "Bevande":    {},
+            "Carboidrati": {},
+            "Proteine":    {},
+            "Frutta":      {},
+            "Extra":       {},
+        },
+        "spuntino": {
+            "Frutta":     {},
+            "Snack":      {},
+            "Extra":      {},
+        },
+        "pranzo": {
+            "Carboidrati": {},
+            "Proteine":    {},
+            "Verdure":     {},
+            "Extra":       {},
+        },
+        "merenda": {
+            "Frutta":     {},
+            "Snack":      {},
+            "Proteine":   {},
+            "Extra":      {},
+        },
+        "cena": {
+            "Carboidrati": {},
+            "Proteine":    {},
+            "Verdure":     {},
+            "Extra":       {},
+        },
+    }
+
+    // Mappa per tenere traccia degli ingredienti già aggiunti in ogni pasto
+    seenInMeal := make(map[string]map[string]bool)
+    for mealType := range mealMap {
+        seenInMeal[mealType] = make(map[string]bool)
+    }
+
+    // Popola la mappa con gli ingredienti
+    for _, key := range g.catalog.Keys() {
+        rule, _ := g.catalog.Food(key)
+        displayCategory := categoryDisplayNames[rule.Category]
+        if displayCategory == "" {
+            displayCategory = "Extra"
+        }
+
+        for _, mealType := range rule.MealTypes {
+            if categories, exists := mealMap[mealType]; exists {
+                if !seenInMeal[mealType][key] {
+                    categories[displayCategory] = append(
+                        categories[displayCategory],
+                        key,
+                    )
+                    seenInMeal[mealType][key] = true
+                }
+            }
+        }
+    }
+
+    // Converti la mappa in slice per il JSON
+    var result []MealIngredients
+
+    // Ordine predefinito dei pasti
+    mealOrder := []string{"colazione", "spuntino", "pranzo", "merenda", "cena"}
+
+    for _, mealType := range mealOrder {
+        if categories, exists := mealMap[mealType]; exists {
+            var mealCategories []IngredientCategory
+
+            // Ordine predefinito delle categorie
+            categoryOrder := []string{"Bevande", "Carboidrati", "Proteine", "Verdure", "Frutta", "Snack", "Extra"}
+
+            for _, catName := range categoryOrder {
+                if ingredients, exists := categories[catName]; exists && len(ingredients) > 0 {
+                    // Ordina gli ingredienti alfabeticamente
+                    sort.Strings(ingredients)
+                    mealCategories = append(mealCategories, IngredientCategory{
+                        Name:        catName,
+                        Ingredients: ingredients,
+                    })
+                }
+            }
+
+            result = append(result, MealIngredients{
+                MealName:   strings.Title(mealType),
+                Categories: mealCategories,
+            })
+        }
+    }
+
+    return result
+}
+
+// Controlla la richiesta e genera il piano di una giornata
+func (g *Generator) GeneratePlan(request PlanRequest) (MealPlan, error) {
+    slots, targetCalories, energy, constraints, err := g.preparePlan(request)
+    if err != nil {
+        return MealPlan{}, err
+    }
+
+    seed := ResolveSeed(request.Seed)
+    plan := g.generateMealPlan(rand.New(rand.NewSource(seed)), slots, request.Ingredients, targetCalories, constraints)
+    plan.Seed = &seed
+    plan.Energy = energy
+    return plan, nil
+}
+
+// Risolve slot, target calorico e vincoli comuni a piani giornalieri e settimanali
+func (g *Generator) preparePlan(request PlanRequest) ([]MealSlot, float64, *EnergyCalculation, foodConstraints, error) {
+    slots, err := g.resolveSlots(request.Slots)
+    if err != nil {
+        return nil, 0, nil, foodConstraints{}, err
+    }
+    targetCalories, energy, err := resolveTargetCalories(request)
+    if err != nil {
+        return nil, 0, nil, foodConstraints{}, err
+    }
+    constraints, err := g.resolveConstraints(request.ExcludeAllergens, request.Diets)
+    if err != nil {
+        return nil, 0, nil, foodConstraints{}, err
+    }
+    if err := g.checkConstraints(slots, constraints); err != nil {
+        return nil, 0, nil, foodConstraints{}, err
+    }
+    constraints.Explain = request.Explain
+    return slots, targetCalories, energy, constraints, nil
+}
+
+// Funzione per generare il piano pasti di una giornata
+func (g *Generator) generateMealPlan(rng *rand.Rand, slots []MealSlot, userIngredients []string, targetCalories float64, constraints foodConstraints) MealPlan {
+    var plan MealPlan
+    usage := make(map[string]int)
+    for _, slot := range slots {
+        meal := g.generateMealWithUserIngredients(rng, slot.Profile, prioritizeIngredients(userIngredients, usage), targetCalories*slot.Share, constraints)
+        g.recordUsage(meal, usage)
+        plan.addMeal(slot, meal)
+    }
+    plan.computeTotals()
+    plan.Unplaced = g.unplacedIngredients(userIngredients, slots, constraints, usage)
+    return plan
+}
+
+// Gli alimenti vietati dai vincoli non vengono mai usati; quelli da evitare
+// solo se una categoria obbligatoria altrimenti resterebbe vuota
+func (g *Generator) generateMealWithUserIngredients(rng *rand.Rand, mealType string, userIngredients []string, targetCalories float64, constraints foodConstraints) Meal {
+    rules := g.rules[mealType]
+
+    // Genera più tentativi e scarta quelli che lasciano scoperte categorie
+    // obbligatorie o violano le regole sui macronutrienti; se nessuno le rispetta
+    // tutte, restituisci il migliore con gli avvisi
+    var best Meal
+    bestMissing := math.MaxInt
+    bestDeficit := math.Inf(1)
+    bestError := math.Inf(1)
+    for attempt := 0; attempt < g.options.MaxAttempts; attempt++ {
+        items, totalCalories, rejected := g.buildMealItems(rng, mealType, userIngredients, targetCalories, constraints)
+        g.repairMealMacros(&items, &totalCalories, mealType, rules, targetCalories, constraints)
+        g.fillMealCalories(rng, &items, &totalCalories, mealType, rules, targetCalories, constraints)
+        items = g.optimizePortions(items, rules, targetCalories, constraints.Locked)
+
+        meal := g.newMeal(items)
+        meal.TargetCalories = math.Round(targetCalories)
+        meal.CalorieError = meal.Calories - meal.TargetCalories
+        meal.Rejected = rejected
+        missing := len(g.missingCategories(items, rules))
+        deficit := macroDeficit(meal.Macros, rules)
+        calorieError := math.Abs(meal.CalorieError)
+        if missing < bestMissing || (missing == bestMissing && (deficit < bestDeficit || (deficit == bestDeficit && calorieError < bestError))) {
+            best = meal
+            bestMissing = missing
+            bestDeficit = deficit
+            bestError = calorieError
+        }
+        if missing == 0 && deficit == 0 && calorieError <= targetCalories*g.options.CalorieTolerance {
+            break
+        }
+    }
+
+    for _, category := range g.missingCategories(best.Items, rules) {
+        best.Warnings = append(best.Warnings, fmt.Sprintf("categoria obbligatoria %s non coperta: nessun alimento ammesso rientra nel budget calorico e nel limite di categoria", categoryDisplayNames[category]))
+    }
+    best.Warnings = append(best.Warnings, macroViolations(best.Macros, rules)...)
+    if !constraints.Explain {
+        best.stripExplanations()
+    }
+    return best
+}
+
+// Categorie obbligatorie del pasto senza alcun alimento
+func (g *Generator) missingCategories(items []Food, rules MealRules) []string {
+    var missing []string
+    for _, category := range rules.RequiredCategories {
+        if !g.containsCategory(items, category) {
+            missing = append(missing, category)
+        }
+    }
+    return missing
+}
+
+// Costruisce gli alimenti del pasto a partire dagli ingredienti dell'utente
+func (g *Generator) buildMealItems(rng *rand.Rand, mealType string, userIngredients []string, targetCalories float64, constraints foodConstraints) ([]Food, float64, []RejectedCandidate) {
+    var items []Food
+    var totalCalories float64 = 0
+    var rejected []RejectedCandidate
+    rules := g.rules[mealType]
+
+    // 0. Gli alimenti bloccati fanno già parte del pasto
+    for _, food := range constraints.Locked {
+        items = append(items, food)
+        totalCalories += food.Calories
+        explainLast(items, SourceLocked, "bloccato nella richiesta di rigenerazione")
+    }
+
+    // 1. Prima aggiungi gli ingredienti dell'utente che sono appropriati per questo pasto,
+    // anche più di uno per categoria, finché rientrano nel budget e nei limiti di categoria
+    // lasciando spazio alle categorie obbligatorie ancora scoperte
+    for _, ing := range userIngredients {
+        rule, exists := g.catalog.Food(ing)
+        if !exists || !constraints.allows(ing) || !isAppropriateForMeal(rule, mealType) || containsFood(items, rule.Name) {
+            continue
+        }
+        reserve := g.requiredReserve(items, rule.Category, mealType, rules, constraints)
+        added := false
+        for _, quantity := range []float64{rule.StandardPortion, smallestPortion(rule)} {
+            calories := calculateCalories(quantity, rule.CaloriesPer100g)
+            if g.fitsCategoryLimit(items, rule, calories, rules) && totalCalories + calories + reserve <= targetCalories {
+                items = append(items, newFood(ing, rule, quantity))
+                totalCalories += calories
+                explainLast(items, SourceUserIngredient, "scelto dall'utente")
+                added = true
+                break
+            }
+        }
+        if !added {
+            if !g.fitsCategoryLimit(items, rule, calculateCalories(smallestPortion(rule), rule.CaloriesPer100g), rules) {
+                rejected = append(rejected, g.categoryRejection(items, ing, rule, SourceUserIngredient, rules))
+            } else {
+                // Le calorie tenute da parte per le categorie obbligatorie non sono disponibili
+                rejection := budgetRejection(ing, rule, SourceUserIngredient, totalCalories + reserve, targetCalories)
+                if reserve > 0 {
+                    rejection.Message += fmt.Sprintf(", tenute da parte %.0f kcal per le categorie obbligatorie", reserve)
+                }
+                rejected = append(rejected, rejection)
+            }
+        }
+    }
+
+    // 2. Poi aggiungi gli elementi obbligatori mancanti
+    for _, category := range rules.RequiredCategories {
+        if !g.containsCategory(items, category) {
+            var availableIngredients []string
+            for _, k := range g.foodsFor(category, mealType) {
+                if !constraints.Forbidden[k] {
+                    availableIngredients = append(availableIngredients, k)
+                }
+            }
+            // Prova gli alimenti in ordine casuale finché uno rientra nel budget;
+            // il catalogo restituisce le chiavi ordinate, quindi il risultato
+            // dipende solo dal seed
+            rng.Shuffle(len(availableIngredients), func(i, j int) {
+                availableIngredients[i], availableIngredients[j] = availableIngredients[j], availableIngredients[i]
+            })
+            // Gli alimenti da evitare restano in fondo come ultima scelta,
+            // a partire dai meno usati
+            sort.SliceStable(availableIngredients, func(i, j int) bool {
+                a, b := availableIngredients[i], availableIngredients[j]
+                if constraints.Avoid[a] != constraints.Avoid[b] {
+                    return !constraints.Avoid[a]
+                }
+                return constraints.Avoid[a] && constraints.Uses[a] < constraints.Uses[b]
+            })
+            for _, key := range availableIngredients {
+                if g.addFoodItem(&items, &totalCalories, key, targetCalories, rules) {
+                    reason := fmt.Sprintf("aggiunto per coprire la categoria obbligatoria %s", categoryDisplayNames[category])
+                    if constraints.Avoid[key] {
+                        reason += ", benché da evitare, in mancanza di alternative"
+                    }
+                    explainLast(items, SourceRequiredCategory, reason)
+                    break
+                }
+                rule, _ := g.catalog.Food(key)
+                rejected = append(rejected, budgetRejection(key, rule, SourceRequiredCategory, totalCalories, targetCalories))
+            }
+        }
+    }
+
+    // 3. Per spuntino e merenda, assicurati di avere almeno frutta o snack
+    if (mealType == "spuntino" || mealType == "merenda") && len(items) == 0 {
+        // Prova ad aggiungere frutta, poi crackers
+        for _, key := range []string{"frutta_fresca", "crackers_integrali"} {
+            if constraints.Forbidden[key] {
+                continue
+            }
+            if g.addFoodItem(&items, &totalCalories, key, targetCalories, rules) {
+                explainLast(items, SourceSnackFallback, "aggiunto come spuntino di riserva perché il pasto era vuoto")
+            } else if rule, exists := g.catalog.Food(key); exists {
+                rejected = append(rejected, budgetRejection(key, rule, SourceSnackFallback, totalCalories, targetCalories))
+            }
+        }
+    }
+
+    return items, totalCalories, rejected
+}
+
+// Se il pasto resta sotto il target oltre la tolleranza, aggiunge altri alimenti
+// adatti, prima quelli di categorie non ancora presenti, finché rientrano nel
+// budget e nei limiti di categoria; le porzioni vengono poi aggiustate dall'ottimizzatore
+func (g *Generator) fillMealCalories(rng *rand.Rand, items *[]Food, totalCalories *float64, mealType string, rules MealRules, targetCalories float64, constraints foodConstraints) {
+    for *totalCalories < targetCalories*(1-g.options.CalorieTolerance) {
+        var candidates []string
+        for _, key := range g.catalog.FoodsForMeal(mealType) {
+            if rule, _ := g.catalog.Food(key); constraints.allows(key) && !containsFood(*items, rule.Name) {
+                candidates = append(candidates, key)
+            }
+        }
+        rng.Shuffle(len(candidates), func(i, j int) {
+            candidates[i], candidates[j] = candidates[j], candidates[i]
+        })
+        present := func(key string) bool {
+            rule, _ := g.catalog.Food(key)
+            return g.containsCategory(*items, rule.Category)
+        }
+        sort.SliceStable(candidates, func(i, j int) bool {
+            return !present(candidates[i]) && present(candidates[j])
+        })
+
+        added := false
+        for _, key := range candidates {
+            if g.addFoodItem(items, totalCalories, key, targetCalories, rules) {
+                explainLast(*items, SourceCalorieFill, "aggiunto per avvicinare il pasto al suo target calorico")
+                added = true
+                break
+            }
+        }
+        if !added {
+            return
+        }
+    }
+}
@@ -0,0 +1,273 @@
+package planner
+
+import (
+    "encoding/json"
+    "errors"
+    "math/rand"
+    "os"
+    "reflect"
+    "testing"
+)
+
+// Generatore costruito sul catalogo distribuito con il server
+func testGenerator(t *testing.T) *Generator {
+    t.Helper()
+    foods := make(map[string]FoodRules)
+    rules := make(map[string]MealRules)
+    for path, target := range map[string]any{"../data/foods.json": &foods, "../data/meal_rules.json": &rules} {
+        data, err := os.ReadFile(path)
+        if err != nil {
+            t.Fatal(err)
+        }
+        if err := json.Unmarshal(data, target); err != nil {
+            t.Fatalf("%s: %v", path, err)
+        }
+    }
+    if problems := ValidateCatalog(foods, rules); len(problems) > 0 {
+        t.Fatalf("invalid catalog: %v", problems)
+    }
+    return NewGenerator(NewMapCatalog(foods), rules, Options{})
+}
+
+func TestSameSeedSamePlan(t *testing.T) {
+    g := testGenerator(t)
+    tests := []struct {
+        name     string
+        generate func(PlanRequest) (any, error)
+        request  PlanRequest
+    }{
+        {
+            name:     "daily",
+            generate: func(r PlanRequest) (any, error) { return g.GeneratePlan(r) },
+            request:  PlanRequest{TargetCalories: 2000},
+        },
+        {
+            name:     "daily with ingredients and diet",
+            generate: func(r PlanRequest) (any, error) { return g.GeneratePlan(r) },
+            request:  PlanRequest{TargetCalories: 1800, Ingredients: []string{"riso_basmati", "zucchine"}, Diets: []string{"lactose-free"}},
+        },
+        {
+            name:     "ranked plans",
+            generate: func(r PlanRequest) (any, error) { return g.GeneratePlans(r) },
+            request:  PlanRequest{TargetCalories: 2200, Count: 3},
+        },
+        {
+            name:     "weekly",
+            generate: func(r PlanRequest) (any, error) { return g.GenerateWeeklyPlan(r) },
+            request:  PlanRequest{TargetCalories: 2000},
+        },
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            for _, seed := range []int64{1, 42, 2024} {
+                first, second := tt.request, tt.request
+                seedA, seedB := seed, seed
+                first.Seed, second.Seed = &seedA, &seedB
+
+                a, err := tt.generate(first)
+                if err != nil {
+                    t.Fatalf("seed %d: %v", seed, err)
+                }
+                b, err := tt.generate(second)
+                if err != nil {
+                    t.Fatalf("seed %d: %v", seed, err)
+                }
+                if !reflect.DeepEqual(a, b) {
+                    t.Errorf("seed %d: plans differ", seed)
+                }
+            }
+        })
+    }
+}
+
+func TestForbiddenFoodsNeverUsed(t *testing.T) {
+    g := testGenerator(t)
+    tests := []struct {
+        name             string
+        excludeAllergens []string
+        diets            []string
+        // Il catalogo non ha alternative per una categoria obbligatoria
+        unsatisfiable    bool
+    }{
+        {name: "no lactose", excludeAllergens: []string{"lactose"}},
+        {name: "no fish and egg", excludeAllergens: []string{"fish", "egg"}},
+        {name: "lactose-free", diets: []string{"lactose-free"}},
+        {name: "no meat", excludeAllergens: []string{"meat"}},
+        {name: "vegetarian", diets: []string{"vegetarian"}},
+        {name: "pescatarian", diets: []string{"pescatarian"}},
+        {name: "gluten-free", diets: []string{"gluten-free"}},
+        {name: "vegan", diets: []string{"vegan"}, unsatisfiable: true},
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            constraints, err := g.resolveConstraints(tt.excludeAllergens, tt.diets)
+            if err != nil {
+                t.Fatal(err)
+            }
+            for seed := int64(1); seed <= 5; seed++ {
+                week, err := g.GenerateWeeklyPlan(PlanRequest{TargetCalories: 2000, Seed: &seed, ExcludeAllergens: tt.excludeAllergens, Diets: tt.diets})
+                if tt.unsatisfiable {
+                    var unsatisfiable *UnsatisfiableError
+                    if !errors.As(err, &unsatisfiable) {
+                        t.Fatalf("seed %d: got %v, want an UnsatisfiableError", seed, err)
+                    }
+                    continue
+                }
+                if err != nil {
+                    t.Fatalf("seed %d: %v", seed, err)
+                }
+                for _, day := range week.Days {
+                    for _, slot := range day.Slots {
+                        for _, item := range slot.Items {
+                            if constraints.Forbidden[item.Key] {
+                                t.Errorf("seed %d, %s %s: forbidden food %s", seed, day.Day, slot.Name, item.Key)
+                            }
+                        }
+                    }
+                }
+            }
+        })
+    }
+}
+
+func TestAvoidedFoodsUsedOnlyWithoutAlternative(t *testing.T) {
+    g := testGenerator(t)
+    proteins := g.foodsFor("protein", "cena")
+    allBut := func(keep string) map[string]bool {
+        avoid := make(map[string]bool)
+        for _, key := range proteins {
+            if key != keep {
+                avoid[key] = true
+            }
+        }
+        return avoid
+    }
+    all := allBut("")
+
+    tests := []struct {
+        name        string
+        constraints foodConstraints
+        // Proteine ammesse nel pasto
+        want        map[string]bool
+    }{
+        {
+            name:        "one protein left",
+            constraints: foodConstraints{Avoid: allBut("tacchino_petto")},
+            want:        map[string]bool{"tacchino_petto": true},
+        },
+        {
+            name:        "forbidden and avoided",
+            constraints: foodConstraints{Forbidden: map[string]bool{"petto_pollo": true}, Avoid: allBut("petto_pollo")},
+            want:        allBut("petto_pollo"),
+        },
+        {
+            name:        "falls back to the least used",
+            constraints: foodConstraints{Avoid: all, Uses: map[string]int{"merluzzo": 0, "petto_pollo": 3, "tacchino_petto": 2, "pesce_spada": 2, "salmone_fresco": 2, "orata": 2, "tofu": 2, "uova_intere": 2}},
+            want:        map[string]bool{"merluzzo": true},
+        },
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            for seed := int64(1); seed <= 10; seed++ {
+                meal := g.generateMealWithUserIngredients(rand.New(rand.NewSource(seed)), "cena", nil, 500, tt.constraints)
+                if !g.containsCategory(meal.Items, "protein") {
+                    t.Errorf("seed %d: no protein in %v", seed, meal.Items)
+                }
+                for _, item := range meal.Items {
+                    rule, _ := g.catalog.Food(item.Key)
+                    if tt.constraints.Forbidden[item.Key] {
+                        t.Errorf("seed %d: forbidden food %s", seed, item.Key)
+                    }
+                    if rule.Category == "protein" && !tt.want[item.Key] {
+                        t.Errorf("seed %d: protein %s, want one of %v", seed, item.Key, SortedKeys(tt.want))
+                    }
+                }
+            }
+        })
+    }
+}
+
+func TestWeeklyPlanRotatesProteins(t *testing.T) {
+    g := testGenerator(t)
+    for seed := int64(1); seed <= 8; seed++ {
+        week, err := g.GenerateWeeklyPlan(PlanRequest{TargetCalories: 2000, Seed: &seed})
+        if err != nil {
+            t.Fatalf("seed %d: %v", seed, err)
+        }
+        previous := make(map[string]bool)
+        for _, day := range week.Days {
+            today := make(map[string]bool)
+            for _, slot := range day.Slots {
+                for _, item := range slot.Items {
+                    rule, _ := g.catalog.Food(item.Key)
+                    if rule.Category != "protein" {
+                        continue
+                    }
+                    if previous[item.Key] {
+                        t.Errorf("seed %d, %s %s: %s repeated from the previous day", seed, day.Day, slot.Name, item.Key)
+                    }
+                    today[item.Key] = true
+                }
+            }
+            previous = today
+        }
+    }
+}
+
+func TestIngredientsPlacedOrReported(t *testing.T) {
+    g := testGenerator(t)
+    tests := []struct {
+        name    string
+        request PlanRequest
+        // Motivo atteso per gli ingredienti che non possono entrare nel piano
+        reasons map[string]string
+    }{
+        {name: "lunch and dinner foods", request: PlanRequest{TargetCalories: 1800, Ingredients: []string{"riso_basmati", "zucchine"}}},
+        {name: "one per meal", request: PlanRequest{TargetCalories: 2000, Ingredients: []string{"yogurt_greco", "crackers_integrali", "petto_pollo", "merluzzo"}}},
+        {
+            name:    "unknown and excluded",
+            request: PlanRequest{TargetCalories: 2000, Ingredients: []string{"riso_basmati", "pizza", "mozzarella_light"}, Diets: []string{"lactose-free"}},
+            reasons: map[string]string{"pizza": UnplacedUnknownFood, "mozzarella_light": UnplacedExcluded},
+        },
+        {
+            name:    "no meal for the food",
+            request: PlanRequest{TargetCalories: 2000, Ingredients: []string{"merluzzo"}, Slots: []MealSlot{{Name: "colazione", Profile: "colazione", Share: 0.4}, {Name: "pranzo", Profile: "pranzo", Share: 0.6}}},
+            reasons: map[string]string{"merluzzo": UnplacedNoMeal},
+        },
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            for seed := int64(1); seed <= 5; seed++ {
+                request := tt.request
+                request.Seed = &seed
+                plan, err := g.GeneratePlan(request)
+                if err != nil {
+                    t.Fatalf("seed %d: %v", seed, err)
+                }
+                placed := make(map[string]bool)
+                for _, slot := range plan.Slots {
+                    for _, item := range slot.Items {
+                        placed[item.Key] = true
+                    }
+                }
+                unplaced := make(map[string]string)
+                for _, ingredient := range plan.Unplaced {
+                    unplaced[ingredient.Key] = ingredient.Reason
+                }
+                for _, key := range tt.request.Ingredients {
+                    reason, reported := unplaced[key]
+                    if placed[key] == reported {
+                        t.Errorf("seed %d: %s placed %v, reported %v", seed, key, placed[key], reported)
+                    }
+                    if want, ok := tt.reasons[key]; ok && reason != want {
+                        t.Errorf("seed %d: %s reported as %q, want %q", seed, key, reason, want)
+                    }
+                }
+            }
+        })
+    }
+}
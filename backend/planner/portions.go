@@ -0,0 +1,174 @@
+package planner
+
+import (
+    "fmt"
+    "math"
+    "strconv"
+    "strings"
+)
+
+const (
+    // Passo di arrotondamento delle porzioni ottimizzate (in grammi)
+    portionStep = 5
+    maxPortionPasses = 10
+)
+
+// Sceglie per ogni alimento una quantità tra MinPortion e MaxPortion in modo
+// da avvicinare il pasto al suo target calorico, senza superare i CategoryLimits;
+// gli alimenti bloccati mantengono la loro quantità
+func (g *Generator) optimizePortions(items []Food, rules MealRules, targetCalories float64, locked []Food) []Food {
+    type portion struct {
+        key         string
+        rule        FoodRules
+        quantity    float64
+        fixed       bool
+        explanation *FoodExplanation
+    }
+
+    portions := make([]portion, 0, len(items))
+    for _, item := range items {
+        key, rule, exists := g.resolveFood(item)
+        if !exists {
+            return items
+        }
+        portions = append(portions, portion{key: key, rule: rule, quantity: item.Quantity, fixed: containsFood(locked, item.Name), explanation: item.Explanation})
+    }
+
+    minPortion := func(p portion) float64 {
+        if p.fixed {
+            return p.quantity
+        }
+        if p.rule.MinPortion > 0 {
+            return math.Min(p.rule.MinPortion, p.quantity)
+        }
+        return p.quantity
+    }
+    maxPortion := func(p portion) float64 {
+        if p.fixed {
+            return p.quantity
+        }
+        return math.Max(p.rule.MaxPortion, p.quantity)
+    }
+    categoryCalories := func(category string) float64 {
+        var calories float64
+        for _, p := range portions {
+            if p.rule.Category == category {
+                calories += calculateCalories(p.quantity, p.rule.CaloriesPer100g)
+            }
+        }
+        return calories
+    }
+
+    // Distribuisci lo scarto in proporzione al margine di ogni alimento;
+    // più passate servono quando alcuni alimenti arrivano al limite
+    for pass := 0; pass < maxPortionPasses; pass++ {
+        var total float64
+        for _, p := range portions {
+            total += calculateCalories(p.quantity, p.rule.CaloriesPer100g)
+        }
+        diff := targetCalories - total
+        if math.Abs(diff) < 1 {
+            break
+        }
+
+        headroom := make(map[string]float64)
+        for category, limit := range rules.CategoryLimits {
+            headroom[category] = math.Max(0, limit-categoryCalories(category))
+        }
+
+        capacities := make([]float64, len(portions))
+        var totalCapacity float64
+        for i, p := range portions {
+            perGram := p.rule.CaloriesPer100g / 100
+            if diff > 0 {
+                capacities[i] = (maxPortion(p) - p.quantity) * perGram
+                if room, limited := headroom[p.rule.Category]; limited && room <= 0 {
+                    capacities[i] = 0
+                }
+            } else {
+                capacities[i] = (p.quantity - minPortion(p)) * perGram
+            }
+            totalCapacity += capacities[i]
+        }
+        if totalCapacity <= 0 {
+            break
+        }
+
+        changed := false
+        for i := range portions {
+            p := &portions[i]
+            perGram := p.rule.CaloriesPer100g / 100
+            if capacities[i] <= 0 || perGram <= 0 {
+                continue
+            }
+            // Nessun alimento va oltre il proprio margine, anche quando lo scarto
+            // supera la capacità complessiva
+            share := diff * capacities[i] / totalCapacity
+            share = math.Copysign(math.Min(math.Abs(share), capacities[i]), share)
+            if diff > 0 {
+                if room, limited := headroom[p.rule.Category]; limited {
+                    share = math.Min(share, room)
+                    headroom[p.rule.Category] = room - share
+                }
+            }
+            if math.Abs(share) < 0.01 {
+                continue
+            }
+            p.quantity += share / perGram
+            changed = true
+        }
+        if !changed {
+            break
+        }
+    }
+
+    // L'arrotondamento non deve portare una categoria oltre il suo limite
+    for i := range portions {
+        p := &portions[i]
+        rounded := roundPortion(p.quantity, minPortion(*p), maxPortion(*p))
+        perGram := p.rule.CaloriesPer100g / 100
+        if limit, limited := rules.CategoryLimits[p.rule.Category]; limited && perGram > 0 {
+            room := limit - (categoryCalories(p.rule.Category) - p.quantity*perGram)
+            if rounded*perGram > room {
+                rounded = math.Max(minPortion(*p), math.Floor(room/perGram/portionStep)*portionStep)
+            }
+        }
+        p.quantity = rounded
+    }
+
+    optimized := make([]Food, 0, len(portions))
+    for _, p := range portions {
+        food := newFood(p.key, p.rule, p.quantity)
+        food.Explanation = p.explanation
+        optimized = append(optimized, food)
+    }
+    return optimized
+}
+
+// Arrotonda la porzione al passo più vicino restando nell'intervallo consentito
+func roundPortion(quantity, min, max float64) float64 {
+    rounded := math.Round(quantity/portionStep) * portionStep
+    return math.Max(min, math.Min(max, rounded))
+}
+
+// Indicazione pratica della porzione ricavata dalla descrizione dell'alimento:
+// "4 Fette" si riferisce alla porzione standard e viene riproporzionato alla
+// quantità (90 g di pane diventano "3 Fette"); le altre descrizioni restano invariate
+func (g *Generator) PortionHint(food Food) string {
+    _, rule, exists := g.resolveFood(food)
+    if !exists {
+        return ""
+    }
+    description := strings.TrimSpace(rule.Description)
+    fields := strings.SplitN(description, " ", 2)
+    count, err := strconv.ParseFloat(fields[0], 64)
+    if err != nil || len(fields) < 2 || count <= 0 || rule.StandardPortion <= 0 {
+        return description
+    }
+    scaled := math.Round(count*food.Quantity/rule.StandardPortion*2) / 2
+    if scaled == 0 {
+        scaled = 0.5
+    }
+    amount := strings.Replace(strconv.FormatFloat(scaled, 'f', -1, 64), ".", ",", 1)
+    return fmt.Sprintf("%s %s", amount, fields[1])
+}
@@ -0,0 +1,110 @@
+package planner
+
+import (
+    "math"
+    "testing"
+)
+
+func TestOptimizePortions(t *testing.T) {
+    foods := map[string]FoodRules{
+        "riso":     {Name: "Riso", Unit: "g", CaloriesPer100g: 350, CarbsPer100g: 78, Category: "carb", MealTypes: []string{"pranzo"}, StandardPortion: 80, MinPortion: 50, MaxPortion: 150},
+        "pollo":    {Name: "Pollo", Unit: "g", CaloriesPer100g: 110, ProteinPer100g: 23, Category: "protein", MealTypes: []string{"pranzo"}, StandardPortion: 150, MinPortion: 100, MaxPortion: 300},
+        "zucchine": {Name: "Zucchine", Unit: "g", CaloriesPer100g: 20, CarbsPer100g: 2, Category: "vegetable", MealTypes: []string{"pranzo"}, StandardPortion: 200, MinPortion: 100, MaxPortion: 400},
+    }
+    g := NewGenerator(NewMapCatalog(foods), nil, Options{})
+    limits := map[string]float64{"carb": 400, "protein": 400, "vegetable": 100}
+    items := func(quantities map[string]float64) []Food {
+        var result []Food
+        for _, key := range SortedKeys(quantities) {
+            result = append(result, newFood(key, foods[key], quantities[key]))
+        }
+        return result
+    }
+    start := map[string]float64{"riso": 80, "pollo": 150, "zucchine": 200}
+
+    tests := []struct {
+        name   string
+        limits map[string]float64
+        target float64
+        locked []string
+        // Quantità attese quando il target non è raggiungibile; altrimenti
+        // il pasto deve finire entro la tolleranza
+        want   map[string]float64
+    }{
+        {name: "scale up", limits: limits, target: 700},
+        {name: "scale down", limits: limits, target: 400},
+        {name: "already on target", limits: limits, target: 485},
+        {name: "locked item keeps its quantity", limits: limits, target: 650, locked: []string{"Pollo"}},
+        {
+            name:   "category limits cap the meal",
+            limits: map[string]float64{"carb": 300, "protein": 400, "vegetable": 100},
+            target: 900,
+            want:   map[string]float64{"riso": 85, "pollo": 300, "zucchine": 400},
+        },
+        {
+            name:   "target below the minimum portions",
+            limits: limits,
+            target: 200,
+            want:   map[string]float64{"riso": 50, "pollo": 100, "zucchine": 100},
+        },
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            var locked []Food
+            for _, item := range items(start) {
+                if containsString(tt.locked, item.Name) {
+                    locked = append(locked, item)
+                }
+            }
+            optimized := g.optimizePortions(items(start), MealRules{CategoryLimits: tt.limits}, tt.target, locked)
+
+            var total float64
+            categoryCalories := make(map[string]float64)
+            for _, item := range optimized {
+                rule := foods[item.Key]
+                calories := calculateCalories(item.Quantity, rule.CaloriesPer100g)
+                total += calories
+                categoryCalories[rule.Category] += calories
+
+                if containsFood(locked, item.Name) && item.Quantity != start[item.Key] {
+                    t.Errorf("locked %s changed from %g to %g", item.Key, start[item.Key], item.Quantity)
+                }
+                if item.Quantity < rule.MinPortion || item.Quantity > rule.MaxPortion {
+                    t.Errorf("%s = %g, outside [%g, %g]", item.Key, item.Quantity, rule.MinPortion, rule.MaxPortion)
+                }
+                if math.Mod(item.Quantity, portionStep) != 0 {
+                    t.Errorf("%s = %g, not a multiple of %d", item.Key, item.Quantity, portionStep)
+                }
+                if want, exists := tt.want[item.Key]; exists && item.Quantity != want {
+                    t.Errorf("%s = %g, want %g", item.Key, item.Quantity, want)
+                }
+            }
+            for category, limit := range tt.limits {
+                if categoryCalories[category] > limit {
+                    t.Errorf("%s: %.1f kcal over the limit of %g", category, categoryCalories[category], limit)
+                }
+            }
+            if tt.want == nil && math.Abs(total-tt.target) > tt.target*defaultCalorieTolerance {
+                t.Errorf("total %.1f kcal, want %g ± %g%%", total, tt.target, defaultCalorieTolerance*100)
+            }
+        })
+    }
+}
+
+func TestRoundPortion(t *testing.T) {
+    tests := []struct {
+        quantity, min, max, want float64
+    }{
+        {quantity: 82, min: 50, max: 150, want: 80},
+        {quantity: 83, min: 50, max: 150, want: 85},
+        {quantity: 43, min: 50, max: 150, want: 50},
+        {quantity: 152.6, min: 50, max: 150, want: 150},
+        {quantity: 243.9, min: 0, max: math.Inf(1), want: 245},
+    }
+    for _, tt := range tests {
+        if got := roundPortion(tt.quantity, tt.min, tt.max); got != tt.want {
+            t.Errorf("roundPortion(%g, %g, %g) = %g, want %g", tt.quantity, tt.min, tt.max, got, tt.want)
+        }
+    }
+}
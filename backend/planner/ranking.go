@@ -0,0 +1,204 @@
+package planner
+
+import (
+    "fmt"
+    "math"
+    "math/rand"
+    "sort"
+)
+
+const (
+    // Numero massimo di piani restituiti da una singola richiesta
+    MaxPlanCount = 10
+    // Candidati generati per ogni piano richiesto, tra cui scegliere i migliori
+    candidatesPerPlan = 4
+    // Scarto calorico relativo oltre il quale l'accuratezza vale zero
+    maxRankingCalorieError = 0.25
+    // Due piani con almeno questa quota di alimenti in comune sono quasi uguali
+    duplicateSimilarity = 0.75
+)
+
+// Pesi delle componenti del punteggio; la somma è 1
+var scoreWeights = PlanScore{
+    Calories:    0.4,
+    Macros:      0.3,
+    Ingredients: 0.2,
+    Variety:     0.1,
+}
+
+// Punteggio di un piano: ogni componente va da 0 a 1, più alto è meglio
+type PlanScore struct {
+    Total       float64 `json:"total"`
+    // Vicinanza delle calorie totali al target
+    Calories    float64 `json:"calories"`
+    // Rispetto dei minimi di proteine e carboidrati e del massimo di grassi dei pasti
+    Macros      float64 `json:"macros"`
+    // Quota degli ingredienti scelti dall'utente presenti nel piano
+    Ingredients float64 `json:"ingredients"`
+    // Quota di alimenti diversi sul totale delle porzioni
+    Variety     float64 `json:"variety"`
+}
+
+type RankedPlan struct {
+    Rank  int       `json:"rank"`
+    Score PlanScore `json:"score"`
+    Plan  MealPlan  `json:"plan"`
+}
+
+type RankedPlans struct {
+    Plans     []RankedPlan `json:"plans"`
+    Requested int          `json:"requested"`
+    // Seed di partenza: il piano i-esimo candidato usa seed+i, riportato nel piano stesso
+    Seed      int64        `json:"seed"`
+    Warnings  []string     `json:"warnings,omitempty"`
+}
+
+// Genera più piani candidati e restituisce i request.Count migliori,
+// scartando quelli quasi uguali a un piano con punteggio più alto
+func (g *Generator) GeneratePlans(request PlanRequest) (RankedPlans, error) {
+    if request.Count < 1 || request.Count > MaxPlanCount {
+        return RankedPlans{}, fmt.Errorf("count must be between 1 and %d", MaxPlanCount)
+    }
+    slots, targetCalories, energy, constraints, err := g.preparePlan(request)
+    if err != nil {
+        return RankedPlans{}, err
+    }
+
+    seed := ResolveSeed(request.Seed)
+    candidates := make([]RankedPlan, 0, request.Count*candidatesPerPlan)
+    for i := 0; i < request.Count*candidatesPerPlan; i++ {
+        // Ogni candidato ha un seed proprio, così si può rigenerare da solo
+        candidateSeed := seed + int64(i)
+        plan := g.generateMealPlan(rand.New(rand.NewSource(candidateSeed)), slots, request.Ingredients, targetCalories, constraints)
+        plan.Seed = &candidateSeed
+        plan.Energy = energy
+        candidates = append(candidates, RankedPlan{Score: g.scorePlan(plan, request.Ingredients, targetCalories), Plan: plan})
+    }
+    sort.SliceStable(candidates, func(i, j int) bool {
+        return candidates[i].Score.Total > candidates[j].Score.Total
+    })
+
+    result := RankedPlans{Requested: request.Count, Seed: seed}
+    var signatures []map[string]bool
+    for _, candidate := range candidates {
+        if len(result.Plans) == request.Count {
+            break
+        }
+        signature := planSignature(candidate.Plan)
+        duplicate := false
+        for _, other := range signatures {
+            if similarity(signature, other) >= duplicateSimilarity {
+                duplicate = true
+                break
+            }
+        }
+        if duplicate {
+            continue
+        }
+        signatures = append(signatures, signature)
+        candidate.Rank = len(result.Plans) + 1
+        result.Plans = append(result.Plans, candidate)
+    }
+    if len(result.Plans) < request.Count {
+        result.Warnings = append(result.Warnings, fmt.Sprintf("trovati solo %d piani distinti su %d richiesti", len(result.Plans), request.Count))
+    }
+    return result, nil
+}
+
+func (g *Generator) scorePlan(plan MealPlan, userIngredients []string, targetCalories float64) PlanScore {
+    var score PlanScore
+    if targetCalories > 0 {
+        relativeError := math.Abs(plan.Calories-targetCalories) / targetCalories
+        score.Calories = 1 - math.Min(1, relativeError/maxRankingCalorieError)
+    }
+
+    // Media dell'aderenza dei pasti, pesata sulla quota calorie di ciascuno
+    var adherence, totalShare float64
+    for _, slot := range plan.Slots {
+        rules := g.rules[slot.Profile]
+        adherence += slot.Share * macroAdherence(slot.Macros, rules)
+        totalShare += slot.Share
+    }
+    if totalShare > 0 {
+        score.Macros = adherence / totalShare
+    }
+
+    used := make(map[string]bool)
+    items := 0
+    for _, slot := range plan.Slots {
+        for _, item := range slot.Items {
+            used[foodIdentity(item)] = true
+            items++
+        }
+    }
+    score.Ingredients = 1
+    if len(userIngredients) > 0 {
+        found := 0
+        for _, key := range userIngredients {
+            if used[key] {
+                found++
+            }
+        }
+        score.Ingredients = float64(found) / float64(len(userIngredients))
+    }
+    if items > 0 {
+        score.Variety = float64(len(used)) / float64(items)
+    }
+
+    score.Total = scoreWeights.Calories*score.Calories + scoreWeights.Macros*score.Macros +
+        scoreWeights.Ingredients*score.Ingredients + scoreWeights.Variety*score.Variety
+    score.Total = roundScore(score.Total)
+    score.Calories = roundScore(score.Calories)
+    score.Macros = roundScore(score.Macros)
+    score.Ingredients = roundScore(score.Ingredients)
+    score.Variety = roundScore(score.Variety)
+    return score
+}
+
+// 1 se il pasto rispetta i limiti sui macronutrienti, 0 se li manca del tutto
+func macroAdherence(macros Macros, rules MealRules) float64 {
+    limits := rules.MinProtein + rules.MinCarbs + rules.MaxFat
+    if limits == 0 {
+        return 1
+    }
+    return 1 - math.Min(1, macroDeficit(macros, rules)/limits)
+}
+
+func foodIdentity(item Food) string {
+    if item.Key != "" {
+        return item.Key
+    }
+    return item.Name
+}
+
+// Insieme degli alimenti del piano, distinti per pasto
+func planSignature(plan MealPlan) map[string]bool {
+    signature := make(map[string]bool)
+    for _, slot := range plan.Slots {
+        for _, item := range slot.Items {
+            signature[slot.Name+"/"+foodIdentity(item)] = true
+        }
+    }
+    return signature
+}
+
+// Indice di Jaccard tra due insiemi di alimenti
+func similarity(a, b map[string]bool) float64 {
+    union := len(b)
+    common := 0
+    for key := range a {
+        if b[key] {
+            common++
+        } else {
+            union++
+        }
+    }
+    if union == 0 {
+        return 1
+    }
+    return float64(common) / float64(union)
+}
+
+func roundScore(value float64) float64 {
+    return math.Round(value*1000) / 1000
+}
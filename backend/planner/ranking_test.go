@@ -0,0 +1,117 @@
+package planner
+
+import (
+    "testing"
+)
+
+func TestGeneratePlans(t *testing.T) {
+    g := testGenerator(t)
+    tests := []struct {
+        name    string
+        request PlanRequest
+        wantErr bool
+    }{
+        {name: "three plans", request: PlanRequest{TargetCalories: 2000, Count: 3}},
+        {name: "with ingredients", request: PlanRequest{TargetCalories: 1800, Count: 2, Ingredients: []string{"salmone_fresco", "patate"}}},
+        {name: "maximum count", request: PlanRequest{TargetCalories: 2200, Count: MaxPlanCount}},
+        {name: "zero count", request: PlanRequest{TargetCalories: 2000}, wantErr: true},
+        {name: "count over the maximum", request: PlanRequest{TargetCalories: 2000, Count: MaxPlanCount + 1}, wantErr: true},
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            seed := int64(11)
+            tt.request.Seed = &seed
+            ranked, err := g.GeneratePlans(tt.request)
+            if tt.wantErr {
+                if err == nil {
+                    t.Fatal("expected an error")
+                }
+                return
+            }
+            if err != nil {
+                t.Fatal(err)
+            }
+            if len(ranked.Plans) > tt.request.Count || (len(ranked.Plans) < tt.request.Count) != (len(ranked.Warnings) > 0) {
+                t.Errorf("%d plans of %d with warnings %v", len(ranked.Plans), tt.request.Count, ranked.Warnings)
+            }
+
+            var signatures []map[string]bool
+            for i, candidate := range ranked.Plans {
+                if candidate.Rank != i+1 {
+                    t.Errorf("plan %d has rank %d", i, candidate.Rank)
+                }
+                if i > 0 && candidate.Score.Total > ranked.Plans[i-1].Score.Total {
+                    t.Errorf("plan %d scores more than plan %d", candidate.Rank, i)
+                }
+                // Il seed del piano lo rigenera identico
+                again, err := g.GeneratePlan(PlanRequest{TargetCalories: tt.request.TargetCalories, Ingredients: tt.request.Ingredients, Seed: candidate.Plan.Seed})
+                if err != nil {
+                    t.Fatal(err)
+                }
+                if again.Calories != candidate.Plan.Calories {
+                    t.Errorf("seed %d regenerates %g kcal, ranked plan has %g", *candidate.Plan.Seed, again.Calories, candidate.Plan.Calories)
+                }
+                signature := planSignature(candidate.Plan)
+                for _, other := range signatures {
+                    if similarity(signature, other) >= duplicateSimilarity {
+                        t.Errorf("plan %d is a near duplicate", candidate.Rank)
+                    }
+                }
+                signatures = append(signatures, signature)
+            }
+        })
+    }
+}
+
+func TestScorePlan(t *testing.T) {
+    foods := map[string]FoodRules{
+        "riso":  {Name: "Riso", Unit: "g", CaloriesPer100g: 350, ProteinPer100g: 7, CarbsPer100g: 78, FatPer100g: 1, Category: "carb", MealTypes: []string{"pranzo"}, StandardPortion: 100},
+        "pollo": {Name: "Pollo", Unit: "g", CaloriesPer100g: 110, ProteinPer100g: 23, FatPer100g: 1.5, Category: "protein", MealTypes: []string{"pranzo"}, StandardPortion: 150},
+    }
+    rules := map[string]MealRules{"pranzo": {MinProtein: 30, MinCarbs: 60, MaxFat: 25}}
+    g := NewGenerator(NewMapCatalog(foods), rules, Options{})
+    lunch := func(keys ...string) MealPlan {
+        var meal Meal
+        for _, key := range keys {
+            meal.Items = append(meal.Items, newFood(key, foods[key], foods[key].StandardPortion))
+        }
+        meal.Calories, meal.Macros = g.sumItems(meal.Items)
+        plan := MealPlan{}
+        plan.addMeal(MealSlot{Name: "pranzo", Profile: "pranzo", Share: 1}, meal)
+        plan.computeTotals()
+        return plan
+    }
+
+    tests := []struct {
+        name        string
+        plan        MealPlan
+        ingredients []string
+        target      float64
+        want        PlanScore
+    }{
+        {
+            // 515 kcal, 41,5 g di proteine e 78 di carboidrati: tutto rispettato
+            name:   "on target",
+            plan:   lunch("riso", "pollo"),
+            target: 515,
+            want:   PlanScore{Total: 1, Calories: 1, Macros: 1, Ingredients: 1, Variety: 1},
+        },
+        {
+            // 350 kcal su 700 (scarto oltre il 25%), proteine 7 su 30
+            name:        "half the target, missing protein and ingredient",
+            plan:        lunch("riso"),
+            ingredients: []string{"riso", "pollo"},
+            target:      700,
+            want:        PlanScore{Total: 0.44, Calories: 0, Macros: 0.8, Ingredients: 0.5, Variety: 1},
+        },
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            got := g.scorePlan(tt.plan, tt.ingredients, tt.target)
+            if got != tt.want {
+                t.Errorf("got %+v, want %+v", got, tt.want)
+            }
+        })
+    }
+}
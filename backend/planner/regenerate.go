@@ -0,0 +1,139 @@
+package planner
+
+import (
+    "fmt"
+    "math/rand"
+)
+
+// Richiesta di rigenerazione di un solo pasto di un piano esistente
+type RegenerateMealRequest struct {
+    Plan             MealPlan `json:"plan"`
+    // Nome dello slot da rigenerare
+    Meal             string   `json:"meal"`
+    // Chiavi degli alimenti del pasto da mantenere con la loro quantità
+    Locked           []string `json:"locked"`
+    Ingredients      []string `json:"ingredients"`
+    Seed             *int64   `json:"seed"`
+    ExcludeAllergens []string `json:"excludeAllergens"`
+    Diets            []string `json:"diets"`
+    // Se vero, gli alimenti del nuovo pasto riportano il motivo della scelta
+    Explain          bool     `json:"explain"`
+}
+
+// Piano aggiornato e seed usato per il nuovo pasto
+type RegeneratedPlan struct {
+    Plan MealPlan `json:"plan"`
+    Meal string   `json:"meal"`
+    Seed int64    `json:"seed"`
+}
+
+// Converte un piano nel formato storico, senza slot, in uno con gli slot predefiniti
+func (p MealPlan) withSlots() MealPlan {
+    if len(p.Slots) > 0 {
+        return p
+    }
+    legacy := map[string]*Meal{
+        "colazione": p.Colazione,
+        "spuntino":  p.Spuntino,
+        "pranzo":    p.Pranzo,
+        "merenda":   p.Merenda,
+        "cena":      p.Cena,
+    }
+    converted := MealPlan{Seed: p.Seed, Energy: p.Energy}
+    for _, slot := range DefaultMealSlots {
+        if meal := legacy[slot.Name]; meal != nil {
+            converted.addMeal(slot, *meal)
+        }
+    }
+    return converted
+}
+
+// Indice dello slot da rigenerare; il suo profilo deve esistere ancora
+func (g *Generator) findSlot(p MealPlan, name string) (int, error) {
+    for i, slot := range p.Slots {
+        if slot.Name != name {
+            continue
+        }
+        if _, exists := g.rules[slot.Profile]; !exists {
+            return -1, fmt.Errorf("meal %q: unknown profile %q", slot.Name, slot.Profile)
+        }
+        return i, nil
+    }
+    return -1, fmt.Errorf("meal %q is not part of the plan", name)
+}
+
+// Sostituisce il pasto dello slot indicato, aggiornando anche il campo storico
+func (p *MealPlan) replaceMeal(index int, meal Meal) {
+    slots := append([]SlotMeal(nil), p.Slots...)
+    slots[index].Meal = meal
+    p.Slots = slots
+    p.setLegacyMeal(slots[index].Name, meal)
+}
+
+// Trova nel pasto gli alimenti da bloccare, identificati per chiave di catalogo
+func (g *Generator) lockedItems(meal Meal, keys []string, constraints foodConstraints) ([]Food, error) {
+    var locked []Food
+    for _, key := range keys {
+        found := false
+        for _, item := range meal.Items {
+            itemKey, _, _ := g.resolveFood(item)
+            if itemKey != key {
+                continue
+            }
+            if constraints.Forbidden[key] {
+                return nil, fmt.Errorf("locked item %q conflicts with the requested allergens or diets", key)
+            }
+            locked = append(locked, item)
+            found = true
+            break
+        }
+        if !found {
+            return nil, fmt.Errorf("locked item %q is not part of the meal", key)
+        }
+    }
+    return locked, nil
+}
+
+// Controlla la richiesta e rigenera il pasto indicato lasciando invariati gli altri
+func (g *Generator) RegenerateMeal(request RegenerateMealRequest) (RegeneratedPlan, error) {
+    plan := request.Plan.withSlots()
+    index, err := g.findSlot(plan, request.Meal)
+    if err != nil {
+        return RegeneratedPlan{}, err
+    }
+    slot := plan.Slots[index]
+
+    constraints, err := g.resolveConstraints(request.ExcludeAllergens, request.Diets)
+    if err != nil {
+        return RegeneratedPlan{}, err
+    }
+    constraints.Locked, err = g.lockedItems(slot.Meal, request.Locked, constraints)
+    if err != nil {
+        return RegeneratedPlan{}, err
+    }
+    constraints.Explain = request.Explain
+    slotRule := MealSlot{Name: slot.Name, Profile: slot.Profile, Share: slot.Share}
+    if err := g.checkConstraints([]MealSlot{slotRule}, constraints); err != nil {
+        return RegeneratedPlan{}, err
+    }
+
+    seed := ResolveSeed(request.Seed)
+    plan = g.regenerateMeal(rand.New(rand.NewSource(seed)), plan, index, request.Ingredients, constraints)
+    return RegeneratedPlan{Plan: plan, Meal: slot.Name, Seed: seed}, nil
+}
+
+// Rigenera un solo pasto mantenendo il suo target calorico e gli alimenti
+// bloccati, poi ricalcola i totali della giornata
+func (g *Generator) regenerateMeal(rng *rand.Rand, plan MealPlan, index int, userIngredients []string, constraints foodConstraints) MealPlan {
+    slot := plan.Slots[index]
+    target := slot.TargetCalories
+    if target <= 0 {
+        // Piani generati prima dei target per pasto
+        target = slot.Calories
+    }
+
+    meal := g.generateMealWithUserIngredients(rng, slot.Profile, userIngredients, target, constraints)
+    plan.replaceMeal(index, meal)
+    plan.computeTotals()
+    return plan
+}
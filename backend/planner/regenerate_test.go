@@ -0,0 +1,94 @@
+package planner
+
+import (
+    "math"
+    "reflect"
+    "testing"
+)
+
+func TestRegenerateMeal(t *testing.T) {
+    g := testGenerator(t)
+    seed := int64(7)
+    plan, err := g.GeneratePlan(PlanRequest{TargetCalories: 2000, Seed: &seed})
+    if err != nil {
+        t.Fatal(err)
+    }
+    dinner := plan.Slots[len(plan.Slots)-1]
+    if dinner.Name != "cena" {
+        t.Fatalf("last slot is %s, want cena", dinner.Name)
+    }
+    var protein Food
+    for _, item := range dinner.Items {
+        if rule, _ := g.catalog.Food(item.Key); rule.Category == "protein" {
+            protein = item
+        }
+    }
+    if protein.Key == "" {
+        t.Fatalf("no protein in %v", dinner.Items)
+    }
+    // Piano salvato nella forma storica, senza slot
+    legacy := MealPlan{Pranzo: plan.Pranzo, Cena: plan.Cena}
+
+    tests := []struct {
+        name    string
+        request RegenerateMealRequest
+        wantErr bool
+    }{
+        {name: "dinner", request: RegenerateMealRequest{Plan: plan, Meal: "cena"}},
+        {name: "dinner with the protein locked", request: RegenerateMealRequest{Plan: plan, Meal: "cena", Locked: []string{protein.Key}}},
+        {name: "legacy plan", request: RegenerateMealRequest{Plan: legacy, Meal: "cena"}},
+        {name: "meal not in the plan", request: RegenerateMealRequest{Plan: legacy, Meal: "colazione"}, wantErr: true},
+        {name: "locked item not in the meal", request: RegenerateMealRequest{Plan: plan, Meal: "cena", Locked: []string{"caffe"}}, wantErr: true},
+        {name: "locked item against the diet", request: RegenerateMealRequest{Plan: plan, Meal: "cena", Locked: []string{protein.Key}, Diets: []string{"vegan"}}, wantErr: true},
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            for seed := int64(1); seed <= 5; seed++ {
+                request := tt.request
+                request.Seed = &seed
+                result, err := g.RegenerateMeal(request)
+                if tt.wantErr {
+                    if err == nil {
+                        t.Fatal("expected an error")
+                    }
+                    return
+                }
+                if err != nil {
+                    t.Fatalf("seed %d: %v", seed, err)
+                }
+
+                before := request.Plan.withSlots()
+                var total float64
+                for i, slot := range result.Plan.Slots {
+                    total += slot.Calories
+                    if slot.Name != request.Meal {
+                        if !reflect.DeepEqual(slot, before.Slots[i]) {
+                            t.Errorf("seed %d: %s changed", seed, slot.Name)
+                        }
+                        continue
+                    }
+                    if slot.TargetCalories != before.Slots[i].TargetCalories {
+                        t.Errorf("seed %d: target %g, want %g", seed, slot.TargetCalories, before.Slots[i].TargetCalories)
+                    }
+                    if !reflect.DeepEqual(result.Plan.Cena, &slot.Meal) {
+                        t.Errorf("seed %d: legacy field not updated", seed)
+                    }
+                    for _, key := range request.Locked {
+                        if !containsFood(slot.Items, protein.Name) {
+                            t.Errorf("seed %d: locked %s missing from %v", seed, key, slot.Items)
+                        }
+                        for _, item := range slot.Items {
+                            if item.Key == key && item.Quantity != protein.Quantity {
+                                t.Errorf("seed %d: locked %s quantity %g, want %g", seed, key, item.Quantity, protein.Quantity)
+                            }
+                        }
+                    }
+                }
+                if result.Plan.Calories != math.Round(total) {
+                    t.Errorf("seed %d: plan calories %g, meals sum to %g", seed, result.Plan.Calories, total)
+                }
+            }
+        })
+    }
+}
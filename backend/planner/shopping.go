@@ -0,0 +1,165 @@
+package planner
+
+import (
+    "errors"
+    "fmt"
+    "math"
+    "sort"
+    "strings"
+)
+
+// Reparto usato per gli alimenti senza categoria o reparto noti
+const otherGroup = "Altro"
+
+type ShoppingListRequest struct {
+    Plans      []MealPlan  `json:"plans"`
+    WeeklyPlan *WeeklyPlan `json:"weeklyPlan"`
+    // "category" (predefinito) oppure "aisle"
+    GroupBy    string      `json:"groupBy"`
+}
+
+type ShoppingItem struct {
+    Key         string  `json:"key"`
+    Name        string  `json:"name"`
+    Quantity    float64 `json:"quantity"`
+    Unit        string  `json:"unit"`
+    // Confezioni da acquistare, se il catalogo conosce il formato di vendita
+    Packages    int     `json:"packages,omitempty"`
+    PackageSize float64 `json:"packageSize,omitempty"`
+    PackageName string  `json:"packageName,omitempty"`
+}
+
+type ShoppingGroup struct {
+    Name  string         `json:"name"`
+    Items []ShoppingItem `json:"items"`
+}
+
+type ShoppingList struct {
+    GroupBy string          `json:"groupBy"`
+    Groups  []ShoppingGroup `json:"groups"`
+    Text    string          `json:"text"`
+}
+
+// Pasti del piano: gli slot se presenti, altrimenti i cinque campi storici
+func (p MealPlan) meals() []Meal {
+    if len(p.Slots) > 0 {
+        meals := make([]Meal, 0, len(p.Slots))
+        for _, slot := range p.Slots {
+            meals = append(meals, slot.Meal)
+        }
+        return meals
+    }
+
+    var meals []Meal
+    for _, meal := range []*Meal{p.Colazione, p.Spuntino, p.Pranzo, p.Merenda, p.Cena} {
+        if meal != nil {
+            meals = append(meals, *meal)
+        }
+    }
+    return meals
+}
+
+// Lista della spesa dei piani giornalieri e dei giorni del piano settimanale
+func (g *Generator) ShoppingList(request ShoppingListRequest) (ShoppingList, error) {
+    plans := request.Plans
+    if request.WeeklyPlan != nil {
+        for _, day := range request.WeeklyPlan.Days {
+            plans = append(plans, day.MealPlan)
+        }
+    }
+    if len(plans) == 0 {
+        return ShoppingList{}, errors.New("at least one plan is required")
+    }
+    return g.buildShoppingList(plans, request.GroupBy)
+}
+
+// Somma gli alimenti di tutti i piani per chiave di catalogo e li raggruppa
+func (g *Generator) buildShoppingList(plans []MealPlan, groupBy string) (ShoppingList, error) {
+    if groupBy == "" {
+        groupBy = "category"
+    }
+    if groupBy != "category" && groupBy != "aisle" {
+        return ShoppingList{}, fmt.Errorf("unknown groupBy %q, expected \"category\" or \"aisle\"", groupBy)
+    }
+
+    totals := make(map[string]*ShoppingItem)
+    groupOf := make(map[string]string)
+    for _, plan := range plans {
+        for _, meal := range plan.meals() {
+            for _, food := range meal.Items {
+                key, rule, known := g.resolveFood(food)
+                item, exists := totals[key]
+                if !exists {
+                    item = &ShoppingItem{Key: key, Name: food.Name, Unit: food.Unit}
+                    groupOf[key] = otherGroup
+                    if known {
+                        item.Name = rule.Name
+                        item.Unit = rule.Unit
+                        groupOf[key] = shoppingGroupName(rule, groupBy)
+                    }
+                    totals[key] = item
+                }
+                item.Quantity += food.Quantity
+            }
+        }
+    }
+
+    grouped := make(map[string][]ShoppingItem)
+    for key, item := range totals {
+        item.Quantity = math.Round(item.Quantity)
+        if rule, exists := g.catalog.Food(key); exists && rule.PackageSize > 0 {
+            item.PackageSize = rule.PackageSize
+            item.PackageName = rule.PackageName
+            item.Packages = int(math.Ceil(item.Quantity / rule.PackageSize))
+        }
+        grouped[groupOf[key]] = append(grouped[groupOf[key]], *item)
+    }
+
+    list := ShoppingList{GroupBy: groupBy, Groups: []ShoppingGroup{}}
+    for _, name := range SortedKeys(grouped) {
+        items := grouped[name]
+        sort.Slice(items, func(i, j int) bool { return items[i].Name < items[j].Name })
+        list.Groups = append(list.Groups, ShoppingGroup{Name: name, Items: items})
+    }
+    list.Text = list.formatText()
+    return list, nil
+}
+
+// Trova l'alimento nel catalogo per chiave o, per i piani più vecchi, per nome
+func (g *Generator) resolveFood(food Food) (string, FoodRules, bool) {
+    if rule, exists := g.catalog.Food(food.Key); exists {
+        return food.Key, rule, true
+    }
+    if key, exists := g.findKeyByName(food.Name); exists {
+        rule, _ := g.catalog.Food(key)
+        return key, rule, true
+    }
+    return food.Name, FoodRules{}, false
+}
+
+func shoppingGroupName(rule FoodRules, groupBy string) string {
+    name := categoryDisplayNames[rule.Category]
+    if groupBy == "aisle" {
+        name = rule.Aisle
+    }
+    if name == "" {
+        return otherGroup
+    }
+    return name
+}
+
+func (l ShoppingList) formatText() string {
+    var b strings.Builder
+    b.WriteString("Lista della spesa\n")
+    for _, group := range l.Groups {
+        fmt.Fprintf(&b, "\n%s\n", group.Name)
+        for _, item := range group.Items {
+            fmt.Fprintf(&b, "- %s: %g %s", item.Name, item.Quantity, item.Unit)
+            if item.Packages > 0 {
+                fmt.Fprintf(&b, " (%d x %s da %g %s)", item.Packages, item.PackageName, item.PackageSize, item.Unit)
+            }
+            b.WriteString("\n")
+        }
+    }
+    return b.String()
+}
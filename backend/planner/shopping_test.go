@@ -0,0 +1,85 @@
+package planner
+
+import (
+    "reflect"
+    "strings"
+    "testing"
+)
+
+func TestShoppingList(t *testing.T) {
+    foods := map[string]FoodRules{
+        "riso":     {Name: "Riso", Unit: "g", Category: "carb", Aisle: "Pasta e riso", PackageSize: 1000, PackageName: "pacco"},
+        "pollo":    {Name: "Pollo", Unit: "g", Category: "protein", Aisle: "Carne"},
+        "zucchine": {Name: "Zucchine", Unit: "g", Category: "vegetable"},
+    }
+    g := NewGenerator(NewMapCatalog(foods), nil, Options{})
+    food := func(key string, quantity float64) Food {
+        return newFood(key, foods[key], quantity)
+    }
+    // Un piano giornaliero a slot e uno nella forma storica, con un alimento
+    // salvato senza chiave e uno che il catalogo non conosce
+    daily := MealPlan{Slots: []SlotMeal{
+        {Name: "pranzo", Meal: Meal{Items: []Food{food("riso", 80), food("zucchine", 200)}}},
+        {Name: "cena", Meal: Meal{Items: []Food{food("pollo", 150.4), food("riso", 70)}}},
+    }}
+    legacy := MealPlan{Pranzo: &Meal{Items: []Food{{Name: "Riso", Quantity: 900, Unit: "g"}, {Name: "Pizza", Quantity: 1, Unit: "pz"}}}}
+
+    tests := []struct {
+        name    string
+        request ShoppingListRequest
+        want    []ShoppingGroup
+        // Riga attesa nella lista in testo
+        line    string
+        wantErr bool
+    }{
+        {
+            name:    "by category",
+            request: ShoppingListRequest{Plans: []MealPlan{daily, legacy}},
+            want: []ShoppingGroup{
+                {Name: "Altro", Items: []ShoppingItem{{Key: "Pizza", Name: "Pizza", Quantity: 1, Unit: "pz"}}},
+                {Name: "Carboidrati", Items: []ShoppingItem{{Key: "riso", Name: "Riso", Quantity: 1050, Unit: "g", Packages: 2, PackageSize: 1000, PackageName: "pacco"}}},
+                {Name: "Proteine", Items: []ShoppingItem{{Key: "pollo", Name: "Pollo", Quantity: 150, Unit: "g"}}},
+                {Name: "Verdure", Items: []ShoppingItem{{Key: "zucchine", Name: "Zucchine", Quantity: 200, Unit: "g"}}},
+            },
+            line: "- Riso: 1050 g (2 x pacco da 1000 g)\n",
+        },
+        {
+            name:    "weekly plan by aisle",
+            request: ShoppingListRequest{WeeklyPlan: &WeeklyPlan{Days: []DayPlan{{Day: "lunedì", MealPlan: daily}, {Day: "martedì", MealPlan: daily}}}, GroupBy: "aisle"},
+            want: []ShoppingGroup{
+                {Name: "Altro", Items: []ShoppingItem{{Key: "zucchine", Name: "Zucchine", Quantity: 400, Unit: "g"}}},
+                {Name: "Carne", Items: []ShoppingItem{{Key: "pollo", Name: "Pollo", Quantity: 301, Unit: "g"}}},
+                {Name: "Pasta e riso", Items: []ShoppingItem{{Key: "riso", Name: "Riso", Quantity: 300, Unit: "g", Packages: 1, PackageSize: 1000, PackageName: "pacco"}}},
+            },
+            line: "- Pollo: 301 g\n",
+        },
+        {name: "no plans", request: ShoppingListRequest{}, wantErr: true},
+        {name: "unknown grouping", request: ShoppingListRequest{Plans: []MealPlan{daily}, GroupBy: "store"}, wantErr: true},
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            list, err := g.ShoppingList(tt.request)
+            if tt.wantErr {
+                if err == nil {
+                    t.Fatal("expected an error")
+                }
+                return
+            }
+            if err != nil {
+                t.Fatal(err)
+            }
+            if !reflect.DeepEqual(list.Groups, tt.want) {
+                t.Errorf("groups %+v, want %+v", list.Groups, tt.want)
+            }
+            if !strings.Contains(list.Text, tt.line) {
+                t.Errorf("text without %q:\n%s", tt.line, list.Text)
+            }
+            for _, group := range tt.want {
+                if !strings.Contains(list.Text, "\n"+group.Name+"\n") {
+                    t.Errorf("text without group %s:\n%s", group.Name, list.Text)
+                }
+            }
+        })
+    }
+}
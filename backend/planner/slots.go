@@ -0,0 +1,104 @@
+package planner
+
+import (
+    "fmt"
+    "math"
+)
+
+// Scarto ammesso sulla somma delle quote calorie degli slot
+const shareTolerance = 0.01
+
+// Un pasto della giornata: nome libero, profilo di regole (chiave di MealRules,
+// usata anche per scegliere gli alimenti tramite MealTypes) e quota calorie
+type MealSlot struct {
+    Name    string  `json:"name"`
+    Profile string  `json:"profile"`
+    Share   float64 `json:"share"`
+}
+
+type SlotMeal struct {
+    Name    string  `json:"name"`
+    Profile string  `json:"profile"`
+    Share   float64 `json:"share"`
+    Meal
+}
+
+// Suddivisione predefinita delle calorie giornaliere
+var DefaultMealSlots = []MealSlot{
+    {Name: "colazione", Profile: "colazione", Share: 0.25},
+    {Name: "spuntino", Profile: "spuntino", Share: 0.10},
+    {Name: "pranzo", Profile: "pranzo", Share: 0.35},
+    {Name: "merenda", Profile: "merenda", Share: 0.10},
+    {Name: "cena", Profile: "cena", Share: 0.20},
+}
+
+// Completa e controlla gli slot richiesti; senza slot usa quelli delle opzioni
+func (g *Generator) resolveSlots(slots []MealSlot) ([]MealSlot, error) {
+    if len(slots) == 0 {
+        return g.options.Slots, nil
+    }
+
+    resolved := make([]MealSlot, 0, len(slots))
+    seen := make(map[string]bool)
+    var totalShare float64
+    for i, slot := range slots {
+        if slot.Name == "" {
+            return nil, fmt.Errorf("slot %d: name is required", i)
+        }
+        if seen[slot.Name] {
+            return nil, fmt.Errorf("slot %q: duplicate name", slot.Name)
+        }
+        seen[slot.Name] = true
+
+        if slot.Profile == "" {
+            slot.Profile = slot.Name
+        }
+        if _, exists := g.rules[slot.Profile]; !exists {
+            return nil, fmt.Errorf("slot %q: unknown profile %q", slot.Name, slot.Profile)
+        }
+        if slot.Share <= 0 {
+            return nil, fmt.Errorf("slot %q: share must be positive", slot.Name)
+        }
+        totalShare += slot.Share
+        resolved = append(resolved, slot)
+    }
+
+    if math.Abs(totalShare-1) > shareTolerance {
+        return nil, fmt.Errorf("slot shares must add up to 1, got %.2f", totalShare)
+    }
+    return resolved, nil
+}
+
+// Pasti del piano nell'ordine della giornata; i piani nel formato storico
+// vengono convertiti negli slot predefiniti
+func (p MealPlan) SlotMeals() []SlotMeal {
+    return p.withSlots().Slots
+}
+
+// Aggiunge il pasto in coda agli slot e, se il nome corrisponde a uno dei
+// cinque pasti storici, anche al relativo campo per i client esistenti
+func (p *MealPlan) addMeal(slot MealSlot, meal Meal) {
+    p.Slots = append(p.Slots, SlotMeal{
+        Name:    slot.Name,
+        Profile: slot.Profile,
+        Share:   slot.Share,
+        Meal:    meal,
+    })
+    p.setLegacyMeal(slot.Name, meal)
+}
+
+func (p *MealPlan) setLegacyMeal(name string, meal Meal) {
+    legacy := meal
+    switch name {
+    case "colazione":
+        p.Colazione = &legacy
+    case "spuntino":
+        p.Spuntino = &legacy
+    case "pranzo":
+        p.Pranzo = &legacy
+    case "merenda":
+        p.Merenda = &legacy
+    case "cena":
+        p.Cena = &legacy
+    }
+}
@@ -0,0 +1,159 @@
+package planner
+
+import (
+    "errors"
+    "fmt"
+    "math"
+    "sort"
+)
+
+// Scarto predefinito, in frazione delle calorie dell'originale, entro cui
+// un'alternativa è considerata equivalente
+const DefaultSubstitutionTolerance = 0.2
+
+var ErrFoodNotFound = errors.New("food not found")
+
+// Richiesta di alternative per un alimento; Quantity e Tolerance a zero
+// assumono la porzione standard e lo scarto predefinito
+type AlternativesRequest struct {
+    Key              string
+    MealType         string
+    Quantity         float64
+    Tolerance        float64
+    ExcludeAllergens []string
+    Diets            []string
+}
+
+type Alternative struct {
+    Key      string  `json:"key"`
+    Name     string  `json:"name"`
+    Quantity float64 `json:"quantity"`
+    Unit     string  `json:"unit"`
+    Calories float64 `json:"calories"`
+    Macros
+    // Scarto calorico e spostamento tra macronutrienti rispetto all'originale,
+    // entrambi in frazione delle sue calorie; la somma ordina le alternative
+    CalorieDeviation float64 `json:"calorieDeviation"`
+    MacroDeviation   float64 `json:"macroDeviation"`
+    Score            float64 `json:"score"`
+}
+
+type Substitution struct {
+    Food
+    MealType     string        `json:"mealType,omitempty"`
+    Tolerance    float64       `json:"tolerance"`
+    Alternatives []Alternative `json:"alternatives"`
+}
+
+// Cerca gli alimenti della stessa categoria che possono sostituire l'originale
+// nel pasto indicato (o in uno dei suoi pasti se mealType è vuoto), ciascuno
+// con la porzione più vicina per calorie e macronutrienti
+func (g *Generator) Alternatives(request AlternativesRequest) (Substitution, error) {
+    key, mealType, quantity, tolerance := request.Key, request.MealType, request.Quantity, request.Tolerance
+    original, exists := g.catalog.Food(key)
+    if !exists {
+        return Substitution{}, ErrFoodNotFound
+    }
+    if mealType != "" {
+        if _, exists := g.rules[mealType]; !exists {
+            return Substitution{}, fmt.Errorf("unknown meal type %q", mealType)
+        }
+    }
+    if quantity < 0 {
+        return Substitution{}, fmt.Errorf("quantity must not be negative")
+    }
+    if quantity == 0 {
+        quantity = original.StandardPortion
+    }
+    if tolerance == 0 {
+        tolerance = DefaultSubstitutionTolerance
+    }
+    if tolerance < 0 || tolerance > 1 {
+        return Substitution{}, fmt.Errorf("tolerance must be between 0 and 1")
+    }
+    constraints, err := g.resolveConstraints(request.ExcludeAllergens, request.Diets)
+    if err != nil {
+        return Substitution{}, err
+    }
+
+    result := Substitution{
+        Food:         newFood(key, original, quantity),
+        MealType:     mealType,
+        Tolerance:    tolerance,
+        Alternatives: []Alternative{},
+    }
+    target := calculateCalories(quantity, original.CaloriesPer100g)
+    if target <= 0 {
+        return result, nil
+    }
+    targetMacros := calculateMacros(quantity, original)
+
+    for _, candidateKey := range g.catalog.FoodsInCategory(original.Category) {
+        rule, _ := g.catalog.Food(candidateKey)
+        if candidateKey == key || constraints.Forbidden[candidateKey] {
+            continue
+        }
+        if !sharesMeal(rule, original, mealType) {
+            continue
+        }
+
+        alternative, found := bestPortion(candidateKey, rule, target, targetMacros)
+        if found && alternative.CalorieDeviation <= tolerance && alternative.MacroDeviation <= tolerance {
+            result.Alternatives = append(result.Alternatives, alternative)
+        }
+    }
+
+    sort.SliceStable(result.Alternatives, func(i, j int) bool {
+        return result.Alternatives[i].Score < result.Alternatives[j].Score
+    })
+    return result, nil
+}
+
+func sharesMeal(rule, original FoodRules, mealType string) bool {
+    if mealType != "" {
+        return isAppropriateForMeal(rule, mealType)
+    }
+    for _, meal := range original.MealTypes {
+        if isAppropriateForMeal(rule, meal) {
+            return true
+        }
+    }
+    return false
+}
+
+// Prova le porzioni consentite a passi di portionStep e tiene la più vicina
+func bestPortion(key string, rule FoodRules, target float64, targetMacros Macros) (Alternative, bool) {
+    if rule.CaloriesPer100g <= 0 {
+        return Alternative{}, false
+    }
+    min, max := smallestPortion(rule), math.Max(rule.MaxPortion, rule.StandardPortion)
+
+    var best Alternative
+    bestScore := math.Inf(1)
+    for quantity := min; quantity <= max; quantity += portionStep {
+        calories := calculateCalories(quantity, rule.CaloriesPer100g)
+        macros := calculateMacros(quantity, rule)
+        calorieDeviation := math.Abs(calories-target) / target
+        macroDeviation := (math.Abs(macros.Protein-targetMacros.Protein)*4 +
+            math.Abs(macros.Carbs-targetMacros.Carbs)*4 +
+            math.Abs(macros.Fat-targetMacros.Fat)*9) / target
+        score := calorieDeviation + macroDeviation
+        if score >= bestScore {
+            continue
+        }
+        bestScore = score
+        best = Alternative{
+            Key:              key,
+            Name:             rule.Name,
+            Quantity:         quantity,
+            Unit:             rule.Unit,
+            Calories:         math.Round(calories),
+            Macros:           macros.rounded(),
+            CalorieDeviation: math.Round(calorieDeviation*1000) / 1000,
+            MacroDeviation:   math.Round(macroDeviation*1000) / 1000,
+            Score:            math.Round(score*1000) / 1000,
+        }
+    }
+    return best, !math.IsInf(bestScore, 1)
+}
+
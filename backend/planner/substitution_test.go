@@ -0,0 +1,69 @@
+package planner
+
+import (
+    "errors"
+    "reflect"
+    "testing"
+)
+
+func TestAlternatives(t *testing.T) {
+    foods := map[string]FoodRules{
+        "pollo":    {Name: "Pollo", Unit: "g", CaloriesPer100g: 110, ProteinPer100g: 23, FatPer100g: 1.5, Category: "protein", MealTypes: []string{"pranzo", "cena"}, StandardPortion: 150, MinPortion: 100, MaxPortion: 200},
+        "tacchino": {Name: "Tacchino", Unit: "g", CaloriesPer100g: 107, ProteinPer100g: 24, FatPer100g: 1, Category: "protein", MealTypes: []string{"cena"}, StandardPortion: 150, MinPortion: 100, MaxPortion: 200},
+        "merluzzo": {Name: "Merluzzo", Unit: "g", CaloriesPer100g: 82, ProteinPer100g: 18, FatPer100g: 0.7, Category: "protein", MealTypes: []string{"cena"}, StandardPortion: 200, MinPortion: 150, MaxPortion: 300, Allergens: []string{"fish"}},
+        "seitan":   {Name: "Seitan", Unit: "g", CaloriesPer100g: 120, ProteinPer100g: 24, CarbsPer100g: 1, FatPer100g: 1.9, Category: "protein", MealTypes: []string{"pranzo"}, StandardPortion: 120, MinPortion: 80, MaxPortion: 200},
+        // Troppo grasso per avvicinarsi ai macronutrienti del pollo
+        "salmone":  {Name: "Salmone", Unit: "g", CaloriesPer100g: 208, ProteinPer100g: 20, FatPer100g: 13.4, Category: "protein", MealTypes: []string{"cena"}, StandardPortion: 150, MinPortion: 100, MaxPortion: 200},
+        "riso":     {Name: "Riso", Unit: "g", CaloriesPer100g: 350, CarbsPer100g: 78, Category: "carb", MealTypes: []string{"cena"}, StandardPortion: 80, MinPortion: 50, MaxPortion: 150},
+    }
+    rules := map[string]MealRules{"colazione": {}, "pranzo": {}, "cena": {}}
+    g := NewGenerator(NewMapCatalog(foods), rules, Options{})
+
+    tests := []struct {
+        name    string
+        request AlternativesRequest
+        want    []string
+        wantErr bool
+    }{
+        {name: "dinner", request: AlternativesRequest{Key: "pollo", MealType: "cena"}, want: []string{"merluzzo", "tacchino"}},
+        {name: "any meal of the original", request: AlternativesRequest{Key: "pollo"}, want: []string{"merluzzo", "seitan", "tacchino"}},
+        {name: "fish excluded", request: AlternativesRequest{Key: "pollo", MealType: "cena", ExcludeAllergens: []string{"fish"}}, want: []string{"tacchino"}},
+        {name: "tight tolerance", request: AlternativesRequest{Key: "pollo", MealType: "cena", Tolerance: 0.08}, want: []string{"tacchino"}},
+        {name: "no alternative for the meal", request: AlternativesRequest{Key: "pollo", MealType: "colazione"}, want: []string{}},
+        {name: "unknown food", request: AlternativesRequest{Key: "pizza"}, wantErr: true},
+        {name: "unknown meal type", request: AlternativesRequest{Key: "pollo", MealType: "brunch"}, wantErr: true},
+        {name: "negative quantity", request: AlternativesRequest{Key: "pollo", Quantity: -10}, wantErr: true},
+        {name: "tolerance over 1", request: AlternativesRequest{Key: "pollo", Tolerance: 1.5}, wantErr: true},
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            result, err := g.Alternatives(tt.request)
+            if tt.wantErr {
+                if err == nil {
+                    t.Fatal("expected an error")
+                }
+                if tt.request.Key == "pizza" && !errors.Is(err, ErrFoodNotFound) {
+                    t.Errorf("got %v, want %v", err, ErrFoodNotFound)
+                }
+                return
+            }
+            if err != nil {
+                t.Fatal(err)
+            }
+            keys := []string{}
+            for i, alternative := range result.Alternatives {
+                keys = append(keys, alternative.Key)
+                if alternative.CalorieDeviation > result.Tolerance || alternative.MacroDeviation > result.Tolerance {
+                    t.Errorf("%s outside the tolerance: %+v", alternative.Key, alternative)
+                }
+                if i > 0 && alternative.Score < result.Alternatives[i-1].Score {
+                    t.Errorf("%s ranked after a worse alternative", alternative.Key)
+                }
+            }
+            if !reflect.DeepEqual(keys, tt.want) {
+                t.Errorf("alternatives %v, want %v", keys, tt.want)
+            }
+        })
+    }
+}
@@ -0,0 +1,174 @@
+package planner
+
+import (
+    "fmt"
+    "math"
+)
+
+// Codici delle violazioni restituite da /api/validate-plan
+const (
+    ViolationUnknownFood             = "unknown_food"
+    ViolationUnknownMeal             = "unknown_meal_profile"
+    ViolationMissingRequiredCategory = "missing_required_category"
+    ViolationCategoryLimitExceeded   = "category_limit_exceeded"
+    ViolationPortionBelowMin         = "portion_below_min"
+    ViolationPortionAboveMax         = "portion_above_max"
+    ViolationMealTypeNotAllowed      = "meal_type_not_allowed"
+    ViolationFrequencyExceeded       = "frequency_exceeded"
+    ViolationCalorieDeviation        = "calorie_deviation"
+)
+
+type Violation struct {
+    Code     string  `json:"code"`
+    Meal     string  `json:"meal,omitempty"`
+    Food     string  `json:"food,omitempty"`
+    Category string  `json:"category,omitempty"`
+    // Valore trovato e limite superato, quando la regola è numerica
+    Value    float64 `json:"value,omitempty"`
+    Limit    float64 `json:"limit,omitempty"`
+    Message  string  `json:"message"`
+}
+
+type PlanValidation struct {
+    Valid          bool        `json:"valid"`
+    Calories       float64     `json:"calories"`
+    TargetCalories float64     `json:"targetCalories"`
+    Violations     []Violation `json:"violations"`
+}
+
+// Controlla un piano, anche modificato a mano, contro le regole del catalogo;
+// le calorie vengono ricalcolate dalle quantità. Con target a zero si usa la
+// somma dei target dei pasti
+func (g *Generator) ValidatePlan(plan MealPlan, targetCalories float64) PlanValidation {
+    plan = plan.withSlots()
+    result := PlanValidation{Violations: []Violation{}}
+    add := func(v Violation) {
+        result.Violations = append(result.Violations, v)
+    }
+
+    usage := make(map[string]int)
+    var usageOrder []string
+    var slotTargets float64
+    for _, slot := range plan.Slots {
+        slotTargets += slot.TargetCalories
+        rules, knownProfile := g.rules[slot.Profile]
+        if !knownProfile {
+            add(Violation{
+                Code:    ViolationUnknownMeal,
+                Meal:    slot.Name,
+                Message: fmt.Sprintf("%s: profilo %q sconosciuto", slot.Name, slot.Profile),
+            })
+        }
+
+        categoryCalories := make(map[string]float64)
+        presentCategories := make(map[string]bool)
+        for _, item := range slot.Items {
+            key, rule, known := g.resolveFood(item)
+            if !known {
+                add(Violation{
+                    Code:    ViolationUnknownFood,
+                    Meal:    slot.Name,
+                    Food:    item.Name,
+                    Message: fmt.Sprintf("%s: %s non è nel catalogo", slot.Name, item.Name),
+                })
+                result.Calories += item.Calories
+                continue
+            }
+
+            calories := calculateCalories(item.Quantity, rule.CaloriesPer100g)
+            result.Calories += calories
+            categoryCalories[rule.Category] += calories
+            presentCategories[rule.Category] = true
+            if usage[key] == 0 {
+                usageOrder = append(usageOrder, key)
+            }
+            usage[key]++
+
+            if item.Quantity < rule.MinPortion {
+                add(Violation{
+                    Code:    ViolationPortionBelowMin,
+                    Meal:    slot.Name,
+                    Food:    key,
+                    Value:   item.Quantity,
+                    Limit:   rule.MinPortion,
+                    Message: fmt.Sprintf("%s: %s %g %s sotto la porzione minima di %g", slot.Name, rule.Name, item.Quantity, rule.Unit, rule.MinPortion),
+                })
+            }
+            if rule.MaxPortion > 0 && item.Quantity > rule.MaxPortion {
+                add(Violation{
+                    Code:    ViolationPortionAboveMax,
+                    Meal:    slot.Name,
+                    Food:    key,
+                    Value:   item.Quantity,
+                    Limit:   rule.MaxPortion,
+                    Message: fmt.Sprintf("%s: %s %g %s oltre la porzione massima di %g", slot.Name, rule.Name, item.Quantity, rule.Unit, rule.MaxPortion),
+                })
+            }
+            if knownProfile && !isAppropriateForMeal(rule, slot.Profile) {
+                add(Violation{
+                    Code:    ViolationMealTypeNotAllowed,
+                    Meal:    slot.Name,
+                    Food:    key,
+                    Message: fmt.Sprintf("%s: %s non è previsto per %s", slot.Name, rule.Name, slot.Profile),
+                })
+            }
+        }
+        if !knownProfile {
+            continue
+        }
+
+        for _, category := range rules.RequiredCategories {
+            if !presentCategories[category] {
+                add(Violation{
+                    Code:     ViolationMissingRequiredCategory,
+                    Meal:     slot.Name,
+                    Category: category,
+                    Message:  fmt.Sprintf("%s: manca un alimento della categoria %s", slot.Name, categoryDisplayNames[category]),
+                })
+            }
+        }
+        for _, category := range SortedKeys(rules.CategoryLimits) {
+            limit := rules.CategoryLimits[category]
+            if calories := math.Round(categoryCalories[category]); calories > limit {
+                add(Violation{
+                    Code:     ViolationCategoryLimitExceeded,
+                    Meal:     slot.Name,
+                    Category: category,
+                    Value:    calories,
+                    Limit:    limit,
+                    Message:  fmt.Sprintf("%s: %.0f kcal di %s oltre il limite di %.0f", slot.Name, calories, categoryDisplayNames[category], limit),
+                })
+            }
+        }
+    }
+
+    for _, key := range usageOrder {
+        rule, _ := g.catalog.Food(key)
+        if frequencyExhausted(rule, usage[key]-1) {
+            add(Violation{
+                Code:    ViolationFrequencyExceeded,
+                Food:    key,
+                Value:   float64(usage[key]),
+                Limit:   float64(rule.Frequency),
+                Message: fmt.Sprintf("%s usato %d volte, oltre la frequenza di %d", rule.Name, usage[key], rule.Frequency),
+            })
+        }
+    }
+
+    result.Calories = math.Round(result.Calories)
+    if targetCalories <= 0 {
+        targetCalories = slotTargets
+    }
+    result.TargetCalories = math.Round(targetCalories)
+    if result.TargetCalories > 0 && math.Abs(result.Calories-result.TargetCalories) > result.TargetCalories*g.options.CalorieTolerance {
+        add(Violation{
+            Code:    ViolationCalorieDeviation,
+            Value:   result.Calories,
+            Limit:   result.TargetCalories,
+            Message: fmt.Sprintf("totale di %.0f kcal, scarto di %+.0f rispetto al target di %.0f", result.Calories, result.Calories-result.TargetCalories, result.TargetCalories),
+        })
+    }
+
+    result.Valid = len(result.Violations) == 0
+    return result
+}
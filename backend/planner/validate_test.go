@@ -0,0 +1,97 @@
+package planner
+
+import (
+    "reflect"
+    "testing"
+)
+
+func TestValidatePlan(t *testing.T) {
+    g := testGenerator(t)
+    food := func(key string, quantity float64) Food {
+        rule, exists := g.catalog.Food(key)
+        if !exists {
+            t.Fatalf("unknown food %s", key)
+        }
+        return newFood(key, rule, quantity)
+    }
+    slot := func(name, profile string, targetCalories float64, items ...Food) SlotMeal {
+        return SlotMeal{Name: name, Profile: profile, Share: 1, Meal: Meal{Items: items, TargetCalories: targetCalories}}
+    }
+    // Spuntino regolare da 204 kcal
+    snack := func() []Food {
+        return []Food{food("frutta_fresca", 150), food("crackers_integrali", 30)}
+    }
+
+    tests := []struct {
+        name   string
+        slots  []SlotMeal
+        target float64
+        want   []string
+    }{
+        {
+            name:  "valid plan",
+            slots: []SlotMeal{slot("spuntino", "spuntino", 204, snack()...)},
+        },
+        {
+            name:  "unknown food",
+            slots: []SlotMeal{slot("spuntino", "spuntino", 454, append(snack(), Food{Name: "Pizza", Quantity: 100, Calories: 250})...)},
+            want:  []string{ViolationUnknownFood},
+        },
+        {
+            name:  "unknown meal profile",
+            slots: []SlotMeal{slot("brunch", "brunch", 204, snack()...)},
+            want:  []string{ViolationUnknownMeal},
+        },
+        {
+            name:  "missing required category",
+            slots: []SlotMeal{slot("spuntino", "spuntino", 75, food("frutta_fresca", 150))},
+            want:  []string{ViolationMissingRequiredCategory},
+        },
+        {
+            name:  "portion below min",
+            slots: []SlotMeal{slot("spuntino", "spuntino", 179, food("frutta_fresca", 100), food("crackers_integrali", 30))},
+            want:  []string{ViolationPortionBelowMin},
+        },
+        {
+            name:  "portion above max and category limit",
+            slots: []SlotMeal{slot("spuntino", "spuntino", 254, food("frutta_fresca", 250), food("crackers_integrali", 30))},
+            want:  []string{ViolationPortionAboveMax, ViolationCategoryLimitExceeded},
+        },
+        {
+            name:  "food not planned for the meal",
+            slots: []SlotMeal{slot("spuntino", "spuntino", 204, append(snack(), food("caffe", 30))...)},
+            want:  []string{ViolationMealTypeNotAllowed},
+        },
+        {
+            name: "weekly frequency exceeded",
+            slots: []SlotMeal{
+                slot("merenda", "merenda", 282, append(snack(), food("grana", 20))...),
+                slot("merenda2", "merenda", 282, append(snack(), food("grana", 20))...),
+                slot("merenda3", "merenda", 282, append(snack(), food("grana", 20))...),
+            },
+            want: []string{ViolationFrequencyExceeded},
+        },
+        {
+            name:   "calories far from the target",
+            slots:  []SlotMeal{slot("spuntino", "spuntino", 204, snack()...)},
+            target: 500,
+            want:   []string{ViolationCalorieDeviation},
+        },
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            result := g.ValidatePlan(MealPlan{Slots: tt.slots}, tt.target)
+            var codes []string
+            for _, violation := range result.Violations {
+                codes = append(codes, violation.Code)
+            }
+            if !reflect.DeepEqual(codes, tt.want) {
+                t.Errorf("violations %v, want %v", result.Violations, tt.want)
+            }
+            if result.Valid != (len(tt.want) == 0) {
+                t.Errorf("valid = %v with violations %v", result.Valid, codes)
+            }
+        })
+    }
+}
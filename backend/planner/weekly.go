@@ -0,0 +1,153 @@
+package planner
+
+import (
+    "errors"
+    "fmt"
+    "math"
+    "math/rand"
+)
+
+var weekDays = []string{"lunedi", "martedi", "mercoledi", "giovedi", "venerdi", "sabato", "domenica"}
+
+type DayPlan struct {
+    Day string `json:"day"`
+    MealPlan
+}
+
+type WeeklyPlan struct {
+    Days     []DayPlan            `json:"days"`
+    Calories float64              `json:"calories"`
+    Macros
+    // Quante volte ogni alimento compare nella settimana
+    Usage    map[string]int       `json:"usage"`
+    Warnings []string             `json:"warnings,omitempty"`
+    // Ingredienti scelti dall'utente mai usati nella settimana
+    Unplaced []UnplacedIngredient `json:"unplacedIngredients,omitempty"`
+    Seed     int64                `json:"seed"`
+    Energy   *EnergyCalculation   `json:"energy,omitempty"`
+}
+
+func (g *Generator) findKeyByName(name string) (string, bool) {
+    for _, key := range g.catalog.Keys() {
+        if rule, _ := g.catalog.Food(key); rule.Name == name {
+            return key, true
+        }
+    }
+    return "", false
+}
+
+// Un alimento può comparire al massimo Frequency volte nella settimana (0
+// senza limite); per gli alimenti Required il limite è almeno di uno al giorno
+func frequencyExhausted(rule FoodRules, used int) bool {
+    return rule.Frequency > 0 && used >= rule.Frequency
+}
+
+// Controlla la richiesta e genera il piano di una settimana
+func (g *Generator) GenerateWeeklyPlan(request PlanRequest) (WeeklyPlan, error) {
+    slots, targetCalories, energy, constraints, err := g.preparePlan(request)
+    if err != nil {
+        return WeeklyPlan{}, err
+    }
+
+    seed := ResolveSeed(request.Seed)
+    week := g.generateWeeklyPlan(rand.New(rand.NewSource(seed)), slots, request.Ingredients, targetCalories, constraints)
+    week.Seed = seed
+    week.Energy = energy
+    return week, nil
+}
+
+// Genera sette giorni di pasti rispettando la Frequency degli alimenti
+// e cambiando le fonti proteiche da un giorno al successivo: gli alimenti
+// esauriti e le proteine del giorno prima sono vietati, salvo che il pasto
+// resti senza alternative per una categoria obbligatoria
+func (g *Generator) generateWeeklyPlan(rng *rand.Rand, slots []MealSlot, userIngredients []string, targetCalories float64, base foodConstraints) WeeklyPlan {
+    week := WeeklyPlan{Usage: make(map[string]int)}
+    previousProteins := make(map[string]bool)
+
+    for _, day := range weekDays {
+        var plan MealPlan
+        todayProteins := make(map[string]bool)
+
+        for _, slot := range slots {
+            exhausted := make(map[string]bool)
+            for _, key := range g.catalog.Keys() {
+                if rule, _ := g.catalog.Food(key); frequencyExhausted(rule, week.Usage[key]) {
+                    exhausted[key] = true
+                }
+            }
+            constraints := foodConstraints{Forbidden: unionKeys(base.Forbidden, exhausted, previousProteins), Avoid: make(map[string]bool), Uses: week.Usage, Explain: base.Explain}
+            // Se una categoria obbligatoria resta scoperta tornano ammesse, ma da
+            // evitare, prima le sue proteine del giorno prima e poi i suoi alimenti
+            // esauriti; gli esclusi dalla richiesta restano vietati
+            for _, relaxable := range []map[string]bool{previousProteins, exhausted} {
+                var unsatisfiable *UnsatisfiableError
+                for errors.As(g.checkConstraints([]MealSlot{slot}, constraints), &unsatisfiable) {
+                    relaxed := false
+                    for key := range relaxable {
+                        rule, _ := g.catalog.Food(key)
+                        if rule.Category == unsatisfiable.Category && constraints.Forbidden[key] && !base.Forbidden[key] {
+                            delete(constraints.Forbidden, key)
+                            constraints.Avoid[key] = true
+                            relaxed = true
+                        }
+                    }
+                    if !relaxed {
+                        break
+                    }
+                }
+            }
+            // Anche ripetere una proteina nello stesso giorno va evitato
+            constraints.Avoid = unionKeys(constraints.Avoid, todayProteins)
+
+            meal := g.generateMealWithUserIngredients(rng, slot.Profile, prioritizeIngredients(userIngredients, week.Usage), targetCalories*slot.Share, constraints)
+            for _, item := range meal.Items {
+                key, rule, exists := g.resolveFood(item)
+                if !exists {
+                    continue
+                }
+                if frequencyExhausted(rule, week.Usage[key]) {
+                    week.Warnings = append(week.Warnings, fmt.Sprintf("%s %s: %s oltre la frequenza settimanale di %d", day, slot.Name, rule.Name, rule.Frequency))
+                }
+                if rule.Category == "protein" && previousProteins[key] {
+                    week.Warnings = append(week.Warnings, fmt.Sprintf("%s %s: %s ripetuto dal giorno precedente", day, slot.Name, rule.Name))
+                }
+                if rule.Category == "protein" {
+                    todayProteins[key] = true
+                }
+                week.Usage[key]++
+            }
+            plan.addMeal(slot, meal)
+        }
+
+        plan.computeTotals()
+        week.Days = append(week.Days, DayPlan{Day: day, MealPlan: plan})
+        previousProteins = todayProteins
+    }
+
+    week.computeTotals()
+    week.Unplaced = g.unplacedIngredients(userIngredients, slots, base, week.Usage)
+    return week
+}
+
+func (w *WeeklyPlan) computeTotals() {
+    var calories float64
+    var macros Macros
+    for _, day := range w.Days {
+        calories += day.Calories
+        macros.add(day.Macros)
+    }
+    w.Calories = math.Round(calories)
+    w.Macros = macros.rounded()
+}
+
+func unionKeys(sets ...map[string]bool) map[string]bool {
+    union := make(map[string]bool)
+    for _, set := range sets {
+        for key, present := range set {
+            if present {
+                union[key] = true
+            }
+        }
+    }
+    return union
+}
@@ -0,0 +1,77 @@
+package planner
+
+import (
+    "strings"
+    "testing"
+)
+
+func TestWeeklyPlanHonorsFrequency(t *testing.T) {
+    g := testGenerator(t)
+    tests := []struct {
+        name    string
+        request PlanRequest
+    }{
+        {name: "default", request: PlanRequest{TargetCalories: 2000}},
+        {name: "low target", request: PlanRequest{TargetCalories: 1500}},
+        {name: "high target", request: PlanRequest{TargetCalories: 2800}},
+        {name: "lactose-free", request: PlanRequest{TargetCalories: 2000, Diets: []string{"lactose-free"}}},
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            for seed := int64(1); seed <= 8; seed++ {
+                request := tt.request
+                request.Seed = &seed
+                week, err := g.GenerateWeeklyPlan(request)
+                if err != nil {
+                    t.Fatalf("seed %d: %v", seed, err)
+                }
+
+                counts := make(map[string]int)
+                for _, day := range week.Days {
+                    for _, slot := range day.Slots {
+                        for _, item := range slot.Items {
+                            counts[item.Key]++
+                        }
+                    }
+                }
+                for key, count := range counts {
+                    rule, _ := g.catalog.Food(key)
+                    if rule.Frequency > 0 && count > rule.Frequency {
+                        t.Errorf("seed %d: %s used %d times, frequency %d", seed, key, count, rule.Frequency)
+                    }
+                    if week.Usage[key] != count {
+                        t.Errorf("seed %d: usage of %s is %d, counted %d", seed, key, week.Usage[key], count)
+                    }
+                }
+                for _, warning := range week.Warnings {
+                    if strings.Contains(warning, "frequenza") {
+                        t.Errorf("seed %d: %s", seed, warning)
+                    }
+                }
+            }
+        })
+    }
+}
+
+func TestValidateFoodRequiredFrequency(t *testing.T) {
+    rules := map[string]MealRules{"colazione": {}}
+    tests := []struct {
+        required  bool
+        frequency int
+        valid     bool
+    }{
+        {required: true, frequency: 0, valid: true},
+        {required: true, frequency: 1, valid: false},
+        {required: true, frequency: 6, valid: false},
+        {required: true, frequency: 7, valid: true},
+        {required: true, frequency: 14, valid: true},
+        {required: false, frequency: 1, valid: true},
+    }
+    for _, tt := range tests {
+        food := FoodRules{Name: "Caffè", Unit: "g", Category: "beverage", StandardPortion: 30, MinPortion: 30, MaxPortion: 30, MealTypes: []string{"colazione"}, Required: tt.required, Frequency: tt.frequency}
+        if problems := ValidateFood(food, rules); (len(problems) == 0) != tt.valid {
+            t.Errorf("required %v, frequency %d: problems %v, want valid %v", tt.required, tt.frequency, problems, tt.valid)
+        }
+    }
+}
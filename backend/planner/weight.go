@@ -0,0 +1,242 @@
+package planner
+
+import (
+    "errors"
+    "fmt"
+    "math"
+    "sort"
+    "time"
+)
+
+// Pesata registrata in un giorno (data nel formato YYYY-MM-DD)
+type WeighIn struct {
+    Date     string  `json:"date"`
+    WeightKg float64 `json:"weightKg"`
+}
+
+type TrendPoint struct {
+    Date     string  `json:"date"`
+    WeightKg float64 `json:"weightKg"`
+    // Media delle pesate degli ultimi sette giorni, questa inclusa
+    Average  float64 `json:"average"`
+}
+
+// Andamento del peso: la variazione settimanale è la pendenza della media
+// mobile nelle ultime settimane, meno sensibile alle oscillazioni giornaliere
+type WeightTrend struct {
+    From            string       `json:"from,omitempty"`
+    To              string       `json:"to,omitempty"`
+    Latest          float64      `json:"latest"`
+    MovingAverage   float64      `json:"movingAverage"`
+    WeeklyChangeKg  float64      `json:"weeklyChangeKg"`
+    WeeklyChangePct float64      `json:"weeklyChangePct"`
+    // Falso se le pesate non bastano a stimare la variazione settimanale
+    Reliable        bool         `json:"reliable"`
+    Points          []TrendPoint `json:"points"`
+}
+
+// Richiesta del target adattivo per il prossimo piano settimanale
+type AdaptiveTargetRequest struct {
+    // Calorie giornaliere seguite finora
+    CurrentCalories int      `json:"currentCalories"`
+    Goal            string   `json:"goal"`
+    // Variazione settimanale desiderata; se assente dipende dall'obiettivo
+    WeeklyRateKg    *float64 `json:"weeklyRateKg"`
+    // Se indicato, il target non scende sotto il minimo per sesso
+    Sex             string   `json:"sex"`
+}
+
+type AdaptiveTarget struct {
+    CurrentCalories        float64     `json:"currentCalories"`
+    SuggestedCalories      float64     `json:"suggestedCalories"`
+    Adjustment             float64     `json:"adjustment"`
+    ExpectedWeeklyChangeKg float64     `json:"expectedWeeklyChangeKg"`
+    ActualWeeklyChangeKg   float64     `json:"actualWeeklyChangeKg"`
+    Trend                  WeightTrend `json:"trend"`
+    Reasoning              []string    `json:"reasoning"`
+}
+
+const (
+    movingAverageDays = 7
+    // Giorni considerati per la variazione settimanale
+    trendWindowDays   = 28
+    // Pesate e giorni coperti necessari per una stima affidabile
+    minTrendWeighIns  = 3
+    minTrendSpanDays  = 7
+    // Energia stimata di un kg di peso corporeo
+    kcalPerKg         = 7700
+    // Scarto settimanale entro cui il target resta invariato
+    rateToleranceKg   = 0.1
+    // Variazione massima del target da una settimana all'altra
+    maxAdjustment     = 250
+    adjustmentStep    = 10
+    // Giorni di pesate che servono per calcolare l'andamento
+    WeightHistoryDays = trendWindowDays + movingAverageDays
+)
+
+// Variazione settimanale attesa per obiettivo, in frazione del peso
+var goalWeeklyRates = map[string]float64{
+    "lose":     -0.005,
+    "maintain": 0,
+    "gain":     0.0025,
+}
+
+var ErrNoWeighIns = errors.New("no weigh-ins recorded")
+
+func parseDay(value string) (time.Time, error) {
+    day, err := time.Parse("2006-01-02", value)
+    if err != nil {
+        return day, fmt.Errorf("invalid date %q", value)
+    }
+    return day, nil
+}
+
+// Calcola media mobile e variazione settimanale; le pesate possono essere in
+// qualsiasi ordine, ma al più una per giorno
+func ComputeWeightTrend(weighIns []WeighIn) (WeightTrend, error) {
+    if len(weighIns) == 0 {
+        return WeightTrend{}, ErrNoWeighIns
+    }
+    sorted := append([]WeighIn(nil), weighIns...)
+    sort.Slice(sorted, func(i, j int) bool { return sorted[i].Date < sorted[j].Date })
+
+    days := make([]time.Time, len(sorted))
+    for i, weighIn := range sorted {
+        day, err := parseDay(weighIn.Date)
+        if err != nil {
+            return WeightTrend{}, err
+        }
+        if weighIn.WeightKg <= 0 {
+            return WeightTrend{}, fmt.Errorf("weight on %s must be positive", weighIn.Date)
+        }
+        days[i] = day
+    }
+
+    trend := WeightTrend{From: sorted[0].Date, To: sorted[len(sorted)-1].Date}
+    start := 0
+    for i, weighIn := range sorted {
+        for days[i].Sub(days[start]) >= movingAverageDays*24*time.Hour {
+            start++
+        }
+        var sum float64
+        for _, previous := range sorted[start : i+1] {
+            sum += previous.WeightKg
+        }
+        average := sum / float64(i+1-start)
+        trend.Points = append(trend.Points, TrendPoint{Date: weighIn.Date, WeightKg: weighIn.WeightKg, Average: roundTo2(average)})
+    }
+    last := trend.Points[len(trend.Points)-1]
+    trend.Latest = last.WeightKg
+    trend.MovingAverage = last.Average
+
+    // Regressione lineare della media mobile sulle ultime settimane
+    end := days[len(days)-1]
+    var xs, ys []float64
+    for i, point := range trend.Points {
+        age := end.Sub(days[i]).Hours() / 24
+        if age < trendWindowDays {
+            xs = append(xs, -age)
+            ys = append(ys, point.Average)
+        }
+    }
+    if len(xs) < minTrendWeighIns || -xs[0] < minTrendSpanDays {
+        return trend, nil
+    }
+    perDay := slope(xs, ys)
+    trend.WeeklyChangeKg = roundTo2(perDay * 7)
+    trend.WeeklyChangePct = roundTo2(perDay * 7 / trend.MovingAverage * 100)
+    trend.Reliable = true
+    return trend, nil
+}
+
+func slope(xs, ys []float64) float64 {
+    var meanX, meanY float64
+    for i := range xs {
+        meanX += xs[i]
+        meanY += ys[i]
+    }
+    meanX /= float64(len(xs))
+    meanY /= float64(len(ys))
+    var covariance, variance float64
+    for i := range xs {
+        covariance += (xs[i] - meanX) * (ys[i] - meanY)
+        variance += (xs[i] - meanX) * (xs[i] - meanX)
+    }
+    if variance == 0 {
+        return 0
+    }
+    return covariance / variance
+}
+
+// Suggerisce le calorie del prossimo piano: lo scarto tra la variazione
+// settimanale misurata e quella attesa viene convertito in kcal al giorno,
+// con una correzione limitata per non inseguire le oscillazioni
+func SuggestAdaptiveTarget(request AdaptiveTargetRequest, weighIns []WeighIn) (AdaptiveTarget, error) {
+    if request.CurrentCalories <= 0 {
+        return AdaptiveTarget{}, errors.New("currentCalories must be positive")
+    }
+    rate, ok := goalWeeklyRates[request.Goal]
+    if !ok {
+        return AdaptiveTarget{}, fmt.Errorf("goal must be \"lose\", \"maintain\" or \"gain\"")
+    }
+    if request.Sex != "" && request.Sex != "male" && request.Sex != "female" {
+        return AdaptiveTarget{}, fmt.Errorf("sex must be \"male\" or \"female\"")
+    }
+    trend, err := ComputeWeightTrend(weighIns)
+    if err != nil {
+        return AdaptiveTarget{}, err
+    }
+
+    current := float64(request.CurrentCalories)
+    result := AdaptiveTarget{CurrentCalories: current, SuggestedCalories: current, Trend: trend}
+    if request.WeeklyRateKg != nil {
+        result.ExpectedWeeklyChangeKg = roundTo2(*request.WeeklyRateKg)
+        result.Reasoning = append(result.Reasoning, fmt.Sprintf("variazione attesa indicata: %+.2f kg a settimana", result.ExpectedWeeklyChangeKg))
+    } else {
+        result.ExpectedWeeklyChangeKg = roundTo2(rate * trend.MovingAverage)
+        result.Reasoning = append(result.Reasoning, fmt.Sprintf("variazione attesa per l'obiettivo %q: %+.2f kg a settimana (%+.2f%% di %.1f kg)", request.Goal, result.ExpectedWeeklyChangeKg, rate*100, trend.MovingAverage))
+    }
+
+    if !trend.Reliable {
+        result.Reasoning = append(result.Reasoning, fmt.Sprintf("servono almeno %d pesate in %d giorni per stimare l'andamento: target invariato", minTrendWeighIns, minTrendSpanDays))
+        return result, nil
+    }
+    result.ActualWeeklyChangeKg = trend.WeeklyChangeKg
+    result.Reasoning = append(result.Reasoning, fmt.Sprintf("variazione misurata: %+.2f kg a settimana (media mobile a %d giorni, ultime %d settimane)", trend.WeeklyChangeKg, movingAverageDays, trendWindowDays/7))
+
+    gap := result.ActualWeeklyChangeKg - result.ExpectedWeeklyChangeKg
+    if math.Abs(gap) <= rateToleranceKg {
+        result.Reasoning = append(result.Reasoning, fmt.Sprintf("scarto di %+.2f kg entro la tolleranza di %.1f kg: target invariato", gap, rateToleranceKg))
+        return result, nil
+    }
+
+    adjustment := -gap * kcalPerKg / 7
+    direction := "più lento"
+    if gap > 0 == (result.ExpectedWeeklyChangeKg > 0) {
+        direction = "più veloce"
+    }
+    if result.ExpectedWeeklyChangeKg == 0 {
+        direction = "fuori dal mantenimento"
+    }
+    result.Reasoning = append(result.Reasoning, fmt.Sprintf("scarto di %+.2f kg a settimana (%s del previsto), pari a circa %+.0f kcal al giorno", gap, direction, adjustment))
+    if math.Abs(adjustment) > maxAdjustment {
+        adjustment = math.Copysign(maxAdjustment, adjustment)
+        result.Reasoning = append(result.Reasoning, fmt.Sprintf("correzione limitata a %+.0f kcal per settimana", adjustment))
+    }
+    suggested := math.Round((current+adjustment)/adjustmentStep) * adjustmentStep
+
+    if request.Sex != "" {
+        minimum := float64(minCaloriesFemale)
+        if request.Sex == "male" {
+            minimum = minCaloriesMale
+        }
+        if suggested < minimum {
+            result.Reasoning = append(result.Reasoning, fmt.Sprintf("target alzato da %.0f al minimo di %.0f kcal", suggested, minimum))
+            suggested = minimum
+        }
+    }
+    result.SuggestedCalories = suggested
+    result.Adjustment = suggested - current
+    result.Reasoning = append(result.Reasoning, fmt.Sprintf("nuovo target: %.0f kcal (%+.0f)", result.SuggestedCalories, result.Adjustment))
+    return result, nil
+}
@@ -0,0 +1,166 @@
+package planner
+
+import (
+    "errors"
+    "math"
+    "testing"
+    "time"
+)
+
+// Una pesata al giorno per days giorni a partire dal 1° settembre 2026,
+// con variazione costante di perDay kg
+func linearWeighIns(start, perDay float64, days int) []WeighIn {
+    first := time.Date(2026, time.September, 1, 0, 0, 0, 0, time.UTC)
+    weighIns := make([]WeighIn, days)
+    for i := range weighIns {
+        weighIns[i] = WeighIn{Date: first.AddDate(0, 0, i).Format("2006-01-02"), WeightKg: roundTo2(start + perDay*float64(i))}
+    }
+    return weighIns
+}
+
+func TestComputeWeightTrend(t *testing.T) {
+    reversed := linearWeighIns(80, -0.1, WeightHistoryDays)
+    for i, j := 0, len(reversed)-1; i < j; i, j = i+1, j-1 {
+        reversed[i], reversed[j] = reversed[j], reversed[i]
+    }
+
+    tests := []struct {
+        name     string
+        weighIns []WeighIn
+        reliable bool
+        weekly   float64
+        average  float64
+    }{
+        {name: "steady loss", weighIns: linearWeighIns(80, -0.1, WeightHistoryDays), reliable: true, weekly: -0.7, average: 76.9},
+        {name: "unsorted weigh-ins", weighIns: reversed, reliable: true, weekly: -0.7, average: 76.9},
+        {name: "steady gain", weighIns: linearWeighIns(70, 0.05, WeightHistoryDays), reliable: true, weekly: 0.35, average: 71.55},
+        {name: "stable", weighIns: linearWeighIns(65, 0, 10), reliable: true, weekly: 0, average: 65},
+        {name: "too few days", weighIns: linearWeighIns(80, -0.1, 5), average: 79.8},
+        {
+            name:     "too few weigh-ins",
+            weighIns: []WeighIn{{Date: "2026-09-01", WeightKg: 80}, {Date: "2026-09-20", WeightKg: 79}},
+            average:  79,
+        },
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            trend, err := ComputeWeightTrend(tt.weighIns)
+            if err != nil {
+                t.Fatal(err)
+            }
+            if trend.Reliable != tt.reliable {
+                t.Errorf("reliable = %v, want %v", trend.Reliable, tt.reliable)
+            }
+            if math.Abs(trend.WeeklyChangeKg-tt.weekly) > 0.01 {
+                t.Errorf("weekly change = %g, want %g", trend.WeeklyChangeKg, tt.weekly)
+            }
+            if math.Abs(trend.MovingAverage-tt.average) > 0.01 {
+                t.Errorf("moving average = %g, want %g", trend.MovingAverage, tt.average)
+            }
+            if len(trend.Points) != len(tt.weighIns) {
+                t.Errorf("%d points, want %d", len(trend.Points), len(tt.weighIns))
+            }
+        })
+    }
+}
+
+func TestComputeWeightTrendErrors(t *testing.T) {
+    tests := []struct {
+        name     string
+        weighIns []WeighIn
+    }{
+        {name: "no weigh-ins"},
+        {name: "invalid date", weighIns: []WeighIn{{Date: "01/09/2026", WeightKg: 80}}},
+        {name: "zero weight", weighIns: []WeighIn{{Date: "2026-09-01", WeightKg: 0}}},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            _, err := ComputeWeightTrend(tt.weighIns)
+            if err == nil {
+                t.Fatal("expected an error")
+            }
+            if tt.weighIns == nil && !errors.Is(err, ErrNoWeighIns) {
+                t.Errorf("got %v, want %v", err, ErrNoWeighIns)
+            }
+        })
+    }
+}
+
+func TestSuggestAdaptiveTarget(t *testing.T) {
+    rate := func(kg float64) *float64 { return &kg }
+    tests := []struct {
+        name     string
+        request  AdaptiveTargetRequest
+        weighIns []WeighIn
+        want     float64
+        wantErr  bool
+    }{
+        {
+            // Atteso -0,38 kg, misurato -0,7: la correzione di +352 kcal viene limitata
+            name:     "losing faster than expected",
+            request:  AdaptiveTargetRequest{CurrentCalories: 2000, Goal: "lose"},
+            weighIns: linearWeighIns(80, -0.1, WeightHistoryDays),
+            want:     2250,
+        },
+        {
+            name:     "losing as requested",
+            request:  AdaptiveTargetRequest{CurrentCalories: 2000, Goal: "lose", WeeklyRateKg: rate(-0.7)},
+            weighIns: linearWeighIns(80, -0.1, WeightHistoryDays),
+            want:     2000,
+        },
+        {
+            name:     "maintaining",
+            request:  AdaptiveTargetRequest{CurrentCalories: 2000, Goal: "maintain"},
+            weighIns: linearWeighIns(80, 0, WeightHistoryDays),
+            want:     2000,
+        },
+        {
+            // Atteso +0,2 kg, misurato 0: +220 kcal
+            name:     "not gaining",
+            request:  AdaptiveTargetRequest{CurrentCalories: 2500, Goal: "gain"},
+            weighIns: linearWeighIns(80, 0, WeightHistoryDays),
+            want:     2720,
+        },
+        {
+            name:     "not enough weigh-ins",
+            request:  AdaptiveTargetRequest{CurrentCalories: 2000, Goal: "lose"},
+            weighIns: linearWeighIns(80, 0.2, 3),
+            want:     2000,
+        },
+        {
+            name:     "minimum for sex",
+            request:  AdaptiveTargetRequest{CurrentCalories: 1300, Goal: "lose", Sex: "female"},
+            weighIns: linearWeighIns(80, 0, WeightHistoryDays),
+            want:     minCaloriesFemale,
+        },
+        {name: "missing current calories", request: AdaptiveTargetRequest{Goal: "lose"}, weighIns: linearWeighIns(80, 0, 10), wantErr: true},
+        {name: "unknown goal", request: AdaptiveTargetRequest{CurrentCalories: 2000, Goal: "bulk"}, weighIns: linearWeighIns(80, 0, 10), wantErr: true},
+        {name: "unknown sex", request: AdaptiveTargetRequest{CurrentCalories: 2000, Goal: "lose", Sex: "x"}, weighIns: linearWeighIns(80, 0, 10), wantErr: true},
+        {name: "no weigh-ins", request: AdaptiveTargetRequest{CurrentCalories: 2000, Goal: "lose"}, wantErr: true},
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            result, err := SuggestAdaptiveTarget(tt.request, tt.weighIns)
+            if tt.wantErr {
+                if err == nil {
+                    t.Fatal("expected an error")
+                }
+                return
+            }
+            if err != nil {
+                t.Fatal(err)
+            }
+            if result.SuggestedCalories != tt.want {
+                t.Errorf("suggested %g kcal, want %g: %v", result.SuggestedCalories, tt.want, result.Reasoning)
+            }
+            if result.Adjustment != result.SuggestedCalories-result.CurrentCalories {
+                t.Errorf("adjustment %g, want %g", result.Adjustment, result.SuggestedCalories-result.CurrentCalories)
+            }
+            if math.Abs(result.Adjustment) > maxAdjustment && result.SuggestedCalories != minCaloriesFemale && result.SuggestedCalories != minCaloriesMale {
+                t.Errorf("adjustment %g over the weekly maximum of %d", result.Adjustment, maxAdjustment)
+            }
+        })
+    }
+}
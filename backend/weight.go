@@ -0,0 +1,105 @@
+package main
+
+import (
+    "errors"
+    "fmt"
+    "net/http"
+    "strconv"
+    "time"
+
+    "github.com/denisgjonmarkaj/meal-planner/planner"
+    "gorm.io/gorm"
+)
+
+// Pesata di un utente; una sola per giorno, registrarla di nuovo la sostituisce
+type WeighInRecord struct {
+    ID        uint    `gorm:"primaryKey"`
+    UserID    uint    `gorm:"uniqueIndex:idx_weigh_ins_user_date;not null"`
+    Date      string  `gorm:"uniqueIndex:idx_weigh_ins_user_date;not null"`
+    WeightKg  float64 `gorm:"not null"`
+    CreatedAt time.Time
+}
+
+type WeighInEntry struct {
+    ID       uint    `json:"id"`
+    Date     string  `json:"date"`
+    WeightKg float64 `json:"weightKg"`
+}
+
+var (
+    errWeighInNotFound = errors.New("weigh-in not found")
+    errInvalidWeighIn  = errors.New("invalid weigh-in")
+)
+
+// Registra la pesata; created è falso se sostituisce quella dello stesso giorno
+func logWeighIn(db *gorm.DB, userID uint, weighIn planner.WeighIn) (record WeighInRecord, created bool, err error) {
+    if _, err := parseDate("date", weighIn.Date); err != nil {
+        return record, false, err
+    }
+    if weighIn.WeightKg < 20 || weighIn.WeightKg > 400 {
+        return record, false, fmt.Errorf("%w: weightKg must be between 20 and 400", errInvalidWeighIn)
+    }
+
+    err = db.Where("user_id = ? AND date = ?", userID, weighIn.Date).First(&record).Error
+    if errors.Is(err, gorm.ErrRecordNotFound) {
+        record = WeighInRecord{UserID: userID, Date: weighIn.Date, WeightKg: weighIn.WeightKg}
+        return record, true, db.Create(&record).Error
+    }
+    if err != nil {
+        return record, false, err
+    }
+    record.WeightKg = weighIn.WeightKg
+    return record, false, db.Save(&record).Error
+}
+
+// Pesate dell'utente tra from e to inclusi, in ordine di data
+func listWeighIns(db *gorm.DB, userID uint, from, to string) ([]WeighInRecord, error) {
+    var records []WeighInRecord
+    err := db.Where("user_id = ? AND date >= ? AND date <= ?", userID, from, to).Order("date").Find(&records).Error
+    return records, err
+}
+
+func deleteWeighIn(db *gorm.DB, userID uint, id string) error {
+    weighInID, err := strconv.ParseUint(id, 10, 64)
+    if err != nil {
+        return errWeighInNotFound
+    }
+    result := db.Where("id = ? AND user_id = ?", weighInID, userID).Delete(&WeighInRecord{})
+    if result.Error != nil {
+        return result.Error
+    }
+    if result.RowsAffected == 0 {
+        return errWeighInNotFound
+    }
+    return nil
+}
+
+// Pesate usate per andamento e target adattivo: quelle dei giorni fino a to
+// compresi nella finestra considerata dal planner
+func recentWeighIns(db *gorm.DB, userID uint, to time.Time) ([]planner.WeighIn, error) {
+    from := to.AddDate(0, 0, -planner.WeightHistoryDays)
+    records, err := listWeighIns(db, userID, from.Format(dateLayout), to.Format(dateLayout))
+    if err != nil {
+        return nil, err
+    }
+    weighIns := make([]planner.WeighIn, 0, len(records))
+    for _, record := range records {
+        weighIns = append(weighIns, planner.WeighIn{Date: record.Date, WeightKg: record.WeightKg})
+    }
+    return weighIns, nil
+}
+
+func weightErrorStatus(err error) int {
+    switch {
+    case errors.Is(err, errInvalidDate), errors.Is(err, errInvalidWeighIn):
+        return http.StatusBadRequest
+    case errors.Is(err, errWeighInNotFound), errors.Is(err, planner.ErrNoWeighIns):
+        return http.StatusNotFound
+    default:
+        return http.StatusInternalServerError
+    }
+}
+
+func (r WeighInRecord) entry() WeighInEntry {
+    return WeighInEntry{ID: r.ID, Date: r.Date, WeightKg: r.WeightKg}
+}
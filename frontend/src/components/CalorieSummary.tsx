@@ -6,22 +6,11 @@ import { PieChart, Pie, Cell, ResponsiveContainer, Tooltip } from 'recharts';
 const CalorieSummary = ({ mealPlan, targetCalories }) => {
     if (!mealPlan) return null;
 
-    const meals = Object.entries(mealPlan).map(([name, meal]) => ({
-        name: name.charAt(0).toUpperCase() + name.slice(1),
-        calories: meal.calories,
-        expectedPercentage:
-            name === 'colazione' ? 25 :
-                name === 'spuntino' ? 10 :
-                    name === 'pranzo' ? 35 :
-                        name === 'merenda' ? 10 :
-                            name === 'cena' ? 20 : 0,
-        expectedCalories: (targetCalories * (
-            name === 'colazione' ? 0.25 :
-                name === 'spuntino' ? 0.10 :
-                    name === 'pranzo' ? 0.35 :
-                        name === 'merenda' ? 0.10 :
-                            name === 'cena' ? 0.20 : 0
-        ))
+    const meals = (mealPlan.slots || []).map((slot) => ({
+        name: slot.name.charAt(0).toUpperCase() + slot.name.slice(1),
+        calories: slot.calories,
+        expectedPercentage: Math.round(slot.share * 100),
+        expectedCalories: targetCalories * slot.share
     }));
 
     const totalCalories = meals.reduce((sum, meal) => sum + meal.calories, 0);
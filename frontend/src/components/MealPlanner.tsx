@@ -25,8 +25,15 @@ interface Meal {
   calories: number;
 }
 
+interface SlotMeal extends Meal {
+  name: string;
+  profile: string;
+  share: number;
+}
+
 interface MealPlan {
-  [key: string]: Meal;
+  slots: SlotMeal[];
+  calories: number;
 }
 
 interface IngredientCategory {
@@ -247,16 +254,16 @@ const MealPlanner: React.FC = () => {
         </CardContent>
       </Card>
 
-      {mealPlan && Object.keys(mealPlan).length > 0 && (
+      {mealPlan && mealPlan.slots && mealPlan.slots.length > 0 && (
         <>
           <CalorieSummary mealPlan={mealPlan} targetCalories={parseInt(calories)} />
 
           <div className="mt-6 grid md:grid-cols-2 lg:grid-cols-3 gap-4">
-            {Object.entries(mealPlan).map(([mealType, meal]) => (
-              <Card key={mealType}>
+            {mealPlan.slots.map((meal) => (
+              <Card key={meal.name}>
                 <CardHeader>
                   <CardTitle className="text-lg capitalize flex justify-between items-center">
-                    <span>{mealType}</span>
+                    <span>{meal.name}</span>
                     <span className="text-sm font-normal text-gray-600">
                       {meal.calories} kcal
                     </span>